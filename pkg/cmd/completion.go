@@ -0,0 +1,79 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// bashCompletionFunc completes flavor names by asking ridectl flavor ls, it
+// is only called when cobra has nothing else to offer.
+const bashCompletionFunc = `__ridectl_get_flavors()
+{
+    local ridectl_out
+    if ridectl_out=$(ridectl flavor ls -o name "${cur}" 2>/dev/null); then
+        COMPREPLY=( $(compgen -W "${ridectl_out[*]}" -- "$cur") )
+    fi
+}
+
+__custom_func() {
+    case ${last_command} in
+        ridectl_loadflavor)
+            # The first argument is the instance, the second a flavor or a local file.
+            if [[ ${#nouns[@]} -eq 1 ]]; then
+                __ridectl_get_flavors
+                COMPREPLY+=( $(compgen -f -- "$cur") )
+            fi
+            return
+            ;;
+        ridectl_flavor_describe)
+            if [[ ${#nouns[@]} -eq 0 ]]; then
+                __ridectl_get_flavors
+            fi
+            return
+            ;;
+        *)
+            ;;
+    esac
+}
+`
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+	rootCmd.BashCompletionFunction = bashCompletionFunc
+}
+
+var completionCmd = &cobra.Command{
+	Use:   "completion bash",
+	Short: "Print the shell completion script",
+	Long: `Print the bash completion script for ridectl. To load it in every shell, add this to your ~/.bashrc:
+	source <(ridectl completion bash)
+zsh users can load it after running autoload -U bashcompinit && bashcompinit.`,
+	ValidArgs: []string{"bash"},
+	Args: func(_ *cobra.Command, args []string) error {
+		if len(args) != 1 || args[0] != "bash" {
+			return fmt.Errorf("Only bash completion is supported")
+		}
+		return nil
+	},
+	RunE: func(_ *cobra.Command, args []string) error {
+		return rootCmd.GenBashCompletion(os.Stdout)
+	},
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Ridecell/ridectl/pkg/kubernetes"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var dbYesFlag bool
+var dbDumpOutputFlag string
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbDumpCmd)
+	dbCmd.AddCommand(dbRestoreCmd)
+
+	dbCmd.PersistentFlags().BoolVar(&dbPortForwardFlag, "port-forward", false, "(optional) Connect through a proxy pod in the cluster, for use outside the VPC")
+	dbCmd.PersistentFlags().BoolVarP(&dbYesFlag, "yes", "y", false, "(optional) Don't ask for confirmation on prod instances")
+	// Shadows the global --output, dumps are never printed as tables.
+	dbDumpCmd.Flags().StringVarP(&dbDumpOutputFlag, "output", "o", "", "(optional) File to write the dump to")
+}
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Dump and restore Summon databases",
+	Long: `Dump a Summon instance or microservice database to a file and restore it into another, for example to copy a QA tenant.
+Dumps are pg_dump custom format archives compressed with bzip2. pg_dump, pg_restore and bzip2 need to be installed locally.
+Examples:
+	ridectl db dump darwin-qa -o darwin.dump.bz2
+	ridectl db restore darwin-dev darwin.dump.bz2`,
+}
+
+var dbDumpCmd = &cobra.Command{
+	Use:   "dump [flags] <cluster_name>",
+	Short: "Dump a database to a file",
+	Long:  "Dump a database to a file. -o sets the file to write, - writes to stdout, and it defaults to <cluster_name>-<timestamp>.dump.bz2.",
+	Args: func(_ *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("Cluster name argument is required")
+		}
+		if len(args) > 1 {
+			return fmt.Errorf("Too many arguments")
+		}
+		return nil
+	},
+	RunE: func(_ *cobra.Command, args []string) error {
+		err := confirmProdDB(args[0], fmt.Sprintf("%s is a production instance, this copies its data to your machine. Continue", args[0]))
+		if err != nil {
+			return err
+		}
+		conn, err := getDBConnection(args[0], false, dbPortForwardFlag)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		if dbDumpOutputFlag == "-" {
+			return conn.Dump(os.Stdout)
+		}
+		filename := dbDumpOutputFlag
+		if filename == "" {
+			filename = fmt.Sprintf("%s-%s.dump.bz2", args[0], time.Now().Format("20060102-150405"))
+		}
+		// Write somewhere else first, so a failed dump doesn't look like a good one.
+		partial := filename + ".partial"
+		outFile, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return errors.Wrap(err, "unable to create dump file")
+		}
+		err = conn.Dump(outFile)
+		closeErr := outFile.Close()
+		if err == nil && closeErr != nil {
+			err = errors.Wrap(closeErr, "unable to write dump file")
+		}
+		if err != nil {
+			os.Remove(partial)
+			return err
+		}
+		err = os.Rename(partial, filename)
+		if err != nil {
+			return errors.Wrap(err, "unable to write dump file")
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", filename)
+		return nil
+	},
+}
+
+var dbRestoreCmd = &cobra.Command{
+	Use:   "restore [flags] <cluster_name> <file>",
+	Short: "Restore a database from a dump, replacing its contents",
+	Long:  "Restore a dump made by db dump into a database, replacing its contents. Use - to read the dump from stdin. The restore runs in a single transaction, so the database is left as it was if it fails.",
+	Args: func(_ *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return fmt.Errorf("Cluster name and file arguments are required")
+		}
+		if len(args) > 2 {
+			return fmt.Errorf("Too many arguments")
+		}
+		return nil
+	},
+	RunE: func(_ *cobra.Command, args []string) error {
+		var in io.Reader = os.Stdin
+		if args[1] != "-" {
+			inFile, err := os.Open(args[1])
+			if err != nil {
+				return errors.Wrap(err, "unable to open dump file")
+			}
+			defer inFile.Close()
+			in = inFile
+		}
+		err := confirmProdDB(args[0], fmt.Sprintf("%s is a production instance, this replaces its whole database with %s. Continue", args[0], args[1]))
+		if err != nil {
+			return err
+		}
+		conn, err := getDBConnection(args[0], false, dbPortForwardFlag)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return conn.Restore(in)
+	},
+}
+
+// confirmProdDB asks before touching a prod database, unless --yes was given.
+func confirmProdDB(instance string, label string) error {
+	target, err := kubernetes.ParseSubject(instance)
+	if err != nil {
+		return err
+	}
+	if target.Env != "prod" || dbYesFlag {
+		return nil
+	}
+	// Also covers restoring from stdin, the prompt would read the dump.
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return errors.Errorf("%s is a production instance, use --yes to confirm", instance)
+	}
+	yes, err := getUserConfirmation(label)
+	if err != nil {
+		return err
+	}
+	if !yes {
+		return errors.New("aborted")
+	}
+	return nil
+}
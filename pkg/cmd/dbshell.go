@@ -17,22 +17,43 @@ limitations under the License.
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
-	"path/filepath"
+	"os/exec"
+	"time"
 
-	"github.com/Ridecell/ridectl/pkg/exec"
 	"github.com/Ridecell/ridectl/pkg/kubernetes"
+	"github.com/Ridecell/ridectl/pkg/postgres"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
 	dbv1beta1 "github.com/Ridecell/ridecell-operator/pkg/apis/db/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+var dbReadOnlyFlag bool
+var dbPortForwardFlag bool
+var dbProxyImageFlag string
+var dbCommandFlag string
+var dbFileFlag string
+
+// psqlNull marks NULLs in CSV output from psql, so they can be told apart
+// from empty strings.
+const psqlNull = `\N`
+
 func init() {
 	rootCmd.AddCommand(dbShellCmd)
+	dbShellCmd.Flags().BoolVar(&dbReadOnlyFlag, "read-only", false, "(optional) Connect with the read-only user if there is one and only allow read-only transactions")
+	dbShellCmd.Flags().BoolVar(&dbPortForwardFlag, "port-forward", false, "(optional) Connect through a proxy pod in the cluster, for use outside the VPC")
+	dbShellCmd.Flags().StringVar(&dbProxyImageFlag, "proxy-image", "alpine/socat", "(optional) Image for the --port-forward proxy pod, must provide socat")
+	dbShellCmd.Flags().StringVarP(&dbCommandFlag, "command", "c", "", "(optional) Run this SQL and exit")
+	dbShellCmd.Flags().StringVarP(&dbFileFlag, "file", "f", "", "(optional) Run the SQL in this file and exit")
 }
 
 var dbShellCmd = &cobra.Command{
@@ -40,7 +61,10 @@ var dbShellCmd = &cobra.Command{
 	Short: "Open a database shell on a Summon instance or microservice",
 	Long: "Open an interactive PostgreSQL shell for a Summon instance or microservice running on Kubernetes.\n" +
 		"For summon instances: dbshell <tenant>-<env>                   -- e.g. ridectl dbshell darwin-qa\n" +
-		"For microservices: dbshell svc-<region>-<env>-<microservice>   -- e.g. ridectl dbshell svc-us-master-dispatch",
+		"For microservices: dbshell svc-<region>-<env>-<microservice>   -- e.g. ridectl dbshell svc-us-master-dispatch\n" +
+		"Run a query instead with -c or -f, the results are printed in the format from -o: table, csv, json or yaml.\n" +
+		"  ridectl dbshell darwin-qa --read-only -c 'select count(*) from auth_user' -o csv",
+	Annotations: map[string]string{extraOutputFormats: "csv"},
 	Args: func(_ *cobra.Command, args []string) error {
 		if len(args) == 0 {
 			return fmt.Errorf("Cluster name argument is required")
@@ -51,51 +75,201 @@ var dbShellCmd = &cobra.Command{
 		return nil
 	},
 	RunE: func(_ *cobra.Command, args []string) error {
-		// Determine if we are trying to connect to a microservice or summonplatform db
-		target, err := kubernetes.ParseSubject(args[0])
-		if err != nil {
-			return err
+		if dbCommandFlag != "" && dbFileFlag != "" {
+			return errors.New("only one of -c and -f can be used")
 		}
-		fetchObject := &kubernetes.KubeObject{Top: &dbv1beta1.PostgresDatabase{}}
-		err = kubernetes.GetObject(kubeconfigFlag, target.Name, target.Namespace, fetchObject)
+		query := dbCommandFlag != "" || dbFileFlag != ""
+
+		conn, err := getDBConnection(args[0], dbReadOnlyFlag, dbPortForwardFlag)
 		if err != nil {
 			return err
 		}
+		defer conn.Close()
 
-		pgdbObject, ok := fetchObject.Top.(*dbv1beta1.PostgresDatabase)
-		if !ok {
-			return errors.New("unable to convert to PostgresDatabase object")
+		if !query {
+			return conn.Run(exec.Command("psql"), os.Stdin, os.Stdout)
 		}
-		postgresConnection := pgdbObject.Status.Connection
-		fetchSecret := &corev1.Secret{}
 
-		err = kubernetes.GetObjectWithClient(fetchObject.Client, postgresConnection.PasswordSecretRef.Name, target.Namespace, fetchSecret)
+		psqlArgs := []string{"-X", "-v", "ON_ERROR_STOP=1"}
+		if dbCommandFlag != "" {
+			psqlArgs = append(psqlArgs, "-c", dbCommandFlag)
+		} else {
+			psqlArgs = append(psqlArgs, "-f", dbFileFlag)
+		}
+		if outputFlag == "table" {
+			return conn.Run(exec.Command("psql", psqlArgs...), nil, os.Stdout)
+		}
+		psqlArgs = append(psqlArgs, "--csv", "-P", "null="+psqlNull)
+		if outputFlag == "csv" {
+			return conn.Run(exec.Command("psql", psqlArgs...), nil, os.Stdout)
+		}
+
+		out := &bytes.Buffer{}
+		err = conn.Run(exec.Command("psql", psqlArgs...), nil, out)
 		if err != nil {
 			return err
 		}
-
-		tempfile, err := ioutil.TempFile("", "")
+		rows, err := parsePsqlCSV(out)
 		if err != nil {
-			return errors.Wrap(err, "failed to create tempfile")
+			return err
 		}
-		defer os.Remove(tempfile.Name())
+		return writeOutput(os.Stdout, outputFlag, rows, nil)
+	},
+}
+
+// dbConnection is a database connection along with anything set up to reach
+// it, like a port forward.
+type dbConnection struct {
+	postgres.Connection
+
+	cleanup []func()
+}
 
-		tempfilepath, err := filepath.Abs(tempfile.Name())
+// getDBConnection finds the database of an instance from its PostgresDatabase
+// status. With readOnly the read-only user's secret is used when there is
+// one, and with portForward the connection goes through a proxy pod.
+func getDBConnection(instance string, readOnly bool, portForward bool) (*dbConnection, error) {
+	// Determine if we are trying to connect to a microservice or summonplatform db
+	target, err := kubernetes.ParseSubject(instance)
+	if err != nil {
+		return nil, err
+	}
+	fetchObject := &kubernetes.KubeObject{Top: &dbv1beta1.PostgresDatabase{}, Region: target.Region}
+	err = kubernetes.GetObject(kubeconfigFlag, target.Name, target.Namespace, fetchObject)
+	if err != nil {
+		return nil, err
+	}
+
+	pgdbObject, ok := fetchObject.Top.(*dbv1beta1.PostgresDatabase)
+	if !ok {
+		return nil, errors.New("unable to convert to PostgresDatabase object")
+	}
+	postgresConnection := pgdbObject.Status.Connection
+	conn := &dbConnection{Connection: postgres.Connection{
+		Host:     postgresConnection.Host,
+		Port:     int(postgresConnection.Port),
+		Database: postgresConnection.Database,
+		Username: postgresConnection.Username,
+		ReadOnly: readOnly,
+	}}
+	if conn.Port == 0 {
+		conn.Port = 5432
+	}
+
+	fetchSecret := &corev1.Secret{}
+	if readOnly {
+		// The read-only user is optional, read-only transactions are enforced either way.
+		err = kubernetes.GetObjectWithClient(fetchObject.Client, fmt.Sprintf("%s-readonly.postgres-user-password", target.Name), target.Namespace, fetchSecret)
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return nil, err
+		}
+		if err == nil && len(fetchSecret.Data["username"]) > 0 {
+			conn.Username = string(fetchSecret.Data["username"])
+			conn.Password = string(fetchSecret.Data["password"])
+		}
+	}
+	if conn.Password == "" {
+		err = kubernetes.GetObjectWithClient(fetchObject.Client, postgresConnection.PasswordSecretRef.Name, target.Namespace, fetchSecret)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		conn.Password = string(fetchSecret.Data[postgresConnection.PasswordSecretRef.Key])
+	}
 
-		password := fetchSecret.Data[postgresConnection.PasswordSecretRef.Key]
+	if portForward {
+		err = conn.startProxy(fetchObject, target.Name, target.Namespace)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
 
-		// hostname:port:database:username:password
-		passwordFileString := fmt.Sprintf("%s:%s:%s:%s:%s", postgresConnection.Host, "*", postgresConnection.Database, postgresConnection.Username, password)
-		_, err = tempfile.Write([]byte(passwordFileString))
+// startProxy runs a socat pod next to the database and forwards a local port
+// to it, since port forwards can only reach pods.
+func (c *dbConnection) startProxy(fetchObject *kubernetes.KubeObject, name string, namespace string) error {
+	// A deadline in case ridectl dies before it can clean up.
+	deadline := int64(12 * 60 * 60)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-dbproxy-%d", name, time.Now().Unix()),
+			Namespace: namespace,
+			Labels:    map[string]string{"app.kubernetes.io/component": "ridectl-dbproxy"},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:         corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds: &deadline,
+			Containers: []corev1.Container{{
+				Name:  "socat",
+				Image: dbProxyImageFlag,
+				Args:  []string{"tcp-listen:5432,fork,reuseaddr", fmt.Sprintf("tcp-connect:%s:%d", c.Host, c.Port)},
+				Ports: []corev1.ContainerPort{{ContainerPort: 5432}},
+			}},
+		},
+	}
+	fmt.Fprintf(os.Stderr, "Starting database proxy pod %s/%s\n", pod.Namespace, pod.Name)
+	err := fetchObject.Client.Create(context.Background(), pod)
+	if err != nil {
+		return errors.Wrap(err, "unable to create proxy pod")
+	}
+	c.cleanup = append(c.cleanup, func() {
+		err := fetchObject.Client.Delete(context.Background(), pod)
 		if err != nil {
-			return errors.Wrap(err, "failed to write password to tempfile")
+			fmt.Fprintf(os.Stderr, "Unable to delete proxy pod %s: %v\n", pod.Name, err)
 		}
+	})
 
-		psqlCmd := []string{"psql", "-h", postgresConnection.Host, "-U", postgresConnection.Username, postgresConnection.Database}
-		os.Setenv("PGPASSFILE", tempfilepath)
-		return exec.Exec(psqlCmd)
-	},
+	err = kubernetes.WaitForPodRunning(fetchObject, pod, 2*time.Minute)
+	if err != nil {
+		return err
+	}
+	stopChan := make(chan struct{})
+	localPort, err := kubernetes.PortForward(fetchObject, pod, 5432, stopChan)
+	if err != nil {
+		return err
+	}
+	c.cleanup = append(c.cleanup, func() { close(stopChan) })
+	c.Host = "127.0.0.1"
+	c.Port = localPort
+	return nil
+}
+
+// Close tears down anything set up for the connection, newest first.
+func (c *dbConnection) Close() {
+	for i := len(c.cleanup) - 1; i >= 0; i-- {
+		c.cleanup[i]()
+	}
+	c.cleanup = nil
+}
+
+// parsePsqlCSV turns psql's CSV output into one map per row.
+func parsePsqlCSV(in io.Reader) ([]map[string]interface{}, error) {
+	reader := csv.NewReader(in)
+	// Checked below, with a hint about the likely cause.
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing psql output")
+	}
+	rows := []map[string]interface{}{}
+	if len(records) == 0 {
+		return rows, nil
+	}
+	header := records[0]
+	for _, record := range records[1:] {
+		if len(record) != len(header) {
+			return nil, errors.New("psql output doesn't match its columns, only one query is supported with json and yaml output")
+		}
+		row := map[string]interface{}{}
+		for i, value := range record {
+			if value == psqlNull {
+				row[header[i]] = nil
+			} else {
+				row[header[i]] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
 }
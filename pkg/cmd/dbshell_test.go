@@ -0,0 +1,65 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd_test
+
+import (
+	"bytes"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Ridecell/ridectl/pkg/cmd"
+)
+
+var _ = Describe("dbshell", func() {
+	Context("parsePsqlCSV", func() {
+		It("maps each row by column name", func() {
+			rows, err := cmd.ParsePsqlCSV(strings.NewReader("id,username,last_login\n1,alice,2019-03-01\n2,\"bob, jr\",\\N\n"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rows).To(Equal([]map[string]interface{}{
+				{"id": "1", "username": "alice", "last_login": "2019-03-01"},
+				{"id": "2", "username": "bob, jr", "last_login": nil},
+			}))
+		})
+
+		It("keeps empty strings apart from NULLs", func() {
+			rows, err := cmd.ParsePsqlCSV(strings.NewReader("note\n\"\"\n\\N\n"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rows).To(Equal([]map[string]interface{}{{"note": ""}, {"note": nil}}))
+		})
+
+		It("returns no rows for empty output", func() {
+			rows, err := cmd.ParsePsqlCSV(strings.NewReader(""))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rows).To(BeEmpty())
+		})
+
+		It("rejects the output of several queries", func() {
+			_, err := cmd.ParsePsqlCSV(strings.NewReader("count\n3\nid,username\n1,alice\n"))
+			Expect(err).To(MatchError(ContainSubstring("only one query is supported")))
+		})
+	})
+
+	It("renders query results as JSON", func() {
+		rows, err := cmd.ParsePsqlCSV(strings.NewReader("id,username\n1,\\N\n"))
+		Expect(err).ToNot(HaveOccurred())
+		out := &bytes.Buffer{}
+		Expect(cmd.WriteOutput(out, "json", rows, nil)).To(Succeed())
+		Expect(out.String()).To(MatchJSON(`[{"id": "1", "username": null}]`))
+	})
+})
@@ -0,0 +1,296 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	"github.com/Ridecell/ridectl/pkg/cmd/edit"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var diffRevFlag string
+var diffShowValuesFlag bool
+var diffTextconvFlag bool
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringVar(&diffRevFlag, "rev", "HEAD", "(optional) Git revision to compare against")
+	diffCmd.Flags().BoolVar(&diffShowValuesFlag, "show-values", false, "(optional) Show decrypted values instead of masking them")
+	diffCmd.Flags().BoolVar(&diffTextconvFlag, "textconv", false, "(optional) Print the decrypted file with masked values for use as a git textconv driver")
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [flags] <file>",
+	Short: "Show decrypted changes to an instance manifest",
+	Long: `Compares the decrypted secrets in a manifest against a git revision and lists the keys that were added, removed or changed.
+
+Values are masked unless --show-values is passed, so changes are visible without showing the secrets. Masks are an HMAC of the value under a key kept in ~/.ridectl/mask.key, so the same value always gets the same mask and re-encrypting a value doesn't change it. With --textconv the decrypted file is printed instead, which can be used as a git diff driver:
+
+  git config diff.ridectl.textconv "ridectl diff --textconv"
+  echo '*.yml diff=ridectl' >> .gitattributes`,
+	Args: func(_ *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("File argument is required")
+		}
+		if len(args) > 1 {
+			return fmt.Errorf("Too many arguments")
+		}
+		return nil
+	},
+	RunE: func(_ *cobra.Command, args []string) error {
+		cipher, err := newCipher()
+		if err != nil {
+			return err
+		}
+		display := func(value string) string {
+			return fmt.Sprintf("%q", value)
+		}
+		if !diffShowValuesFlag {
+			key, err := loadMaskKey()
+			if err != nil {
+				return err
+			}
+			display = newValueMask(key)
+		}
+
+		newManifest, err := loadDecryptedManifest(args[0], cipher)
+		if err != nil {
+			return err
+		}
+		if diffTextconvFlag {
+			if !diffShowValuesFlag {
+				maskValues(newManifest, display)
+			}
+			return newManifest.Serialize(os.Stdout)
+		}
+
+		oldManifest, err := loadDecryptedRevision(args[0], diffRevFlag, cipher)
+		if err != nil {
+			return err
+		}
+		printSecretDiff(os.Stdout, oldManifest, newManifest, display)
+		return nil
+	},
+}
+
+// loadManifestFile reads a manifest, a missing file is treated as empty.
+func loadManifestFile(filename string) (edit.Manifest, error) {
+	inFile, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return edit.Manifest{}, nil
+		}
+		return nil, errors.Wrapf(err, "error reading input file %s", filename)
+	}
+	defer inFile.Close()
+	manifest, err := edit.NewManifest(inFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding input YAML")
+	}
+	return manifest, nil
+}
+
+// loadDecryptedManifest reads and decrypts a manifest, a missing file is
+// treated as empty.
+func loadDecryptedManifest(filename string, cipher edit.Cipher) (edit.Manifest, error) {
+	manifest, err := loadManifestFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return decryptManifest(manifest, cipher)
+}
+
+// loadDecryptedRevision reads and decrypts a manifest as of a git revision. A
+// file that doesn't exist in a valid revision is treated as empty.
+func loadDecryptedRevision(filename string, rev string, cipher edit.Cipher) (edit.Manifest, error) {
+	dir, file := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+
+	verifyCmd := exec.Command("git", "rev-parse", "--quiet", "--verify", rev+"^{commit}")
+	verifyCmd.Dir = dir
+	if verifyCmd.Run() != nil {
+		return nil, errors.Errorf("unknown git revision %s", rev)
+	}
+
+	// Check if the file exists in that revision first, so new files show up as all added.
+	object := fmt.Sprintf("%s:./%s", rev, file)
+	checkCmd := exec.Command("git", "cat-file", "-e", object)
+	checkCmd.Dir = dir
+	if checkCmd.Run() != nil {
+		return edit.Manifest{}, nil
+	}
+
+	showCmd := exec.Command("git", "show", object)
+	showCmd.Dir = dir
+	showCmd.Stderr = os.Stderr
+	out, err := showCmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s from git", object)
+	}
+	manifest, err := edit.NewManifest(bytes.NewReader(out))
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding input YAML")
+	}
+	return decryptManifest(manifest, cipher)
+}
+
+func decryptManifest(manifest edit.Manifest, cipher edit.Cipher) (edit.Manifest, error) {
+	err := manifest.Decrypt(cipher)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decrypting input manifest")
+	}
+	return manifest, nil
+}
+
+// loadMaskKey reads the key values are masked with, creating it the first
+// time. It's kept between runs since git runs textconv once for each side of
+// a diff, and the masks have to match.
+func loadMaskKey() ([]byte, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return nil, errors.Wrap(err, "error finding home directory")
+	}
+	path := filepath.Join(home, ".ridectl", "mask.key")
+	key, err := ioutil.ReadFile(path)
+	if err == nil {
+		if len(key) < 32 {
+			return nil, errors.Errorf("mask key %s is too short, remove it to create a new one", path)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "error reading mask key")
+	}
+
+	key = make([]byte, 32)
+	_, err = rand.Read(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating mask key")
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating mask key directory")
+	}
+	err = ioutil.WriteFile(path, key, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "error writing mask key")
+	}
+	return key, nil
+}
+
+// newValueMask returns a function hiding values while still letting identical
+// values be matched up. Without the key the masks can't be used to guess the
+// values.
+func newValueMask(key []byte) func(string) string {
+	return func(value string) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(value))
+		return fmt.Sprintf("<masked %x>", mac.Sum(nil)[:4])
+	}
+}
+
+// maskValues replaces the values of a decrypted manifest with their masks.
+func maskValues(manifest edit.Manifest, display func(string) string) {
+	for _, obj := range manifest {
+		for key, value := range obj.Data {
+			obj.Data[key] = display(value)
+		}
+	}
+}
+
+func secretsByName(manifest edit.Manifest) map[string]map[string]string {
+	secrets := map[string]map[string]string{}
+	for _, obj := range manifest {
+		if obj.Kind == "" {
+			continue
+		}
+		secrets[fmt.Sprintf("%s/%s", obj.Meta.GetNamespace(), obj.Meta.GetName())] = obj.Data
+	}
+	return secrets
+}
+
+func printSecretDiff(out io.Writer, oldManifest edit.Manifest, newManifest edit.Manifest, display func(string) string) {
+	oldSecrets := secretsByName(oldManifest)
+	newSecrets := secretsByName(newManifest)
+	names := []string{}
+	for name := range oldSecrets {
+		names = append(names, name)
+	}
+	for name := range newSecrets {
+		if _, ok := oldSecrets[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changed := false
+	for _, name := range names {
+		oldData := oldSecrets[name]
+		newData := newSecrets[name]
+		keys := []string{}
+		for key := range oldData {
+			keys = append(keys, key)
+		}
+		for key := range newData {
+			if _, ok := oldData[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		header := false
+		for _, key := range keys {
+			oldValue, inOld := oldData[key]
+			newValue, inNew := newData[key]
+			var line string
+			switch {
+			case !inOld:
+				line = fmt.Sprintf("+ %s: %s", key, display(newValue))
+			case !inNew:
+				line = fmt.Sprintf("- %s: %s", key, display(oldValue))
+			case oldValue != newValue:
+				line = fmt.Sprintf("~ %s: %s -> %s", key, display(oldValue), display(newValue))
+			default:
+				continue
+			}
+			if !header {
+				fmt.Fprintf(out, "%s\n", name)
+				header = true
+			}
+			fmt.Fprintf(out, "  %s\n", line)
+			changed = true
+		}
+	}
+	if !changed {
+		fmt.Fprintf(out, "No secret changes\n")
+	}
+}
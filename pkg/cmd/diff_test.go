@@ -0,0 +1,142 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Ridecell/ridectl/pkg/cmd"
+	"github.com/Ridecell/ridectl/pkg/cmd/edit"
+)
+
+var _ = Describe("diff", func() {
+	manifest := func(data string) edit.Manifest {
+		m, err := edit.NewManifest(strings.NewReader(`apiVersion: secrets.ridecell.io/v1beta1
+kind: DecryptedSecret
+metadata:
+  name: summon-qa
+  namespace: summon-qa
+data:
+` + data))
+		Expect(err).ToNot(HaveOccurred())
+		return m
+	}
+	quote := func(value string) string {
+		return fmt.Sprintf("%q", value)
+	}
+
+	Context("printSecretDiff", func() {
+		It("lists added, removed and changed keys", func() {
+			out := &bytes.Buffer{}
+			oldManifest := manifest("  KEEP: same\n  OLD: gone\n  CHANGED: before\n")
+			newManifest := manifest("  KEEP: same\n  NEW: added\n  CHANGED: after\n")
+			cmd.PrintSecretDiff(out, oldManifest, newManifest, quote)
+			Expect(out.String()).To(Equal(`summon-qa/summon-qa
+  ~ CHANGED: "before" -> "after"
+  + NEW: "added"
+  - OLD: "gone"
+`))
+		})
+
+		It("treats a missing manifest as empty", func() {
+			out := &bytes.Buffer{}
+			cmd.PrintSecretDiff(out, edit.Manifest{}, manifest("  KEY: value\n"), quote)
+			Expect(out.String()).To(Equal("summon-qa/summon-qa\n  + KEY: \"value\"\n"))
+		})
+
+		It("reports no changes", func() {
+			out := &bytes.Buffer{}
+			cmd.PrintSecretDiff(out, manifest("  KEY: value\n"), manifest("  KEY: value\n"), quote)
+			Expect(out.String()).To(Equal("No secret changes\n"))
+		})
+	})
+
+	Context("value masks", func() {
+		It("gives the same value the same mask", func() {
+			mask := cmd.NewValueMask([]byte("0123456789abcdef0123456789abcdef"))
+			Expect(mask("hunter2")).To(Equal(mask("hunter2")))
+			Expect(mask("hunter2")).ToNot(Equal(mask("hunter3")))
+			Expect(mask("hunter2")).To(HavePrefix("<masked "))
+			Expect(mask("hunter2")).ToNot(ContainSubstring("hunter2"))
+		})
+
+		It("depends on the key", func() {
+			mask := cmd.NewValueMask([]byte("0123456789abcdef0123456789abcdef"))
+			otherMask := cmd.NewValueMask([]byte("fedcba9876543210fedcba9876543210"))
+			Expect(mask("hunter2")).ToNot(Equal(otherMask("hunter2")))
+		})
+
+		It("masks every value of a manifest", func() {
+			mask := cmd.NewValueMask([]byte("0123456789abcdef0123456789abcdef"))
+			m := manifest("  KEY: hunter2\n")
+			cmd.MaskValues(m, mask)
+			out := &bytes.Buffer{}
+			Expect(m.Serialize(out)).To(Succeed())
+			Expect(out.String()).To(ContainSubstring("KEY: " + mask("hunter2")))
+			Expect(out.String()).ToNot(ContainSubstring("KEY: hunter2"))
+		})
+	})
+
+	Context("loadMaskKey", func() {
+		var home string
+		var oldHome string
+
+		BeforeEach(func() {
+			var err error
+			home, err = ioutil.TempDir("", "ridectl-home")
+			Expect(err).ToNot(HaveOccurred())
+			oldHome = os.Getenv("HOME")
+			os.Setenv("HOME", home)
+			homedir.DisableCache = true
+		})
+
+		AfterEach(func() {
+			os.Setenv("HOME", oldHome)
+			homedir.DisableCache = false
+			os.RemoveAll(home)
+		})
+
+		It("creates a private key once", func() {
+			key, err := cmd.LoadMaskKey()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(key).To(HaveLen(32))
+			info, err := os.Stat(filepath.Join(home, ".ridectl", "mask.key"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+			again, err := cmd.LoadMaskKey()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(again).To(Equal(key))
+		})
+
+		It("rejects a short key", func() {
+			Expect(os.MkdirAll(filepath.Join(home, ".ridectl"), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(home, ".ridectl", "mask.key"), []byte("short"), 0600)).To(Succeed())
+			_, err := cmd.LoadMaskKey()
+			Expect(err).To(MatchError(ContainSubstring("too short")))
+		})
+	})
+})
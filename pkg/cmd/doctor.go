@@ -25,6 +25,7 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/Ridecell/ridectl/pkg/config"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -312,11 +313,14 @@ var doctorTestGoogleDockerLogin = &doctorTest{
 var doctorTestKubectlConfig = &doctorTest{
 	subject: `Kubernetes config`,
 	checkFn: func() bool {
+		ridectlConfig, err := config.Get()
+		if err != nil {
+			return false
+		}
 		var clusterBuf strings.Builder
-		clusters := []string{"ridecell-aws-us-sandbox", "ridecell-aws-us-prod", "ridecell-aws-eu-prod", "ridecell-aws-in-prod"}
 		cmd := exec.Command("kubectl", "config", "get-clusters")
 		cmd.Stdout = &clusterBuf
-		err := cmd.Run()
+		err = cmd.Run()
 		if err != nil {
 			return false
 		}
@@ -330,11 +334,11 @@ var doctorTestKubectlConfig = &doctorTest{
 			return false
 		}
 		contextsOutput := contextBuf.String()
-		for _, cluster := range clusters {
-			if !strings.Contains(clustersOutput, cluster) {
+		for _, cluster := range ridectlConfig.Clusters {
+			if !strings.Contains(clustersOutput, cluster.Name) {
 				return false
 			}
-			if !strings.Contains(contextsOutput, cluster) {
+			if !strings.Contains(contextsOutput, cluster.Name) {
 				return false
 			}
 		}
@@ -343,6 +347,10 @@ var doctorTestKubectlConfig = &doctorTest{
 
 	},
 	fixFn: func() error {
+		ridectlConfig, err := config.Get()
+		if err != nil {
+			return err
+		}
 		yes, err := getUserConfirmation("This will direct you to github, you will need to create a personal github token with only read:org permissions. Continue")
 		if !yes || err != nil {
 			return err
@@ -368,14 +376,12 @@ var doctorTestKubectlConfig = &doctorTest{
 
 		commands := []*exec.Cmd{
 			exec.Command(`kubectl`, `config`, `set-credentials`, `github`, fmt.Sprintf(`--token=%s`, githubToken)),
-			exec.Command(`kubectl`, `config`, `set-cluster`, `ridecell-aws-us-sandbox`, `--server=https://api.us-sandbox.kops.ridecell.io`),
-			exec.Command(`kubectl`, `config`, `set-context`, `ridecell-aws-us-sandbox`, `--cluster=ridecell-aws-us-sandbox`, `--user=github`),
-			exec.Command(`kubectl`, `config`, `set-cluster`, `ridecell-aws-us-prod`, `--server=https://api.us-prod.kops.ridecell.io`),
-			exec.Command(`kubectl`, `config`, `set-context`, `ridecell-aws-us-prod`, `--cluster=ridecell-aws-us-prod`, `--user=github`),
-			exec.Command(`kubectl`, `config`, `set-cluster`, `ridecell-aws-eu-prod`, `--server=https://api.eu-prod.kops.ridecell.io`),
-			exec.Command(`kubectl`, `config`, `set-context`, `ridecell-aws-eu-prod`, `--cluster=ridecell-aws-eu-prod`, `--user=github`),
-			exec.Command(`kubectl`, `config`, `set-cluster`, `ridecell-aws-in-prod`, `--server=https://api.in-prod.kops.ridecell.io`),
-			exec.Command(`kubectl`, `config`, `set-context`, `ridecell-aws-in-prod`, `--cluster=ridecell-aws-in-prod`, `--user=github`),
+		}
+		for _, cluster := range ridectlConfig.Clusters {
+			commands = append(commands,
+				exec.Command(`kubectl`, `config`, `set-cluster`, cluster.Name, fmt.Sprintf(`--server=%s`, cluster.Server)),
+				exec.Command(`kubectl`, `config`, `set-context`, cluster.Name, fmt.Sprintf(`--cluster=%s`, cluster.Name), `--user=github`),
+			)
 		}
 
 		for _, cmd := range commands {
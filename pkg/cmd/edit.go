@@ -29,11 +29,13 @@ import (
 	"strings"
 
 	"github.com/Ridecell/ridectl/pkg/cmd/edit"
+	"github.com/Ridecell/ridectl/pkg/config"
 	"github.com/Ridecell/ridectl/pkg/kubernetes"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/kms"
 	"github.com/manifoldco/promptui"
+	"github.com/mitchellh/go-homedir"
 	"github.com/pkg/errors"
 	"github.com/shurcooL/httpfs/vfsutil"
 	"github.com/spf13/cobra"
@@ -48,6 +50,7 @@ var keyIdFlag string
 var recrypt bool
 
 var whitespaceRegexp *regexp.Regexp
+var instanceNameRegexp *regexp.Regexp
 
 func init() {
 	editCmd.Flags().BoolVarP(&recrypt, "recrypt", "r", false, "(optional) re-encrypts all secrets in file")
@@ -55,6 +58,7 @@ func init() {
 	editCmd.Flags().StringVarP(&keyIdFlag, "key", "k", "", "(optional) KMS key ID to use for encrypting")
 
 	whitespaceRegexp = regexp.MustCompile(`\s+`)
+	instanceNameRegexp = regexp.MustCompile(`^([a-z0-9]+)-([a-z]+)$`)
 }
 
 /*
@@ -62,12 +66,12 @@ func init() {
 An explanation of the overall edit process:
 
 1. The existing file is loaded and parsed.
-2. That parsed data is decrypted using KMS.
+2. That parsed data is decrypted using KMS (or a local NaCl key).
 3. A new YAML document is written to a tempfile with the decrypted data.
 4. The tempfile is opened in $EDITOR.
 5. The tempfile is re-read and parsed.
 6. The old and new data is correlated to match up any objects that exist in both.
-7. The parsed data is encrypted using KMS if the value changed.
+7. The parsed data is encrypted using KMS (or a local NaCl key) if the value changed.
 8. A new YAML document is written to the original file.
 
 */
@@ -95,22 +99,14 @@ var editCmd = &cobra.Command{
 		// Work out which file we are editing.
 		filename := filenameFlag
 		if filename == "" {
-			match := regexp.MustCompile(`^([a-z0-9]+)-([a-z]+)$`).FindStringSubmatch(args[0])
-			if match == nil {
-				return errors.Errorf("unable to parse instance name %s", args[0])
-			}
-
-			filenames, err := filepath.Glob(fmt.Sprintf(`*%s/%s.yml`, match[2], match[1]))
-			if len(filenames) > 1 {
-				return errors.New("found multiple matches for filepath")
-			}
+			var err error
+			filename, err = findManifest(args[0])
 			if err != nil {
 				return err
 			}
 
-			if filenames != nil {
-				filename = filenames[0]
-			} else {
+			if filename == "" {
+				match := instanceNameRegexp.FindStringSubmatch(args[0])
 				// Prompt user for region when creating new file
 				regionPrompt := promptui.Prompt{
 					Label: "Enter region (eu, us, in, etc.)",
@@ -150,18 +146,13 @@ var editCmd = &cobra.Command{
 			return errors.Wrap(err, "error decoding input YAML")
 		}
 
-		// Create a KMS session
-		// TODO error handling for AWS creds
-		sess := session.Must(session.NewSessionWithOptions(session.Options{
-			SharedConfigState: session.SharedConfigEnable,
-			Config: aws.Config{
-				Region: aws.String("us-west-1"),
-			},
-		}))
-		kmsService := kms.New(sess)
+		cipher, err := newCipher()
+		if err != nil {
+			return err
+		}
 
 		// Decrypt all the encrypted secrets.
-		err = inManifest.Decrypt(kmsService)
+		err = inManifest.Decrypt(cipher)
 		if err != nil {
 			return errors.Wrap(err, "error decrypting input manifest")
 		}
@@ -184,7 +175,7 @@ var editCmd = &cobra.Command{
 			}
 		}
 
-		err = afterManifest.Encrypt(kmsService, keyId, keyIdFlag != "" || recrypt, recrypt)
+		err = afterManifest.Encrypt(cipher, keyId, keyIdFlag != "" || recrypt, recrypt)
 		if err != nil {
 			return errors.Wrap(err, "error encrypting after manifest")
 		}
@@ -202,6 +193,57 @@ var editCmd = &cobra.Command{
 	},
 }
 
+// newCipher creates the cipher used to decrypt and encrypt manifests. KMS is
+// used by default, local NaCl keys are read from ~/.ridectl/keys. Without AWS
+// credentials only the local keys can be used.
+func newCipher() (edit.Cipher, error) {
+	ridectlConfig, err := config.Get()
+	if err != nil {
+		return nil, err
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return nil, errors.Wrap(err, "error finding home directory")
+	}
+	keyDir := filepath.Join(home, ".ridectl", "keys")
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+		Config: aws.Config{
+			Region: aws.String(ridectlConfig.KMS.Region),
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating AWS session")
+	}
+	_, err = sess.Config.Credentials.Get()
+	if err != nil {
+		return edit.NewLocalCipher(keyDir, errors.Wrap(err, "unable to load AWS credentials, run ridectl doctor")), nil
+	}
+	return edit.NewCipher(kms.New(sess), keyDir), nil
+}
+
+// findManifest looks for the manifest of an instance under the current
+// directory, returning "" if there isn't one yet.
+func findManifest(instance string) (string, error) {
+	match := instanceNameRegexp.FindStringSubmatch(instance)
+	if match == nil {
+		return "", errors.Errorf("unable to parse instance name %s", instance)
+	}
+
+	filenames, err := filepath.Glob(fmt.Sprintf(`*%s/%s.yml`, match[2], match[1]))
+	if err != nil {
+		return "", err
+	}
+	if len(filenames) > 1 {
+		return "", errors.New("found multiple matches for filepath")
+	}
+	if filenames == nil {
+		return "", nil
+	}
+	return filenames[0], nil
+}
+
 func runEditor(filename string) error {
 	editor := os.Getenv("EDITOR")
 	if editor == "" {
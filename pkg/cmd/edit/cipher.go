@@ -0,0 +1,192 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package edit
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/pkg/errors"
+)
+
+// Cipher is an encryption backend for secret values. Ciphertexts are raw
+// bytes, the base64 encoding used in manifests is handled by Object.
+type Cipher interface {
+	// Encrypt encrypts plaintext with the given key ID.
+	Encrypt(keyId string, plaintext []byte) ([]byte, error)
+	// Decrypt decrypts ciphertext and returns the plaintext along with the ID
+	// of the key that was used to encrypt it.
+	Decrypt(ciphertext []byte) ([]byte, string, error)
+	// CanonicalKeyId resolves a key ID or alias to the form Decrypt reports,
+	// so the two can be compared.
+	CanonicalKeyId(keyId string) (string, error)
+}
+
+type kmsCipher struct {
+	kmsService kmsiface.KMSAPI
+}
+
+// NewKMSCipher returns a Cipher backed by AWS KMS.
+func NewKMSCipher(kmsService kmsiface.KMSAPI) Cipher {
+	return &kmsCipher{kmsService: kmsService}
+}
+
+// This encryption context is used for access control policies.
+func kmsEncryptionContext() map[string]*string {
+	return map[string]*string{
+		"RidecellOperator": aws.String("true"),
+	}
+}
+
+func (c *kmsCipher) Encrypt(keyId string, plaintext []byte) ([]byte, error) {
+	out, err := c.kmsService.Encrypt(&kms.EncryptInput{
+		KeyId:             aws.String(keyId),
+		Plaintext:         plaintext,
+		EncryptionContext: kmsEncryptionContext(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.CiphertextBlob, nil
+}
+
+func (c *kmsCipher) Decrypt(ciphertext []byte) ([]byte, string, error) {
+	out, err := c.kmsService.Decrypt(&kms.DecryptInput{
+		CiphertextBlob:    ciphertext,
+		EncryptionContext: kmsEncryptionContext(),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return out.Plaintext, aws.StringValue(out.KeyId), nil
+}
+
+func (c *kmsCipher) CanonicalKeyId(keyId string) (string, error) {
+	out, err := c.kmsService.DescribeKey(&kms.DescribeKeyInput{KeyId: aws.String(keyId)})
+	if err != nil {
+		return "", errors.Wrapf(err, "error describing KMS key %s", keyId)
+	}
+	return aws.StringValue(out.KeyMetadata.Arn), nil
+}
+
+type multiCipher struct {
+	kms    Cipher
+	kmsErr error
+	nacl   Cipher
+}
+
+// NewCipher returns a Cipher that picks a backend based on the key ID when
+// encrypting and on the ciphertext when decrypting. Key IDs starting with
+// "nacl:" use local NaCl keys from naclKeyDir, everything else goes to KMS.
+func NewCipher(kmsService kmsiface.KMSAPI, naclKeyDir string) Cipher {
+	c := &multiCipher{nacl: NewNaClCipher(naclKeyDir)}
+	if kmsService != nil {
+		c.kms = NewKMSCipher(kmsService)
+	}
+	return c
+}
+
+// NewLocalCipher returns a Cipher with only the local NaCl keys from
+// naclKeyDir, for when KMS can't be used. Using a KMS key fails with kmsErr.
+func NewLocalCipher(naclKeyDir string, kmsErr error) Cipher {
+	return &multiCipher{nacl: NewNaClCipher(naclKeyDir), kmsErr: kmsErr}
+}
+
+func (c *multiCipher) backendFor(useNaCl bool) (Cipher, error) {
+	if useNaCl {
+		return c.nacl, nil
+	}
+	if c.kms == nil {
+		if c.kmsErr != nil {
+			return nil, errors.Wrap(c.kmsErr, "KMS is not available")
+		}
+		return nil, errors.New("KMS is not available")
+	}
+	return c.kms, nil
+}
+
+func (c *multiCipher) Encrypt(keyId string, plaintext []byte) ([]byte, error) {
+	backend, err := c.backendFor(strings.HasPrefix(keyId, NaClKeyPrefix))
+	if err != nil {
+		return nil, err
+	}
+	return backend.Encrypt(keyId, plaintext)
+}
+
+func (c *multiCipher) Decrypt(ciphertext []byte) ([]byte, string, error) {
+	backend, err := c.backendFor(bytes.HasPrefix(ciphertext, naclMagic))
+	if err != nil {
+		return nil, "", err
+	}
+	return backend.Decrypt(ciphertext)
+}
+
+func (c *multiCipher) CanonicalKeyId(keyId string) (string, error) {
+	backend, err := c.backendFor(strings.HasPrefix(keyId, NaClKeyPrefix))
+	if err != nil {
+		return "", err
+	}
+	return backend.CanonicalKeyId(keyId)
+}
+
+// IsEncrypted checks if a base64 encoded value looks like the output of one of
+// the supported ciphers.
+func IsEncrypted(value string) bool {
+	// KMS ciphertexts for symmetric keys all start with the same version bytes.
+	return strings.HasPrefix(value, "AQICAH") || strings.HasPrefix(value, naclEncodedMagic)
+}
+
+// KeyIdCache caches canonical key IDs, since most files share a few keys.
+// Lookups of different keys run in parallel and each key is only resolved
+// once, errors included.
+type KeyIdCache struct {
+	cipher Cipher
+
+	lock sync.Mutex
+	keys map[string]*cachedKeyId
+}
+
+type cachedKeyId struct {
+	once  sync.Once
+	keyId string
+	err   error
+}
+
+// NewKeyIdCache returns a KeyIdCache resolving keys with cipher.
+func NewKeyIdCache(cipher Cipher) *KeyIdCache {
+	return &KeyIdCache{cipher: cipher, keys: map[string]*cachedKeyId{}}
+}
+
+// CanonicalKeyId is Cipher.CanonicalKeyId with caching.
+func (c *KeyIdCache) CanonicalKeyId(keyId string) (string, error) {
+	c.lock.Lock()
+	cached, ok := c.keys[keyId]
+	if !ok {
+		cached = &cachedKeyId{}
+		c.keys[keyId] = cached
+	}
+	c.lock.Unlock()
+
+	cached.once.Do(func() {
+		cached.keyId, cached.err = c.cipher.CanonicalKeyId(keyId)
+	})
+	return cached.keyId, cached.err
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package edit_test
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	"github.com/Ridecell/ridectl/pkg/cmd/edit"
+)
+
+var _ = Describe("Cipher", func() {
+	var keyDir string
+
+	BeforeEach(func() {
+		var err error
+		keyDir, err = ioutil.TempDir("", "ridectl-keys")
+		Expect(err).ToNot(HaveOccurred())
+		key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+		err = ioutil.WriteFile(filepath.Join(keyDir, "dev.key"), []byte(key+"\n"), 0600)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(keyDir)
+	})
+
+	Context("with the NaCl cipher", func() {
+		It("round trips a value", func() {
+			cipher := edit.NewNaClCipher(keyDir)
+			ciphertext, err := cipher.Encrypt("nacl:dev", []byte("myvalue"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(edit.IsEncrypted(base64.StdEncoding.EncodeToString(ciphertext))).To(BeTrue())
+			plaintext, keyId, err := cipher.Decrypt(ciphertext)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(plaintext)).To(Equal("myvalue"))
+			Expect(keyId).To(Equal("nacl:dev"))
+		})
+
+		It("fails with a missing key", func() {
+			cipher := edit.NewNaClCipher(keyDir)
+			_, err := cipher.Encrypt("nacl:other", []byte("myvalue"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects tampered ciphertexts", func() {
+			cipher := edit.NewNaClCipher(keyDir)
+			ciphertext, err := cipher.Encrypt("nacl:dev", []byte("myvalue"))
+			Expect(err).ToNot(HaveOccurred())
+			ciphertext[len(ciphertext)-1] ^= 0xff
+			_, _, err = cipher.Decrypt(ciphertext)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("with the combined cipher", func() {
+		It("dispatches on the key ID and ciphertext", func() {
+			cipher := edit.NewCipher(kmsMock(), keyDir)
+			naclValue, err := cipher.Encrypt("nacl:dev", []byte("one"))
+			Expect(err).ToNot(HaveOccurred())
+			kmsValue, err := cipher.Encrypt("12345", []byte("two"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(kmsValue)).To(Equal("kmstwo"))
+
+			plaintext, keyId, err := cipher.Decrypt(naclValue)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(plaintext)).To(Equal("one"))
+			Expect(keyId).To(Equal("nacl:dev"))
+			plaintext, keyId, err = cipher.Decrypt(kmsValue)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(plaintext)).To(Equal("two"))
+			Expect(keyId).To(Equal("12345"))
+		})
+
+		It("resolves canonical key IDs", func() {
+			cipher := edit.NewCipher(kmsMock(), keyDir)
+			keyId, err := cipher.CanonicalKeyId("nacl:dev")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keyId).To(Equal("nacl:dev"))
+			keyId, err = cipher.CanonicalKeyId("alias/foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keyId).To(Equal("arn:aws:kms:us-west-1:1:key/alias/foo"))
+		})
+
+		It("works without KMS for NaCl keys", func() {
+			cipher := edit.NewCipher(nil, keyDir)
+			_, err := cipher.Encrypt("nacl:dev", []byte("one"))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = cipher.Encrypt("12345", []byte("two"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("explains why KMS is not available", func() {
+			cipher := edit.NewLocalCipher(keyDir, errors.New("no credentials"))
+			_, err := cipher.Encrypt("nacl:dev", []byte("one"))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = cipher.Encrypt("12345", []byte("two"))
+			Expect(err).To(MatchError("KMS is not available: no credentials"))
+		})
+
+		It("encrypts and decrypts a manifest", func() {
+			decrypted := `apiVersion: secrets.ridecell.io/v1beta1
+kind: DecryptedSecret
+metadata:
+  name: local
+  namespace: default
+data:
+  KEY: val
+`
+			cipher := edit.NewCipher(nil, keyDir)
+			m, err := edit.NewManifest(strings.NewReader(decrypted))
+			Expect(err).ToNot(HaveOccurred())
+			err = m.Encrypt(cipher, "nacl:dev", false, false)
+			Expect(err).ToNot(HaveOccurred())
+			var buf strings.Builder
+			err = m.Serialize(&buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("kind: EncryptedSecret"))
+
+			m, err = edit.NewManifest(strings.NewReader(buf.String()))
+			Expect(err).ToNot(HaveOccurred())
+			err = m.Decrypt(cipher)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(m[0].KeyId).To(Equal("nacl:dev"))
+			buf.Reset()
+			err = m.Serialize(&buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.String()).To(Equal(decrypted))
+		})
+	})
+
+	Context("with a key ID cache", func() {
+		It("resolves each key once", func() {
+			var calls int32
+			mock := kmsMock()
+			describeKey := mock.DescribeKeyFunc
+			mock.DescribeKeyFunc = func(in *kms.DescribeKeyInput) (*kms.DescribeKeyOutput, error) {
+				atomic.AddInt32(&calls, 1)
+				return describeKey(in)
+			}
+			cache := edit.NewKeyIdCache(edit.NewKMSCipher(mock))
+
+			wg := sync.WaitGroup{}
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					keyId, err := cache.CanonicalKeyId("alias/foo")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(keyId).To(Equal("arn:aws:kms:us-west-1:1:key/alias/foo"))
+				}()
+			}
+			wg.Wait()
+			Expect(atomic.LoadInt32(&calls)).To(Equal(int32(1)))
+		})
+
+		It("resolves other keys while one is in progress", func() {
+			started := make(chan struct{})
+			release := make(chan struct{})
+			mock := kmsMock()
+			describeKey := mock.DescribeKeyFunc
+			mock.DescribeKeyFunc = func(in *kms.DescribeKeyInput) (*kms.DescribeKeyOutput, error) {
+				if aws.StringValue(in.KeyId) == "alias/slow" {
+					close(started)
+					<-release
+				}
+				return describeKey(in)
+			}
+			cache := edit.NewKeyIdCache(edit.NewKMSCipher(mock))
+
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				_, err := cache.CanonicalKeyId("alias/slow")
+				Expect(err).ToNot(HaveOccurred())
+			}()
+			<-started
+			keyId, err := cache.CanonicalKeyId("alias/fast")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keyId).To(Equal("arn:aws:kms:us-west-1:1:key/alias/fast"))
+			close(release)
+			<-done
+		})
+	})
+})
@@ -29,6 +29,7 @@ import (
 	"k8s.io/client-go/kubernetes/scheme"
 
 	hackapis "github.com/Ridecell/ridectl/pkg/apis"
+	"github.com/Ridecell/ridectl/pkg/cmd/edit"
 )
 
 // Sed is a workaround for https://github.com/matryer/moq/issues/86.
@@ -49,9 +50,18 @@ func kmsMock() *KMSAPIMock {
 				CiphertextBlob: append([]byte("kms"), in.Plaintext...),
 			}, nil
 		},
+		DescribeKeyFunc: func(in *kms.DescribeKeyInput) (*kms.DescribeKeyOutput, error) {
+			return &kms.DescribeKeyOutput{
+				KeyMetadata: &kms.KeyMetadata{Arn: aws.String("arn:aws:kms:us-west-1:1:key/" + aws.StringValue(in.KeyId))},
+			}, nil
+		},
 	}
 }
 
+func kmsCipher() edit.Cipher {
+	return edit.NewKMSCipher(kmsMock())
+}
+
 func TestEdit(t *testing.T) {
 	// Register all types from ridecell-operator.
 	apis.AddToScheme(scheme.Scheme)
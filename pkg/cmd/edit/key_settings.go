@@ -24,6 +24,10 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+// FindKeyId looks up the key ID for a manifest from the .keys.yml next to it.
+// Keys in that file are filename patterns and values are key IDs, so a value
+// like "nacl:dev" selects the local NaCl backend for matching files while
+// KMS key IDs and aliases use KMS.
 func FindKeyId(manifestPath string) (string, error) {
 	keysPath := path.Join(manifestPath, "..", ".keys.yml")
 	keysF, err := os.Open(keysPath)
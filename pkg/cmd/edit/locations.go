@@ -0,0 +1,343 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package edit
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// The YAML node tree gives us where each node starts but not where it ends,
+// so this file turns node positions into byte ranges of the raw text. Only
+// those ranges get rewritten when serializing, everything else (comments,
+// ordering, whitespace, styles of untouched values) is copied through as is.
+
+// sourceText wraps the raw text with a line index for converting positions.
+type sourceText struct {
+	raw        []byte
+	lineStarts []int
+}
+
+func newSourceText(raw []byte) *sourceText {
+	s := &sourceText{raw: raw, lineStarts: []int{0}}
+	for i, c := range raw {
+		if c == '\n' {
+			s.lineStarts = append(s.lineStarts, i+1)
+		}
+	}
+	return s
+}
+
+// offset converts a node's 1-based line and column (counted in characters) to
+// a byte offset.
+func (s *sourceText) offset(node *yaml.Node) (int, error) {
+	if node.Line < 1 || node.Line > len(s.lineStarts) {
+		return 0, errors.Errorf("line %d out of range", node.Line)
+	}
+	pos := s.lineStarts[node.Line-1]
+	for i := 1; i < node.Column; i++ {
+		if pos >= len(s.raw) || s.raw[pos] == '\n' {
+			return 0, errors.Errorf("column %d out of range on line %d", node.Column, node.Line)
+		}
+		_, size := utf8.DecodeRune(s.raw[pos:])
+		pos += size
+	}
+	return pos, nil
+}
+
+func (s *sourceText) lineStart(pos int) int {
+	return bytes.LastIndexByte(s.raw[:pos], '\n') + 1
+}
+
+func (s *sourceText) lineEnd(pos int) int {
+	i := bytes.IndexByte(s.raw[pos:], '\n')
+	if i == -1 {
+		return len(s.raw)
+	}
+	return pos + i
+}
+
+// indentOf counts the leading spaces of the line starting at pos.
+func (s *sourceText) indentOf(pos int) int {
+	n := 0
+	for pos+n < len(s.raw) && s.raw[pos+n] == ' ' {
+		n++
+	}
+	return n
+}
+
+// isBlank checks if the line starting at pos is only whitespace.
+func (s *sourceText) isBlank(pos int) bool {
+	return len(bytes.TrimSpace(s.raw[pos:s.lineEnd(pos)])) == 0
+}
+
+// skipProperties moves past any anchor or tag in front of a node's content.
+func (s *sourceText) skipProperties(pos int) int {
+	for pos < len(s.raw) && (s.raw[pos] == '&' || s.raw[pos] == '!') {
+		for pos < len(s.raw) && !isSpace(s.raw[pos]) {
+			pos++
+		}
+		for pos < len(s.raw) && isSpace(s.raw[pos]) {
+			pos++
+		}
+	}
+	return pos
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// nodeRange finds the byte range of a scalar or alias node. parentIndent is
+// the indentation of the mapping holding the node, which bounds block and
+// multi-line plain scalars.
+func (s *sourceText) nodeRange(node *yaml.Node, parentIndent int, flow bool) (TextLocation, error) {
+	start, err := s.offset(node)
+	if err != nil {
+		return TextLocation{}, err
+	}
+	if node.Kind == yaml.AliasNode {
+		return TextLocation{Start: start, End: start + 1 + len(node.Value)}, nil
+	}
+	if node.Kind != yaml.ScalarNode {
+		return TextLocation{}, errors.Errorf("line %d: expected a string value", node.Line)
+	}
+	if node.Tag == "!!null" && node.Value == "" && node.Style == 0 {
+		// An empty value has no text, it's positioned right after the colon.
+		return TextLocation{Start: start, End: start}, nil
+	}
+	start = s.skipProperties(start)
+	if start >= len(s.raw) {
+		return TextLocation{}, errors.Errorf("line %d: unexpected end of input", node.Line)
+	}
+
+	var end int
+	switch s.raw[start] {
+	case '"':
+		end, err = s.doubleQuotedEnd(start)
+	case '\'':
+		end, err = s.singleQuotedEnd(start)
+	case '|', '>':
+		if flow {
+			return TextLocation{}, errors.Errorf("line %d: block scalar in flow context", node.Line)
+		}
+		end = s.blockEnd(start, parentIndent)
+	default:
+		end = s.plainEnd(start, parentIndent, flow)
+	}
+	if err != nil {
+		return TextLocation{}, errors.Wrapf(err, "line %d", node.Line)
+	}
+	return TextLocation{Start: start, End: end}, nil
+}
+
+func (s *sourceText) doubleQuotedEnd(start int) (int, error) {
+	for i := start + 1; i < len(s.raw); i++ {
+		switch s.raw[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, nil
+		}
+	}
+	return 0, errors.New("unterminated double quoted string")
+}
+
+func (s *sourceText) singleQuotedEnd(start int) (int, error) {
+	for i := start + 1; i < len(s.raw); i++ {
+		if s.raw[i] == '\'' {
+			if i+1 < len(s.raw) && s.raw[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1, nil
+		}
+	}
+	return 0, errors.New("unterminated single quoted string")
+}
+
+// blockEnd finds the end of a literal or folded scalar, which runs until the
+// first non-blank line that isn't indented past the parent.
+func (s *sourceText) blockEnd(start int, parentIndent int) int {
+	header := s.raw[start:s.lineEnd(start)]
+	keep := bytes.IndexByte(header, '+') != -1
+	end := s.lineEnd(start)
+	pos := end + 1
+	for pos < len(s.raw) {
+		lineEnd := s.lineEnd(pos)
+		if s.isBlank(pos) {
+			if keep {
+				end = lineEnd
+			}
+		} else if s.indentOf(pos) > parentIndent {
+			end = lineEnd
+		} else {
+			break
+		}
+		pos = lineEnd + 1
+	}
+	return end
+}
+
+// plainEnd finds the end of an unquoted scalar. In block context it can
+// continue on following lines that are indented past the parent.
+func (s *sourceText) plainEnd(start int, parentIndent int, flow bool) int {
+	end := s.plainLineEnd(start, flow)
+	if flow || end < s.lineEnd(start) {
+		// Something else follows on the same line, so no continuation.
+		return end
+	}
+	pos := s.lineEnd(start) + 1
+	for pos < len(s.raw) {
+		lineEnd := s.lineEnd(pos)
+		if s.isBlank(pos) {
+			pos = lineEnd + 1
+			continue
+		}
+		indent := s.indentOf(pos)
+		if indent <= parentIndent || s.raw[pos+indent] == '#' {
+			break
+		}
+		end = s.plainLineEnd(pos+indent, flow)
+		if end < lineEnd {
+			break
+		}
+		pos = lineEnd + 1
+	}
+	return end
+}
+
+// plainLineEnd scans one line of a plain scalar, stopping at a comment, a
+// mapping indicator or, in flow context, a flow indicator.
+func (s *sourceText) plainLineEnd(pos int, flow bool) int {
+	lineEnd := s.lineEnd(pos)
+	end := pos
+	for i := pos; i < lineEnd; i++ {
+		c := s.raw[i]
+		if c == '#' && i > pos && isSpace(s.raw[i-1]) {
+			break
+		}
+		if c == ':' && (i+1 == lineEnd || isSpace(s.raw[i+1]) || (flow && strings.IndexByte(",[]{}", s.raw[i+1]) != -1)) {
+			break
+		}
+		if flow && strings.IndexByte(",[]{}", c) != -1 {
+			break
+		}
+		if !isSpace(c) {
+			end = i + 1
+		}
+	}
+	return end
+}
+
+// flowMappingEnd finds the closing brace of a flow mapping, starting from the
+// end of its last entry.
+func (s *sourceText) flowMappingEnd(pos int) (int, error) {
+	for i := pos; i < len(s.raw); i++ {
+		switch s.raw[i] {
+		case '}':
+			return i + 1, nil
+		case '#':
+			i = s.lineEnd(i)
+		case ' ', '\t', '\r', '\n', ',':
+		default:
+			return 0, errors.Errorf("unexpected %q in flow mapping", s.raw[i])
+		}
+	}
+	return 0, errors.New("unterminated flow mapping")
+}
+
+// mappingValue looks up a key in a mapping node.
+func mappingValue(mapping *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i], mapping.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// renderScalar writes a value as YAML, using a literal block scalar for
+// multi-line values where allowed and double quotes when a plain scalar would
+// be read back as something else.
+func renderScalar(value string, indent int, step int, flow bool) string {
+	if !flow && isLiteralSafe(value) {
+		return renderLiteral(value, indent+step, step)
+	}
+	if isPlainSafe(value, flow) {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+func isPlainSafe(value string, flow bool) bool {
+	if flow && strings.ContainsAny(value, ",[]{}") {
+		return false
+	}
+	out, err := yaml.Marshal(value)
+	return err == nil && string(out) == value+"\n"
+}
+
+func isLiteralSafe(value string) bool {
+	if !strings.Contains(value, "\n") || strings.Trim(value, "\n") == "" {
+		return false
+	}
+	for _, line := range strings.Split(value, "\n") {
+		if line != "" && strings.TrimSpace(line) == "" {
+			// Whitespace only lines get mixed up with indentation.
+			return false
+		}
+	}
+	for _, r := range value {
+		if r != '\n' && r != '\t' && (r < ' ' || r == 0x7f || r == utf8.RuneError) {
+			return false
+		}
+	}
+	return true
+}
+
+func renderLiteral(value string, indent int, step int) string {
+	var buf strings.Builder
+	buf.WriteString("|")
+	if strings.HasPrefix(strings.TrimLeft(value, "\n"), " ") {
+		// Leading spaces would be taken as indentation.
+		buf.WriteString(strconv.Itoa(step))
+	}
+	switch {
+	case strings.HasSuffix(value, "\n\n"):
+		buf.WriteString("+")
+		value = strings.TrimSuffix(value, "\n")
+	case strings.HasSuffix(value, "\n"):
+		value = strings.TrimSuffix(value, "\n")
+	default:
+		buf.WriteString("-")
+	}
+	prefix := strings.Repeat(" ", indent)
+	for _, line := range strings.Split(value, "\n") {
+		buf.WriteString("\n")
+		if line != "" {
+			buf.WriteString(prefix)
+			buf.WriteString(line)
+		}
+	}
+	return buf.String()
+}
@@ -22,7 +22,6 @@ import (
 	"io"
 	"regexp"
 
-	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
 	"github.com/pkg/errors"
 )
 
@@ -42,8 +41,15 @@ func NewManifest(in io.Reader) (Manifest, error) {
 		return nil, errors.Wrap(err, "error reading manifest")
 	}
 
+	// Same as splitting on the separators, but keeping track of the offsets.
+	text := buf.String()
+	separators := append(splitRegexp.FindAllStringIndex(text, -1), []int{len(text), len(text)})
 	objects := []*Object{}
-	for _, chunk := range splitRegexp.Split(buf.String(), -1) {
+	start := 0
+	for _, separator := range separators {
+		chunk := text[start:separator[0]]
+		offset := start
+		start = separator[1]
 		if emptyRegexp.MatchString(chunk) {
 			continue
 		}
@@ -51,14 +57,15 @@ func NewManifest(in io.Reader) (Manifest, error) {
 		if err != nil {
 			return nil, errors.Wrap(err, "error decoding object")
 		}
+		obj.Offset = offset
 		objects = append(objects, obj)
 	}
 	return objects, nil
 }
 
-func (m Manifest) Decrypt(kmsService kmsiface.KMSAPI) error {
+func (m Manifest) Decrypt(cipher Cipher) error {
 	for _, obj := range m {
-		err := obj.Decrypt(kmsService)
+		err := obj.Decrypt(cipher)
 		if err != nil {
 			return errors.Wrapf(err, "error decrypting %s/%s", obj.Meta.GetNamespace(), obj.Meta.GetName())
 		}
@@ -66,9 +73,9 @@ func (m Manifest) Decrypt(kmsService kmsiface.KMSAPI) error {
 	return nil
 }
 
-func (m Manifest) Encrypt(kmsService kmsiface.KMSAPI, defaultKeyId string, forceKeyId bool, reEncrypt bool) error {
+func (m Manifest) Encrypt(cipher Cipher, defaultKeyId string, forceKeyId bool, reEncrypt bool) error {
 	for _, obj := range m {
-		err := obj.Encrypt(kmsService, defaultKeyId, forceKeyId, reEncrypt)
+		err := obj.Encrypt(cipher, defaultKeyId, forceKeyId, reEncrypt)
 		if err != nil {
 			return errors.Wrapf(err, "error encrypting %s/%s", obj.Meta.GetNamespace(), obj.Meta.GetName())
 		}
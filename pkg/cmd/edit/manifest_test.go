@@ -97,7 +97,7 @@ data:
 		It("encrypts and serializes correctly", func() {
 			m, err := edit.NewManifest(strings.NewReader(decrypted))
 			Expect(err).ToNot(HaveOccurred())
-			err = m.Encrypt(kmsMock(), "12345", false, false)
+			err = m.Encrypt(kmsCipher(), "12345", false, false)
 			Expect(err).ToNot(HaveOccurred())
 			var buf strings.Builder
 			err = m.Serialize(&buf)
@@ -115,6 +115,13 @@ data:
 			Expect(m[1].Meta.GetName()).To(Equal("mixedstuff"))
 		})
 
+		It("records where each object starts", func() {
+			m, err := edit.NewManifest(strings.NewReader("---\n" + encrypted))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(m[0].Offset).To(Equal(4))
+			Expect(strings.HasPrefix(("---\n" + encrypted)[m[1].Offset:], "apiVersion")).To(BeTrue())
+		})
+
 		It("re-serializes correctly", func() {
 			m, err := edit.NewManifest(strings.NewReader(encrypted))
 			Expect(err).ToNot(HaveOccurred())
@@ -127,7 +134,7 @@ data:
 		It("decrypts and serializes correctly", func() {
 			m, err := edit.NewManifest(strings.NewReader(encrypted))
 			Expect(err).ToNot(HaveOccurred())
-			err = m.Decrypt(kmsMock())
+			err = m.Decrypt(kmsCipher())
 			Expect(err).ToNot(HaveOccurred())
 			var buf strings.Builder
 			err = m.Serialize(&buf)
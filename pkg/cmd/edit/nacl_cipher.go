@@ -0,0 +1,124 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package edit
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// NaClKeyPrefix marks a key ID as a local NaCl key, e.g. "nacl:dev".
+const NaClKeyPrefix = "nacl:"
+
+const naclNonceSize = 24
+const naclKeySize = 32
+
+// Six bytes so the base64 encoding is a stable prefix.
+var naclMagic = []byte("RCNACL")
+var naclEncodedMagic = base64.StdEncoding.EncodeToString(naclMagic)
+var naclKeyNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+type naclCipher struct {
+	keyDir string
+}
+
+// NewNaClCipher returns a Cipher using NaCl secretbox keys stored in keyDir.
+// A key named "dev" is read from <keyDir>/dev.key, which must contain 32
+// random bytes encoded as base64. This is meant for air-gapped development
+// setups where KMS isn't reachable.
+func NewNaClCipher(keyDir string) Cipher {
+	return &naclCipher{keyDir: keyDir}
+}
+
+func (c *naclCipher) loadKey(name string) (*[naclKeySize]byte, error) {
+	if !naclKeyNameRegexp.MatchString(name) {
+		return nil, errors.Errorf("invalid NaCl key name %q", name)
+	}
+	keyPath := filepath.Join(c.keyDir, name+".key")
+	encoded, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading NaCl key %s", keyPath)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error decoding NaCl key %s", keyPath)
+	}
+	if len(raw) != naclKeySize {
+		return nil, errors.Errorf("NaCl key %s must be %d bytes, got %d", keyPath, naclKeySize, len(raw))
+	}
+	key := [naclKeySize]byte{}
+	copy(key[:], raw)
+	return &key, nil
+}
+
+// Ciphertext layout: magic, key name length, key name, nonce, sealed box.
+func (c *naclCipher) Encrypt(keyId string, plaintext []byte) ([]byte, error) {
+	name := strings.TrimPrefix(keyId, NaClKeyPrefix)
+	key, err := c.loadKey(name)
+	if err != nil {
+		return nil, err
+	}
+	nonce := [naclNonceSize]byte{}
+	_, err = io.ReadFull(rand.Reader, nonce[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating nonce")
+	}
+
+	out := bytes.Buffer{}
+	out.Write(naclMagic)
+	out.WriteByte(byte(len(name)))
+	out.WriteString(name)
+	out.Write(nonce[:])
+	return secretbox.Seal(out.Bytes(), plaintext, &nonce, key), nil
+}
+
+func (c *naclCipher) Decrypt(ciphertext []byte) ([]byte, string, error) {
+	if !bytes.HasPrefix(ciphertext, naclMagic) {
+		return nil, "", errors.New("not a NaCl ciphertext")
+	}
+	rest := ciphertext[len(naclMagic):]
+	if len(rest) < 1 || len(rest) < 1+int(rest[0])+naclNonceSize {
+		return nil, "", errors.New("NaCl ciphertext is truncated")
+	}
+	name := string(rest[1 : 1+int(rest[0])])
+	rest = rest[1+int(rest[0]):]
+	nonce := [naclNonceSize]byte{}
+	copy(nonce[:], rest[:naclNonceSize])
+
+	key, err := c.loadKey(name)
+	if err != nil {
+		return nil, "", err
+	}
+	plaintext, ok := secretbox.Open(nil, rest[naclNonceSize:], &nonce, key)
+	if !ok {
+		return nil, "", errors.Errorf("unable to decrypt with NaCl key %s", name)
+	}
+	return plaintext, NaClKeyPrefix + name, nil
+}
+
+func (c *naclCipher) CanonicalKeyId(keyId string) (string, error) {
+	return NaClKeyPrefix + strings.TrimPrefix(keyId, NaClKeyPrefix), nil
+}
@@ -17,51 +17,28 @@ limitations under the License.
 package edit
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
 	"io"
 	"regexp"
+	"sort"
 	"strings"
 
 	secretsv1beta1 "github.com/Ridecell/ridecell-operator/pkg/apis/secrets/v1beta1"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/kms"
-	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 
 	hacksecretsv1beta1 "github.com/Ridecell/ridectl/pkg/apis/secrets/v1beta1"
 )
 
-var dataRegexp *regexp.Regexp
-var keyRegexp *regexp.Regexp
-var nonStringRegexp *regexp.Regexp
+var secretKeyRegexp *regexp.Regexp
 
 func init() {
-	dataRegexp = regexp.MustCompile(`(?ms)kind: (EncryptedSecret|DecryptedSecret).*?(^data:.*?)\z`)
-	keyRegexp = regexp.MustCompile("" +
-		// Turn on multiline mode for the whole pattern, ^ and $ will match on lines rather than start and end of whole string.
-		`(?m)` +
-		// Look for the key, some whitespace, then some non-space-or-:, then :
-		`^[ \t]+([^:\n\r]+):` +
-		// Whitespace between the key's : and the value
-		`[ \t]+` +
-		// Start an alternation for block scalars and normal values.
-		`(?:` +
-		// Match block scalars first because they would otherwise match the normal value pattern.
-		// Looks for the | or >, optional flags, then lines with 4 spaces of indentation. A better version of this
-		// would look more like ([|>]\n([ \t]+).+?\n(?:\3.+?\n)*) and would use a backreference instead of hardwiring
-		// things but Go, or rather RE2, refuses to support backrefs because they can be slow. Blaaaaaaah.
-		`([|>].*?(?:\n    .+?$)+)` +
-		// Alternation between block scalar and normal values.
-		`|` +
-		// Look for a normal value, something on a single line with optional trailing whitespace.
-		`(.+?)[ \t]*$` +
-		// Close the block vs. normal alternation.
-		`)`,
-	)
-	nonStringRegexp = regexp.MustCompile(`^(\d+(\.\d+)?|true|false|null|\[.*\]|)$`)
+	// Same rules as keys in a Kubernetes Secret.
+	secretKeyRegexp = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
 }
 
 func NewObject(raw []byte) (*Object, error) {
@@ -91,109 +68,350 @@ func NewObject(raw []byte) (*Object, error) {
 	}
 
 	if o.Kind != "" {
-		// Run the regex parse. If you are reading this code, I am sorry and yes I
-		// feel bad about it. This is used when re-encoding to allow output that
-		// preserves comments, whitespace, key ordering, etc.
-		match := dataRegexp.FindSubmatchIndex(raw)
-		if match == nil {
-			// This shouldn't happen.
-			panic("EncryptedSecret or DecryptedSecret didn't match dataRegexp")
+		err = o.findLocations()
+		if err != nil {
+			return nil, errors.Wrap(err, "error locating secret data")
+		}
+	}
+	return o, nil
+}
+
+// findLocations walks the YAML node tree to find the byte ranges of the kind
+// and the secret values, so Serialize can rewrite just those.
+func (o *Object) findLocations() error {
+	doc := yaml.Node{}
+	err := yaml.Unmarshal(o.Raw, &doc)
+	if err != nil {
+		return err
+	}
+	if len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return errors.New("expected a mapping at the top level")
+	}
+	root := doc.Content[0]
+	src := newSourceText(o.Raw)
+
+	o.KindLoc = TextLocation{}
+	o.DataLoc = TextLocation{}
+	o.KeyLocs = nil
+	o.dataFlow = false
+	o.dataIndent = 0
+	o.indentStep = 2
+
+	_, kindNode := mappingValue(root, "kind")
+	if kindNode == nil {
+		return errors.New("kind not found")
+	}
+	o.KindLoc, err = src.nodeRange(kindNode, root.Column-1, root.Style == yaml.FlowStyle)
+	if err != nil {
+		return err
+	}
+
+	dataKey, dataNode := mappingValue(root, "data")
+	if dataKey == nil {
+		if len(o.Data) != 0 {
+			return errors.New("data not found")
 		}
-		// match[0] and [1] are for the whole regexp, we don't need that.
-		o.KindLoc.Start = match[2]
-		o.KindLoc.End = match[3]
-		o.DataLoc.Start = match[4]
-		o.DataLoc.End = match[5]
-		if len(o.Data) > 0 {
-			locs, err := newKeysLocations(raw[o.DataLoc.Start:o.DataLoc.End], o.DataLoc.Start)
+		return nil
+	}
+	dataKeyLoc, err := src.nodeRange(dataKey, root.Column-1, false)
+	if err != nil {
+		return err
+	}
+	o.DataLoc.Start = dataKeyLoc.Start
+	if dataNode.Kind == yaml.ScalarNode && dataNode.Tag == "!!null" {
+		// Empty data, nothing else to find.
+		o.dataIndent = dataKey.Column - 1 + o.indentStep
+		o.DataLoc.End = bytes.IndexByte(o.Raw[dataKeyLoc.End:], ':') + dataKeyLoc.End + 1
+		if dataNode.Line == dataKey.Line && dataNode.Value != "" {
+			nullLoc, err := src.nodeRange(dataNode, root.Column-1, false)
 			if err != nil {
-				// Also shouldn't happen.
-				panic(err.Error())
+				return err
 			}
-			o.KeyLocs = locs
+			o.DataLoc.End = nullLoc.End
+		}
+		return nil
+	}
+	if dataNode.Kind != yaml.MappingNode {
+		return errors.Errorf("line %d: data must be a mapping", dataNode.Line)
+	}
+	o.dataFlow = dataNode.Style == yaml.FlowStyle
+	o.dataIndent = dataNode.Column - 1
+	if !o.dataFlow && o.dataIndent > dataKey.Column-1 {
+		o.indentStep = o.dataIndent - (dataKey.Column - 1)
+	}
+	if o.dataFlow {
+		// Anything new goes in as a block mapping.
+		o.dataIndent = dataKey.Column - 1 + o.indentStep
+	}
+
+	for i := 0; i+1 < len(dataNode.Content); i += 2 {
+		keyNode := dataNode.Content[i]
+		valueNode := dataNode.Content[i+1]
+		if keyNode.Kind != yaml.ScalarNode {
+			return errors.Errorf("line %d: data keys must be strings", keyNode.Line)
+		}
+		keyLoc, err := src.nodeRange(keyNode, o.dataIndent, o.dataFlow)
+		if err != nil {
+			return err
+		}
+		valueLoc, err := src.nodeRange(valueNode, o.dataIndent, o.dataFlow)
+		if err != nil {
+			return err
+		}
+		value := valueNode.Value
+		if valueNode.Kind == yaml.AliasNode && valueNode.Alias != nil {
+			value = valueNode.Alias.Value
 		}
 
-		// A safety check for now.
-		if len(o.Data) != len(o.KeyLocs) {
-			panic("key count mismatch")
+		entry := TextLocation{Start: keyLoc.Start, End: valueLoc.End}
+		if !o.dataFlow {
+			// Take whole lines so trailing comments go along with the entry.
+			entry.Start = src.lineStart(keyLoc.Start)
+			entry.End = src.lineEnd(valueLoc.End)
 		}
+		o.KeyLocs = append(o.KeyLocs, KeysLocation{TextLocation: valueLoc, Key: keyNode.Value, Value: value, Entry: entry})
 	}
-	return o, nil
-}
 
-func newKeysLocations(raw []byte, offset int) ([]KeysLocation, error) {
-	matches := keyRegexp.FindAllSubmatchIndex(raw, -1)
-	if matches == nil {
-		return nil, errors.New("unable to parse keys")
-	}
-	locs := []KeysLocation{}
-	for _, match := range matches {
-		keyStart := match[2]
-		keyEnd := match[3]
-		blockValueStart := match[4]
-		blockValueEnd := match[5]
-		normalValueStart := match[6]
-		normalValueEnd := match[7]
-		var valueLoc TextLocation
-		if normalValueStart == -1 {
-			if raw[blockValueStart] != '|' {
-				return nil, errors.New("only | block scalars are supported")
-			}
-			valueLoc.Start = blockValueStart + offset
-			valueLoc.End = blockValueEnd + offset
+	if o.dataFlow {
+		start := o.DataLoc.Start
+		if len(o.KeyLocs) > 0 {
+			start = o.KeyLocs[len(o.KeyLocs)-1].End
 		} else {
-			valueLoc.Start = normalValueStart + offset
-			valueLoc.End = normalValueEnd + offset
+			flowStart, err := src.offset(dataNode)
+			if err != nil {
+				return err
+			}
+			start = flowStart + 1
 		}
-		key := string(raw[keyStart:keyEnd])
-		if key[0] == '#' {
-			// Go doesn't do negative lookaheads to easier to filter comments out here.
-			continue
+		o.DataLoc.End, err = src.flowMappingEnd(start)
+		if err != nil {
+			return err
+		}
+	} else {
+		o.DataLoc.End = o.KeyLocs[len(o.KeyLocs)-1].End
+	}
+
+	if len(o.Data) != len(o.KeyLocs) {
+		return errors.Errorf("found %d keys in data but decoded %d, merge keys and duplicates are not supported", len(o.KeyLocs), len(o.Data))
+	}
+	return nil
+}
+
+// FieldLine returns the line in Raw of a field, like metadata.name with
+// FieldLine("metadata", "name"), or 0 if it isn't there.
+func (o *Object) FieldLine(path ...string) int {
+	key, _, _, err := o.findField(path)
+	if err != nil {
+		return 0
+	}
+	return key.Line
+}
+
+// FieldLocation finds the byte range in Raw of a string field's value, so it
+// can be replaced without touching the rest of the text.
+func (o *Object) FieldLocation(path ...string) (TextLocation, error) {
+	_, value, parent, err := o.findField(path)
+	if err != nil {
+		return TextLocation{}, err
+	}
+	return newSourceText(o.Raw).nodeRange(value, parent.Column-1, parent.Style == yaml.FlowStyle)
+}
+
+// findField walks down mappings to a field, returning its key and value
+// nodes and the mapping holding them.
+func (o *Object) findField(path []string) (*yaml.Node, *yaml.Node, *yaml.Node, error) {
+	if len(path) == 0 {
+		return nil, nil, nil, errors.New("empty field path")
+	}
+	doc := yaml.Node{}
+	err := yaml.Unmarshal(o.Raw, &doc)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(doc.Content) != 1 {
+		return nil, nil, nil, errors.New("expected a single document")
+	}
+	var key *yaml.Node
+	var parent *yaml.Node
+	node := doc.Content[0]
+	for i, name := range path {
+		if node.Kind != yaml.MappingNode {
+			return nil, nil, nil, errors.Errorf("%s is not a mapping", strings.Join(path[:i], "."))
+		}
+		parent = node
+		key, node = mappingValue(node, name)
+		if key == nil {
+			return nil, nil, nil, errors.Errorf("%s not found", strings.Join(path[:i+1], "."))
+		}
+	}
+	return key, node, parent, nil
+}
+
+// SetKey sets a secret value, adding the key at the end of the data block if
+// it doesn't exist yet so the rest of the text is untouched.
+func (o *Object) SetKey(key string, value string) error {
+	if o.Data == nil {
+		return errors.New("object has no secret data")
+	}
+	if o.DataLoc.End == 0 {
+		return errors.New("object has no data section")
+	}
+	if !secretKeyRegexp.MatchString(key) {
+		return errors.Errorf("invalid key name %s", key)
+	}
+	_, exists := o.Data[key]
+	o.Data[key] = value
+	if exists {
+		return nil
+	}
+
+	// Add a placeholder entry, Serialize will fill in the real value.
+	keyText := renderScalar(key, 0, 0, true)
+	var buf strings.Builder
+	switch {
+	case len(o.KeyLocs) == 0:
+		buf.Write(o.Raw[:o.DataLoc.Start])
+		buf.WriteString(fmt.Sprintf("data:\n%s%s: \"\"", strings.Repeat(" ", o.dataIndent), keyText))
+		buf.Write(o.Raw[o.DataLoc.End:])
+	case o.dataFlow:
+		lastEnd := o.KeyLocs[len(o.KeyLocs)-1].Entry.End
+		buf.Write(o.Raw[:lastEnd])
+		buf.WriteString(fmt.Sprintf(", %s: \"\"", keyText))
+		buf.Write(o.Raw[lastEnd:])
+	default:
+		lastEnd := o.KeyLocs[len(o.KeyLocs)-1].Entry.End
+		buf.Write(o.Raw[:lastEnd])
+		buf.WriteString(fmt.Sprintf("\n%s%s: \"\"", strings.Repeat(" ", o.dataIndent), keyText))
+		buf.Write(o.Raw[lastEnd:])
+	}
+	o.Raw = []byte(buf.String())
+	return o.findLocations()
+}
+
+// RemoveKey removes a secret value and its line from the data block.
+func (o *Object) RemoveKey(key string) error {
+	index := -1
+	for i, keyLoc := range o.KeyLocs {
+		if keyLoc.Key == key {
+			index = i
+			break
 		}
-		locs = append(locs, KeysLocation{TextLocation: valueLoc, Key: key})
 	}
-	return locs, nil
+	if index == -1 {
+		return errors.Errorf("key %s not found", key)
+	}
+	delete(o.Data, key)
+
+	var buf strings.Builder
+	entry := o.KeyLocs[index].Entry
+	switch {
+	case len(o.KeyLocs) == 1:
+		// Nothing left, make sure data stays a map.
+		buf.Write(o.Raw[:o.DataLoc.Start])
+		buf.WriteString("data: {}")
+		buf.Write(o.Raw[o.DataLoc.End:])
+	case o.dataFlow && index > 0:
+		// Take the separator before the entry along with it.
+		buf.Write(o.Raw[:o.KeyLocs[index-1].Entry.End])
+		buf.Write(o.Raw[entry.End:])
+	case o.dataFlow:
+		buf.Write(o.Raw[:entry.Start])
+		buf.Write(o.Raw[o.KeyLocs[index+1].Entry.Start:])
+	default:
+		end := entry.End
+		if end < len(o.Raw) && o.Raw[end] == '\n' {
+			end++
+		}
+		buf.Write(o.Raw[:entry.Start])
+		buf.Write(o.Raw[end:])
+	}
+	o.Raw = []byte(buf.String())
+	return o.findLocations()
+}
+
+// DecryptError is returned by Decrypt for a value that couldn't be decoded
+// or decrypted.
+type DecryptError struct {
+	Key string
+	Err error
+}
+
+func (e DecryptError) Error() string {
+	return e.Err.Error()
+}
+
+// KeyMismatchError is returned by Decrypt when the values of a secret were
+// encrypted with more than one key.
+type KeyMismatchError struct {
+	Key        string
+	KeyId      string
+	OtherKeyId string
+}
+
+func (e KeyMismatchError) Error() string {
+	return fmt.Sprintf("key mismatch between %s and %s for %s", e.KeyId, e.OtherKeyId, e.Key)
+}
+
+// Decrypt decrypts the values of an EncryptedSecret, in key order so errors
+// are always about the same key.
+func (o *Object) Decrypt(cipher Cipher) error {
+	errs := o.DecryptAll(cipher)
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
 }
 
-func (o *Object) Decrypt(kmsService kmsiface.KMSAPI) error {
+// DecryptAll is like Decrypt, but keeps going after a value fails and returns
+// a DecryptError or KeyMismatchError for every value that failed, in key
+// order. The object is only decrypted if there are none.
+func (o *Object) DecryptAll(cipher Cipher) []error {
 	if o.Kind == "" {
 		return nil
 	}
 
+	keys := []string{}
+	for key := range o.OrigEnc.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	errs := []error{}
 	dec := &hacksecretsv1beta1.DecryptedSecret{ObjectMeta: o.OrigEnc.ObjectMeta, Data: map[string]string{}}
-	for key, value := range o.OrigEnc.Data {
+	for _, key := range keys {
+		value := o.OrigEnc.Data[key]
 		decodedValue := make([]byte, base64.StdEncoding.DecodedLen(len(value)))
 		l, err := base64.StdEncoding.Decode(decodedValue, []byte(value))
 		if err != nil {
-			return errors.Wrapf(err, "error base64 decoding value for %s", key)
+			errs = append(errs, DecryptError{Key: key, Err: errors.Wrapf(err, "error base64 decoding value for %s", key)})
+			continue
 		}
-		decryptedValue, err := kmsService.Decrypt(&kms.DecryptInput{
-			CiphertextBlob: decodedValue[:l],
-			EncryptionContext: map[string]*string{
-				"RidecellOperator": aws.String("true"),
-			},
-		})
+		plaintext, keyId, err := cipher.Decrypt(decodedValue[:l])
 		if err != nil {
-			return errors.Wrapf(err, "error decrypting value for %s", key)
+			errs = append(errs, DecryptError{Key: key, Err: errors.Wrapf(err, "error decrypting value for %s", key)})
+			continue
 		}
 		// Check if values in this secret were encrypted with more than one key.
-		if o.KeyId != "" && o.KeyId != *decryptedValue.KeyId {
-			return errors.Errorf("key mismatch between %s and %s for %s", o.KeyId, *decryptedValue.KeyId, key)
+		if o.KeyId != "" && o.KeyId != keyId {
+			errs = append(errs, KeyMismatchError{Key: key, KeyId: o.KeyId, OtherKeyId: keyId})
+			continue
 		}
-		o.KeyId = *decryptedValue.KeyId
-		decryptedString := string(decryptedValue.Plaintext)
+		o.KeyId = keyId
+		decryptedString := string(plaintext)
 		if decryptedString == secretsv1beta1.EncryptedSecretEmptyKey {
 			decryptedString = ""
 		}
 		dec.Data[key] = decryptedString
 	}
+	if len(errs) > 0 {
+		return errs
+	}
 	o.OrigDec = dec
 	o.Kind = "DecryptedSecret"
 	o.Data = dec.Data
 	return nil
 }
 
-func (o *Object) Encrypt(kmsService kmsiface.KMSAPI, defaultKeyId string, forceKeyId bool, reEncrypt bool) error {
+func (o *Object) Encrypt(cipher Cipher, defaultKeyId string, forceKeyId bool, reEncrypt bool) error {
 	if o.Kind == "" {
 		return nil
 	}
@@ -225,18 +443,11 @@ func (o *Object) Encrypt(kmsService kmsiface.KMSAPI, defaultKeyId string, forceK
 		}
 
 		// Encrypt the new value.
-		encryptedValue, err := kmsService.Encrypt(&kms.EncryptInput{
-			KeyId:     aws.String(keyId),
-			Plaintext: []byte(value),
-			// This encryption context is used for access control policies.
-			EncryptionContext: map[string]*string{
-				"RidecellOperator": aws.String("true"),
-			},
-		})
+		encryptedValue, err := cipher.Encrypt(keyId, []byte(value))
 		if err != nil {
 			return errors.Wrapf(err, "error encrypting value for %s", key)
 		}
-		enc.Data[key] = base64.StdEncoding.EncodeToString(encryptedValue.CiphertextBlob)
+		enc.Data[key] = base64.StdEncoding.EncodeToString(encryptedValue)
 	}
 	o.AfterEnc = enc
 	o.Kind = "EncryptedSecret"
@@ -257,7 +468,11 @@ func (o *Object) Serialize(out io.Writer) error {
 	if err != nil {
 		return err
 	}
-	_, err = out.Write([]byte(o.Kind))
+	kind := o.Kind
+	if quote := o.Raw[o.KindLoc.Start]; quote == '"' || quote == '\'' {
+		kind = string(quote) + kind + string(quote)
+	}
+	_, err = out.Write([]byte(kind))
 	if err != nil {
 		return err
 	}
@@ -266,30 +481,18 @@ func (o *Object) Serialize(out io.Writer) error {
 	for _, keyLoc := range o.KeyLocs {
 		newValue, ok := o.Data[keyLoc.Key]
 		if !ok {
-			panic("key from location not found in data")
+			return errors.Errorf("key %s from location not found in data", keyLoc.Key)
 		}
 
-		// Check for a multiline value.
-		if strings.ContainsRune(newValue, '\n') {
-			var buf strings.Builder
-			buf.WriteString("|")
-			lines := strings.Split(newValue, "\n")
-			// Trim the trailing newline, basically.
-			if lines[len(lines)-1] == "" {
-				lines = lines[:len(lines)-1]
-			}
-			for _, line := range lines {
-				// Hardwire to 4 spaces of indentation, which assumes 2 spaces on the keys.
-				// I'll probably regret this when someone uses 8 space indents.
-				buf.WriteString("\n    ")
-				buf.WriteString(line)
+		// Values that didn't change keep their original text.
+		if newValue == keyLoc.Value {
+			newValue = string(o.Raw[keyLoc.Start:keyLoc.End])
+		} else {
+			newValue = renderScalar(newValue, o.dataIndent, o.indentStep, o.dataFlow)
+			if keyLoc.Start == keyLoc.End && o.Raw[keyLoc.Start-1] == ':' {
+				// An empty value directly after the colon needs a space.
+				newValue = " " + newValue
 			}
-			newValue = buf.String()
-		}
-
-		// Check for things that YAML thinks aren't strings that might show up in the value.
-		if nonStringRegexp.MatchString(newValue) {
-			newValue = fmt.Sprintf(`"%s"`, newValue)
 		}
 		_, err = out.Write(o.Raw[carry:keyLoc.Start])
 		if err != nil {
@@ -207,7 +207,7 @@ data:
 		It("encrypts the data", func() {
 			obj, err := edit.NewObject([]byte(complexMixedContext))
 			Expect(err).ToNot(HaveOccurred())
-			err = obj.Encrypt(kmsMock(), "12345", false, false)
+			err = obj.Encrypt(kmsCipher(), "12345", false, false)
 			Expect(obj.Kind).To(Equal("EncryptedSecret"))
 			Expect(obj.Data).To(HaveKeyWithValue("MYKEY", "a21zbXl2YWx1ZQ=="))
 			Expect(obj.Data).To(HaveKeyWithValue("RANDOM_VALUE", "a21zNA=="))
@@ -217,7 +217,7 @@ data:
 		It("serializes the data after encryption", func() {
 			obj, err := edit.NewObject([]byte(complexMixedContext))
 			Expect(err).ToNot(HaveOccurred())
-			err = obj.Encrypt(kmsMock(), "12345", false, false)
+			err = obj.Encrypt(kmsCipher(), "12345", false, false)
 			var buf strings.Builder
 			err = obj.Serialize(&buf)
 			Expect(err).ToNot(HaveOccurred())
@@ -247,7 +247,7 @@ data:
 		It("decrypts the data", func() {
 			obj, err := edit.NewObject([]byte(complexEncryptedContent))
 			Expect(err).ToNot(HaveOccurred())
-			err = obj.Decrypt(kmsMock())
+			err = obj.Decrypt(kmsCipher())
 			Expect(obj.Kind).To(Equal("DecryptedSecret"))
 			Expect(obj.Data).To(HaveKeyWithValue("MYKEY", "myvalue"))
 			Expect(obj.Data).To(HaveKeyWithValue("RANDOM_VALUE", "4"))
@@ -257,11 +257,210 @@ data:
 		It("serializes the data after decryption", func() {
 			obj, err := edit.NewObject([]byte(complexEncryptedContent))
 			Expect(err).ToNot(HaveOccurred())
-			err = obj.Decrypt(kmsMock())
+			err = obj.Decrypt(kmsCipher())
 			var buf strings.Builder
 			err = obj.Serialize(&buf)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(buf.String()).To(Equal(complexMixedContext))
 		})
 	})
+
+	Context("with edits to keys", func() {
+		It("updates an existing key in place", func() {
+			obj, err := edit.NewObject([]byte(withComments))
+			Expect(err).ToNot(HaveOccurred())
+			err = obj.SetKey("MYKEY", "othervalue")
+			Expect(err).ToNot(HaveOccurred())
+			var buf strings.Builder
+			err = obj.Serialize(&buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.String()).To(Equal(strings.Replace(withComments, "MYKEY: myvalue", "MYKEY: othervalue", 1)))
+		})
+
+		It("adds a new key at the end of the data", func() {
+			obj, err := edit.NewObject([]byte(withComments))
+			Expect(err).ToNot(HaveOccurred())
+			err = obj.SetKey("NEW_KEY", "true")
+			Expect(err).ToNot(HaveOccurred())
+			var buf strings.Builder
+			err = obj.Serialize(&buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.String()).To(Equal(withComments + "  NEW_KEY: \"true\"\n"))
+		})
+
+		It("adds a key to empty data", func() {
+			obj, err := edit.NewObject([]byte(strings.Replace(simpleDecryptedSecret, "data:\n  MYKEY: myvalue\n", "data: {}\n", 1)))
+			Expect(err).ToNot(HaveOccurred())
+			err = obj.SetKey("MYKEY", "myvalue")
+			Expect(err).ToNot(HaveOccurred())
+			var buf strings.Builder
+			err = obj.Serialize(&buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.String()).To(Equal(simpleDecryptedSecret))
+		})
+
+		It("rejects invalid key names", func() {
+			obj, err := edit.NewObject([]byte(withComments))
+			Expect(err).ToNot(HaveOccurred())
+			err = obj.SetKey("bad key", "value")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("removes a key", func() {
+			obj, err := edit.NewObject([]byte(complexMixedContext))
+			Expect(err).ToNot(HaveOccurred())
+			err = obj.RemoveKey("tls.key")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(obj.Data).ToNot(HaveKey("tls.key"))
+			var buf strings.Builder
+			err = obj.Serialize(&buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.String()).ToNot(ContainSubstring("PRIVATE KEY"))
+			Expect(buf.String()).To(ContainSubstring("  # HTTP key!\n  # Determined by fair dice roll.\n  RANDOM_VALUE: \"4\"\n"))
+		})
+
+		It("removes the last key", func() {
+			obj, err := edit.NewObject([]byte(simpleDecryptedSecret))
+			Expect(err).ToNot(HaveOccurred())
+			err = obj.RemoveKey("MYKEY")
+			Expect(err).ToNot(HaveOccurred())
+			var buf strings.Builder
+			err = obj.Serialize(&buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.String()).To(HaveSuffix("data: {}\n"))
+		})
+
+		It("fails to remove a missing key", func() {
+			obj, err := edit.NewObject([]byte(simpleDecryptedSecret))
+			Expect(err).ToNot(HaveOccurred())
+			err = obj.RemoveKey("OTHER")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("with other YAML styles", func() {
+		unusual := `apiVersion: secrets.ridecell.io/v1beta1
+kind: DecryptedSecret
+metadata:
+    name: unusual
+    namespace: default
+data:
+    # Folded, so newlines become spaces.
+    FOLDED: >-
+        one
+        two
+    "QUOTED.key": &shared value
+    ALIAS: *shared
+    TAGGED: !!str 1234
+    SINGLE: 'it''s' # Trailing comment.
+    LITERAL: |
+        line one
+          indented
+`
+
+		It("serializes the data unchanged", func() {
+			obj, err := edit.NewObject([]byte(unusual))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(obj.Data).To(HaveKeyWithValue("FOLDED", "one two"))
+			Expect(obj.Data).To(HaveKeyWithValue("QUOTED.key", "value"))
+			Expect(obj.Data).To(HaveKeyWithValue("ALIAS", "value"))
+			Expect(obj.Data).To(HaveKeyWithValue("TAGGED", "1234"))
+			Expect(obj.Data).To(HaveKeyWithValue("SINGLE", "it's"))
+			var buf strings.Builder
+			err = obj.Serialize(&buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.String()).To(Equal(unusual))
+		})
+
+		It("rewrites changed values with the existing indentation", func() {
+			obj, err := edit.NewObject([]byte(unusual))
+			Expect(err).ToNot(HaveOccurred())
+			obj.Data["FOLDED"] = "new\nlines"
+			obj.Data["ALIAS"] = "1.5"
+			obj.Data["LITERAL"] = "  starts indented\n"
+			var buf strings.Builder
+			err = obj.Serialize(&buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("    FOLDED: |-\n        new\n        lines\n    \"QUOTED.key\""))
+			Expect(buf.String()).To(ContainSubstring("    ALIAS: \"1.5\"\n"))
+			Expect(buf.String()).To(HaveSuffix("    LITERAL: |4\n          starts indented\n"))
+
+			reparsed, err := edit.NewObject([]byte(buf.String()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reparsed.Data).To(Equal(obj.Data))
+		})
+
+		It("handles flow mappings", func() {
+			flow := strings.Replace(simpleDecryptedSecret, "data:\n  MYKEY: myvalue\n", "data: {MYKEY: myvalue, 'OTHER': \"x\"}\n", 1)
+			obj, err := edit.NewObject([]byte(flow))
+			Expect(err).ToNot(HaveOccurred())
+			obj.Data["MYKEY"] = "a, b"
+			err = obj.SetKey("NEW", "new")
+			Expect(err).ToNot(HaveOccurred())
+			err = obj.RemoveKey("OTHER")
+			Expect(err).ToNot(HaveOccurred())
+			var buf strings.Builder
+			err = obj.Serialize(&buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.String()).To(HaveSuffix("data: {MYKEY: \"a, b\", NEW: new}\n"))
+		})
+
+		It("encrypts empty values", func() {
+			empty := strings.Replace(simpleDecryptedSecret, "  MYKEY: myvalue\n", "  EMPTY:\n  NOTHING: ~\n  MYKEY: myvalue\n  LAST:", 1)
+			obj, err := edit.NewObject([]byte(empty))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(obj.Data).To(HaveKeyWithValue("EMPTY", ""))
+			Expect(obj.Data).To(HaveKeyWithValue("NOTHING", ""))
+			Expect(obj.Data).To(HaveKeyWithValue("LAST", ""))
+			err = obj.Encrypt(kmsCipher(), "12345", false, false)
+			Expect(err).ToNot(HaveOccurred())
+			var buf strings.Builder
+			err = obj.Serialize(&buf)
+			Expect(err).ToNot(HaveOccurred())
+			// Empty values are encrypted as a placeholder.
+			placeholder := "a21zX19fZW1wdHlfc3RyaW5nX19f"
+			Expect(buf.String()).To(HaveSuffix("data:\n  EMPTY: " + placeholder + "\n  NOTHING: " + placeholder + "\n  MYKEY: a21zbXl2YWx1ZQ==\n  LAST: " + placeholder))
+
+			reparsed, err := edit.NewObject([]byte(buf.String()))
+			Expect(err).ToNot(HaveOccurred())
+			err = reparsed.Decrypt(kmsCipher())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reparsed.Data).To(Equal(map[string]string{"EMPTY": "", "NOTHING": "", "MYKEY": "myvalue", "LAST": ""}))
+		})
+
+		It("keeps quotes around the kind", func() {
+			quoted := strings.Replace(simpleDecryptedSecret, "kind: DecryptedSecret", "kind: \"DecryptedSecret\"", 1)
+			obj, err := edit.NewObject([]byte(quoted))
+			Expect(err).ToNot(HaveOccurred())
+			err = obj.Encrypt(kmsCipher(), "12345", false, false)
+			Expect(err).ToNot(HaveOccurred())
+			var buf strings.Builder
+			err = obj.Serialize(&buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.String()).To(Equal(strings.Replace(simpleEncryptedSecret, "kind: EncryptedSecret", "kind: \"EncryptedSecret\"", 1)))
+		})
+
+		It("finds fields", func() {
+			obj, err := edit.NewObject([]byte(withComments))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(obj.FieldLine("metadata", "name")).To(Equal(5))
+			Expect(obj.FieldLine("metadata", "missing")).To(Equal(0))
+			loc, err := obj.FieldLocation("metadata", "namespace")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(withComments[loc.Start:loc.End]).To(Equal("commentsland"))
+			_, err = obj.FieldLocation("kind", "name")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("returns an error for invalid YAML", func() {
+			_, err := edit.NewObject([]byte(simpleDecryptedSecret + "  BAD: [\n"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("returns an error for merge keys", func() {
+			merged := strings.Replace(simpleDecryptedSecret, "data:\n", "base: &base\n  OTHER: other\ndata:\n  <<: *base\n", 1)
+			_, err := edit.NewObject([]byte(merged))
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
@@ -29,6 +29,8 @@ type Manifest []*Object
 type Object struct {
 	// The original text as parsed by NewYAMLOrJSONDecoder.
 	Raw []byte
+	// Where Raw starts in the manifest it came from, as a byte offset.
+	Offset int
 	// The original object as decoded by UniversalDeserializer.
 	Object runtime.Object
 	Meta   metav1.Object
@@ -49,6 +51,11 @@ type Object struct {
 	KindLoc TextLocation
 	DataLoc TextLocation
 	KeyLocs []KeysLocation
+
+	// Layout of the data mapping, used when writing new values.
+	dataFlow   bool
+	dataIndent int
+	indentStep int
 }
 
 type TextLocation struct {
@@ -59,4 +66,8 @@ type TextLocation struct {
 type KeysLocation struct {
 	TextLocation
 	Key string
+	// The value as originally parsed from the text.
+	Value string
+	// The whole key: value entry, from the start of the line.
+	Entry TextLocation
 }
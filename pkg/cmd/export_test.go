@@ -0,0 +1,80 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"io"
+	"regexp"
+
+	"github.com/Ridecell/ridectl/pkg/kubernetes"
+)
+
+// Exported for tests in cmd_test.
+
+var PrintSecretDiff = printSecretDiff
+var LoadMaskKey = loadMaskKey
+var NewValueMask = newValueMask
+var MaskValues = maskValues
+var WriteOutput = writeOutput
+var CheckOutputFormat = checkOutputFormat
+
+const ExtraOutputFormats = extraOutputFormats
+
+func SetOutputFlag(format string) {
+	outputFlag = format
+}
+
+var NewInstanceSort = newInstanceSort
+
+// FilterInstances applies the ls filters for the given flag values.
+func FilterInstances(version string, context string, status string, instances []kubernetes.SummonPlatformItem) ([]kubernetes.SummonPlatformItem, error) {
+	lsVersionFlag, lsContextFlag, lsStatusFlag = version, context, status
+	defer func() { lsVersionFlag, lsContextFlag, lsStatusFlag = "", "", "" }()
+	filters, err := newLsFilters()
+	if err != nil {
+		return nil, err
+	}
+	return filters.apply(instances), nil
+}
+
+var SilenceExitStatus = silenceExitStatus
+
+func ExitStatusError(status int) error {
+	return exitStatusError{status: status}
+}
+
+// ExitStatus is the status ridectl exits with for err, or -1 if err would be
+// printed instead.
+func ExitStatus(err error) int {
+	if exitErr, ok := err.(exitStatusError); ok {
+		return exitErr.status
+	}
+	return -1
+}
+
+var PodLabelSelector = podLabelSelector
+var PickPod = pickPod
+var CheckContainer = checkContainer
+
+// CopyLogLines copies the matching lines of in to out.
+func CopyLogLines(in io.Reader, prefix string, grep *regexp.Regexp, out io.Writer) error {
+	return copyLogLines(in, prefix, grep, &logsWriter{out: out})
+}
+
+var NewRunJob = newRunJob
+
+var ParsePsqlCSV = parsePsqlCSV
@@ -0,0 +1,192 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Ridecell/ridectl/pkg/flavor"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+var flavorForceFlag bool
+
+func init() {
+	rootCmd.AddCommand(flavorCmd)
+	flavorCmd.AddCommand(flavorLsCmd)
+	flavorCmd.AddCommand(flavorUploadCmd)
+	flavorCmd.AddCommand(flavorDescribeCmd)
+
+	flavorUploadCmd.Flags().BoolVar(&flavorForceFlag, "force", false, "(optional) Replace an existing flavor with the same name")
+}
+
+var flavorCmd = &cobra.Command{
+	Use:   "flavor",
+	Short: "List, upload and describe database flavors",
+	Long: `List, upload and describe the database flavors loadflavor can load, from the flavors S3 bucket.
+The bucket and region can be changed in ~/.ridectl/config.yaml or with $RIDECTL_FLAVOR_BUCKET and $RIDECTL_FLAVOR_REGION.`,
+}
+
+var flavorLsCmd = &cobra.Command{
+	Use:         "ls [flags] [prefix]",
+	Short:       "List flavors",
+	Long:        "List flavors, optionally only those starting with a prefix. -o name prints only the names.",
+	Annotations: map[string]string{extraOutputFormats: "name"},
+	Args:        cobra.MaximumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		prefix := ""
+		if len(args) == 1 {
+			prefix = args[0]
+		}
+		store, err := flavor.NewStore()
+		if err != nil {
+			return err
+		}
+		flavors, err := store.List(prefix)
+		if err != nil {
+			return err
+		}
+
+		if outputFlag == "name" {
+			for _, f := range flavors {
+				fmt.Println(f.Name)
+			}
+			return nil
+		}
+		return printOutput(flavors, func(out io.Writer) error {
+			now := time.Now()
+			w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+			fmt.Fprintf(w, "NAME\tSIZE\tAGE\n")
+			for _, f := range flavors {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", f.Name, formatSize(f.Size), duration.HumanDuration(now.Sub(f.LastModified)))
+			}
+			return w.Flush()
+		})
+	},
+}
+
+var flavorUploadCmd = &cobra.Command{
+	Use:   "upload [flags] <file> <flavor_name>",
+	Short: "Upload a flavor, compressing it with bzip2",
+	Long:  "Upload a flavor file, compressing it with bzip2 unless it already is. Existing flavors are only replaced with --force.",
+	Args: func(_ *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return fmt.Errorf("File and flavor name arguments are required")
+		}
+		if len(args) > 2 {
+			return fmt.Errorf("Too many arguments")
+		}
+		return nil
+	},
+	RunE: func(_ *cobra.Command, args []string) error {
+		inFile, err := os.Open(args[0])
+		if err != nil {
+			return errors.Wrap(err, "unable to open flavor file")
+		}
+		defer inFile.Close()
+
+		store, err := flavor.NewStore()
+		if err != nil {
+			return err
+		}
+		if !flavorForceFlag {
+			_, err = store.Describe(args[1])
+			if err == nil {
+				return errors.Errorf("flavor %s already exists, use --force to replace it", args[1])
+			}
+			if !flavor.IsNotFound(err) {
+				return err
+			}
+		}
+
+		metadata := map[string]string{"source-file": filepath.Base(args[0])}
+		if currentUser, err := user.Current(); err == nil {
+			metadata["uploaded-by"] = currentUser.Username
+		}
+		err = store.Upload(args[1], inFile, metadata)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Uploaded %s to %s\n", args[1], store.Bucket)
+		return nil
+	},
+}
+
+var flavorDescribeCmd = &cobra.Command{
+	Use:   "describe [flags] <flavor_name>",
+	Short: "Show the details of a flavor",
+	Args: func(_ *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("Flavor name argument is required")
+		}
+		if len(args) > 1 {
+			return fmt.Errorf("Too many arguments")
+		}
+		return nil
+	},
+	RunE: func(_ *cobra.Command, args []string) error {
+		store, err := flavor.NewStore()
+		if err != nil {
+			return err
+		}
+		f, err := store.Describe(args[0])
+		if err != nil {
+			return err
+		}
+		return printOutput(f, func(out io.Writer) error {
+			w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+			fmt.Fprintf(w, "Name:\t%s\n", f.Name)
+			fmt.Fprintf(w, "Bucket:\t%s\n", store.Bucket)
+			fmt.Fprintf(w, "Size:\t%s\n", formatSize(f.Size))
+			fmt.Fprintf(w, "Last modified:\t%s\n", f.LastModified.Local().Format(time.RFC1123))
+			fmt.Fprintf(w, "ETag:\t%s\n", f.ETag)
+			keys := []string{}
+			for key := range f.Metadata {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Fprintf(w, "%s:\t%s\n", key, f.Metadata[key])
+			}
+			return w.Flush()
+		})
+	},
+}
+
+// formatSize prints a byte count in the largest unit that keeps it above 1.
+func formatSize(size int64) string {
+	value := float64(size)
+	for _, unit := range []string{"B", "KB", "MB", "GB"} {
+		if value < 1024 || unit == "GB" {
+			if unit == "B" {
+				return fmt.Sprintf("%d B", size)
+			}
+			return fmt.Sprintf("%.1f %s", value, unit)
+		}
+		value /= 1024
+	}
+	return ""
+}
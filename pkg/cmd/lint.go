@@ -18,298 +18,275 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 
-	"github.com/Ridecell/ridectl/pkg/cmd/edit"
+	"github.com/Ridecell/ridectl/pkg/config"
+	"github.com/Ridecell/ridectl/pkg/kubernetes"
+	"github.com/Ridecell/ridectl/pkg/lint"
 	"github.com/heroku/docker-registry-client/registry"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
-
-	summonv1beta1 "github.com/Ridecell/ridecell-operator/pkg/apis/summon/v1beta1"
 )
 
+var lintDisableFlag []string
+var lintFixFlag bool
+var lintFormatFlag string
+var lintCRDFlag []string
+var lintCRDFromClusterFlag bool
+var lintConfigFlag string
+var lintDecryptFlag bool
+var lintConcurrencyFlag int
+
 func init() {
 	rootCmd.AddCommand(lintCmd)
+	lintCmd.Flags().StringSliceVar(&lintDisableFlag, "disable", nil, "(optional) Rule IDs to skip, can be repeated or comma separated")
+	lintCmd.Flags().BoolVar(&lintFixFlag, "fix", false, "(optional) Fix mechanical problems like mismatched names in place")
+	lintCmd.Flags().StringVar(&lintFormatFlag, "format", "", "(optional) Report format for CI instead of --output: "+strings.Join(lint.Formats, ", "))
+	lintCmd.Flags().StringSliceVar(&lintCRDFlag, "crd", nil, "(optional) CRD files with the schemas to validate objects against")
+	lintCmd.Flags().BoolVar(&lintCRDFromClusterFlag, "crd-from-cluster", false, "(optional) Validate SummonPlatforms against the schema of the CRD in the cluster")
+	lintCmd.Flags().StringVar(&lintConfigFlag, "config", "", "(optional) Lint config file, by default "+lint.RepoConfigFile+" in the repository root")
+	lintCmd.Flags().BoolVar(&lintDecryptFlag, "decrypt", false, "(optional) Decrypt secrets to check they are valid and use the key from .keys.yml")
+	lintCmd.Flags().IntVarP(&lintConcurrencyFlag, "concurrency", "j", 4, "(optional) Number of files to decrypt at once with --decrypt")
 }
 
-type secretLocation struct {
-	ObjName string
-	KeyName string
-}
-
-type secretLocations []secretLocation
-
-func (sl secretLocations) objNames() []string {
-	var allObjNames []string
-	for _, location := range sl {
-		allObjNames = append(allObjNames, location.ObjName)
-	}
-	return allObjNames
+type lintOutput struct {
+	Findings []lint.Finding `json:"findings"`
+	Passed   bool           `json:"passed"`
 }
 
-func (sl secretLocations) formatStrings() []string {
-	var allFormattedStrings []string
-	for _, location := range sl {
-		allFormattedStrings = append(allFormattedStrings, fmt.Sprintf("%s: %s", location.ObjName, location.KeyName))
-	}
-	return allFormattedStrings
-}
-
-var foundNames map[string]string
-var allSecretLocations map[string]secretLocations
-
 var lintCmd = &cobra.Command{
 	Use:   "lint [flags] <path>...",
 	Short: "Lints SummonPlatform manifest files",
-	Long:  `Checks Summon instance manifest files for invalid values and names`,
-	Args:  func(_ *cobra.Command, args []string) error { return nil },
-	RunE: func(_ *cobra.Command, args []string) error {
-		// Fetch docker image names
-		googleKey := os.Getenv("GOOGLE_SERVICE_ACCOUNT_KEY")
-		if len(googleKey) == 0 {
-			fmt.Printf("environment variable GOOGLE_SERVICE_ACCOUNT_KEY not defined, skipping image check\n")
+	Long:  "Checks Summon instance manifest files for invalid values and names.\n\nRules:\n" + lintRulesHelp(),
+	Args:  cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if lintFormatFlag != "" && !isLintFormat(lintFormatFlag) {
+			return fmt.Errorf("unknown format %s, must be one of %s", lintFormatFlag, strings.Join(lint.Formats, ", "))
 		}
-
-		var imageTags []string
-		var err error
-		if len(googleKey) > 0 {
-			transport := registry.WrapTransport(http.DefaultTransport, "https://us.gcr.io", "_json_key", googleKey)
-			hub := &registry.Registry{
-				URL: "https://us.gcr.io",
-				Client: &http.Client{
-					Transport: transport,
-				},
-				Logf: registry.Quiet,
+		ridectlConfig, err := config.Get()
+		if err != nil {
+			return err
+		}
+		paths := args
+		if len(paths) == 0 {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return err
 			}
+			paths = []string{cwd}
+		}
+
+		linter := &lint.Linter{Config: ridectlConfig}
+		linter.Repo, err = loadLintRepoConfig(paths[0])
+		if err != nil {
+			return err
+		}
+		err = linter.Disable(append(linter.Repo.Disable, lintDisableFlag...)...)
+		if err != nil {
+			return err
+		}
 
-			imageTags, err = hub.Tags("ridecell-1/summon")
+		if linter.Enabled("image-version") {
+			linter.ImageTags, err = fetchImageTags()
 			if err != nil {
 				return err
 			}
 		}
 
-		foundNames = make(map[string]string)
-		allSecretLocations = make(map[string]secretLocations)
-		var fileNames []string
-		if len(args) > 0 {
-			fileNames, err = parseArgs(args)
+		if lintDecryptFlag {
+			if lintConcurrencyFlag < 1 {
+				return errors.New("concurrency must be at least 1")
+			}
+			linter.Cipher, err = newCipher()
 			if err != nil {
 				return err
 			}
-		} else {
-			cwd, err := os.Getwd()
+			linter.Concurrency = lintConcurrencyFlag
+		}
+
+		if linter.Enabled("schema") {
+			err = loadLintSchemas(linter)
 			if err != nil {
 				return err
 			}
-			fileNames, err = walkDir(cwd)
+		}
+
+		fileNames, err := lint.Files(paths)
+		if err != nil {
+			return err
+		}
+
+		findings, err := linter.Lint(fileNames)
+		if err != nil {
+			return err
+		}
+		if lintFixFlag {
+			fixed, err := lint.Fix(findings)
+			for filename, count := range fixed {
+				fmt.Fprintf(os.Stderr, "Fixed %d problems in %s\n", count, filename)
+			}
 			if err != nil {
 				return err
 			}
+			if len(fixed) > 0 {
+				findings, err = linter.Lint(fileNames)
+				if err != nil {
+					return err
+				}
+			}
 		}
 
-		var failedTests bool
-		for _, filename := range fileNames {
-			err = lintFile(filename, imageTags)
+		passed := lint.Passed(findings)
+		if lintFormatFlag != "" {
+			relativeFindings(fileNames, findings)
+			err = lint.Write(os.Stdout, lintFormatFlag, fileNames, findings, version)
 			if err != nil {
-				fmt.Printf("%s\n", err.Error())
-				failedTests = true
+				return err
+			}
+			if !passed {
+				return silentFailure(cmd)
 			}
+			return nil
 		}
-		for _, locationList := range allSecretLocations {
-			if len(locationList) > 1 {
-				failedTests = true
 
-				keysMatch := true
-				var allObjNames []string
-				for _, location := range locationList {
-					allObjNames = append(allObjNames, location.ObjName)
-					if location.KeyName != locationList[0].KeyName {
-						keysMatch = false
-					}
+		output := lintOutput{Findings: findings, Passed: passed}
+		err = printOutput(output, func(out io.Writer) error {
+			for _, finding := range output.Findings {
+				location := finding.File
+				if finding.Line > 0 {
+					location = fmt.Sprintf("%s:%d", finding.File, finding.Line)
 				}
-
-				if keysMatch {
-					fmt.Printf("Duplicate secret value %s found in %s\n", locationList[0].KeyName, strings.Join(locationList.objNames(), ", "))
-				} else {
-					fmt.Printf("Duplicate secret value found in %s\n", strings.Join(locationList.formatStrings(), ", "))
+				fixable := ""
+				if finding.Fixable {
+					fixable = ", fixable with --fix"
 				}
+				fmt.Fprintf(out, "%s: %s: %s [%s%s]\n", location, finding.Severity, finding.Message, finding.Rule, fixable)
+			}
+			if !output.Passed {
+				fmt.Fprintf(out, "Tests failed.\n")
 			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
-		if failedTests {
-			fmt.Printf("Tests failed.\n")
-			// Exit here and don't return error so Cobra doesn't display extra text
-			os.Exit(1)
+		if !output.Passed {
+			return silentFailure(cmd)
 		}
 		return nil
 	},
 }
 
-func getManifest(filename string) (edit.Manifest, error) {
-	// Read the file in.
-	inFile, err := os.Open(filename)
-	if err != nil {
-		return nil, fmt.Errorf("%s: %v", filename, err)
+// fetchImageTags lists the Summon image versions, or returns nil to skip
+// checking them when there are no registry credentials.
+func fetchImageTags() ([]string, error) {
+	googleKey := os.Getenv("GOOGLE_SERVICE_ACCOUNT_KEY")
+	if len(googleKey) == 0 {
+		fmt.Fprintf(os.Stderr, "environment variable GOOGLE_SERVICE_ACCOUNT_KEY not defined, skipping image check\n")
+		return nil, nil
 	}
-	defer inFile.Close()
-	// Parse the input file to objects.
-	inManifest, err := edit.NewManifest(inFile)
-	if err != nil {
-		return nil, fmt.Errorf("%s: %v", filename, err)
+	transport := registry.WrapTransport(http.DefaultTransport, "https://us.gcr.io", "_json_key", googleKey)
+	hub := &registry.Registry{
+		URL: "https://us.gcr.io",
+		Client: &http.Client{
+			Transport: transport,
+		},
+		Logf: registry.Quiet,
 	}
-	return inManifest, nil
+	return hub.Tags("ridecell-1/summon")
 }
 
-func lintFile(filename string, imageTags []string) error {
-	path, file := filepath.Split(filename)
-
-	clusterEnv := filepath.Base(path)
-	clusterName := strings.Split(file, ".")[0]
-
-	// Our expected name should be filename-foldername
-	if strings.Contains(clusterEnv, "-") {
-		clusterEnv = strings.Split(clusterEnv, "-")[1]
-	}
-	expectedName := fmt.Sprintf("%s-%s", clusterName, clusterEnv)
-
-	// Check our filename against expected values
-	match := regexp.MustCompile(`^[a-z0-9]+.yml`).Match([]byte(file))
-	if !match {
-		// Other checks not reliable if this fails, continue
-		return fmt.Errorf("%s: invalid file name, must match ^[a-z0-9]+.yml$", filename)
-	}
-
-	// Make sure the directory name is valid
-	match = regexp.MustCompile(`^[a-z]+-[a-z]+|[a-z]+$`).Match([]byte(clusterEnv))
-	if !match {
-		return fmt.Errorf("%s: got invalid directory name %s", filename, clusterEnv)
-	}
-
-	manifest, err := getManifest(filename)
-	if err != nil {
-		return err
-	}
-	// Only do parsing checks on shared.yml
-	if file == "shared.yml" {
-		return nil
-	}
-
-	if len(manifest) != 2 {
-		return fmt.Errorf("%s: expected two objects in file got %v", filename, len(manifest))
-	}
-
-	summonObj, ok := manifest[0].Object.(*summonv1beta1.SummonPlatform)
-	if !ok {
-		return fmt.Errorf("%s: SummonPlatform is required to be the first object in manifest", filename)
-	}
-	existingFilename, ok := foundNames[summonObj.Name]
-	if ok {
-		return fmt.Errorf("Duplicate SummonPlatform names not supported: %s found in %s and %s", summonObj.Name, existingFilename, filename)
-	}
-	foundNames[summonObj.Name] = filename
-
-	// Make sure that either autodeploy or version is set
-	if summonObj.Spec.AutoDeploy == "" && summonObj.Spec.Version == "" {
-		return fmt.Errorf("%s: Neither Autodeploy or Version are set.", filename)
-	}
-
-	// Make sure that autodeploy and version are not both set
-	if summonObj.Spec.AutoDeploy != "" && summonObj.Spec.Version != "" {
-		return fmt.Errorf("%s: Autodeploy and Version both set, only one should be set at a time.", filename)
-	}
-
-	// Check that the docker image exists
-	if summonObj.Spec.AutoDeploy == "" {
-		if imageTags != nil {
-			var foundImage bool
-			for _, imageTag := range imageTags {
-				if summonObj.Spec.Version == imageTag {
-					foundImage = true
-					break
-				}
-			}
-
-			if !foundImage {
-				return fmt.Errorf(`%s: version "%s" does not exist`, filename, summonObj.Spec.Version)
-			}
+// loadLintRepoConfig loads --config, or the lint config of the repository
+// path is in if it has one.
+func loadLintRepoConfig(path string) (*lint.RepoConfig, error) {
+	configPath := lintConfigFlag
+	if configPath == "" {
+		var err error
+		configPath, err = lint.FindRepoConfig(path)
+		if err != nil {
+			return nil, err
 		}
-	}
-
-	if manifest[1].Kind != "EncryptedSecret" {
-		return fmt.Errorf("%s: EncryptedSecret is required to be the second object in manifest", filename)
-	}
-
-	var unencryptedValueFound bool
-	for secretKey, secretValue := range manifest[1].Data {
-		if !strings.HasPrefix(secretValue, "AQICAH") {
-			unencryptedValueFound = true
-			fmt.Printf("%s: EncryptedSecret %s missing preamble, may not be encrypted.", filename, secretKey)
+		if configPath == "" {
+			return &lint.DefaultRepoConfig, nil
 		}
-
-		allSecretLocations[secretValue] = append(allSecretLocations[secretValue], secretLocation{ObjName: summonObj.Name, KeyName: secretKey})
-	}
-
-	if unencryptedValueFound {
-		// Return blank error to not spam terminal, added benefit of spacing out filenames.
-		return fmt.Errorf("")
 	}
+	return lint.LoadRepoConfig(configPath)
+}
 
-	for _, object := range manifest {
-		if object.Meta.GetName() != expectedName {
-			return fmt.Errorf("%s: %s name %s did not match expected value %s", filename, object.Kind, object.Meta.GetName(), expectedName)
+// loadLintSchemas adds the CRDs from --crd and --crd-from-cluster to the
+// linter.
+func loadLintSchemas(linter *lint.Linter) error {
+	for _, filename := range lintCRDFlag {
+		file, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		crds, err := lint.ReadCRDs(file)
+		file.Close()
+		if err != nil {
+			return errors.Wrapf(err, "error reading %s", filename)
 		}
-		if object.Meta.GetNamespace() != clusterEnv && object.Meta.GetNamespace() != fmt.Sprintf("summon-%s", clusterEnv) {
-			return fmt.Errorf("%s: %s namespace %s did not match expected value %s", filename, object.Kind, object.Meta.GetNamespace(), clusterEnv)
+		if len(crds) == 0 {
+			return errors.Errorf("no CustomResourceDefinitions found in %s", filename)
+		}
+		for _, crd := range crds {
+			linter.AddCRD(crd)
 		}
 	}
-	return nil
-}
-
-func parseArgs(args []string) ([]string, error) {
-	var output []string
-	for _, arg := range args {
-		// If our input is a directory walk it and append to output
-		fileInfo, err := os.Stat(arg)
+	if lintCRDFromClusterFlag {
+		crd, err := kubernetes.GetCRD(kubeconfigFlag, "summonplatforms.summon.ridecell.io")
 		if err != nil {
-			return nil, err
-		}
-		if fileInfo.IsDir() {
-			files, err := walkDir(arg)
-			if err != nil {
-				return nil, err
-			}
-			output = append(output, files...)
+			return err
 		}
+		linter.AddCRD(crd)
+	}
+	return nil
+}
 
-		_, filename := filepath.Split(arg)
-		// Only care about .yml files and skips hidden files
-		if strings.HasSuffix(filename, ".yml") && !strings.HasPrefix(filename, ".") {
-			output = append(output, arg)
+func isLintFormat(format string) bool {
+	for _, known := range lint.Formats {
+		if format == known {
+			return true
 		}
 	}
-	return output, nil
+	return false
 }
 
-func walkDir(startDir string) ([]string, error) {
-	var fileNames []string
-	err := filepath.Walk(startDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+// relativeFindings makes file paths relative to the working directory, which
+// is the repository root in CI, since that's what annotations expect.
+func relativeFindings(fileNames []string, findings []lint.Finding) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	relative := func(path string) string {
+		if !filepath.IsAbs(path) {
+			return path
 		}
-		// Skip hidden folders
-		if strings.HasPrefix(info.Name(), ".") && info.IsDir() {
-			return filepath.SkipDir
+		rel, err := filepath.Rel(cwd, path)
+		if err != nil {
+			return path
 		}
-		// Only care about .yml files and skips hidden files
-		if strings.HasSuffix(info.Name(), ".yml") && !strings.HasPrefix(info.Name(), ".") {
-			fileNames = append(fileNames, path)
+		return rel
+	}
+	for i := range fileNames {
+		fileNames[i] = relative(fileNames[i])
+	}
+	for i := range findings {
+		if findings[i].File != "" {
+			findings[i].File = relative(findings[i].File)
 		}
-		return nil
-	})
-	if err != nil {
-		return nil, err
 	}
-	return fileNames, nil
+}
+
+func lintRulesHelp() string {
+	help := ""
+	for _, rule := range lint.Rules() {
+		help += fmt.Sprintf("  %-20s %s\n", rule.ID, rule.Description)
+	}
+	return help
 }
@@ -18,14 +18,15 @@ package cmd
 
 import (
 	"compress/bzip2"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
-	"os/exec"
+	"strings"
 
+	"github.com/Ridecell/ridectl/pkg/flavor"
 	"github.com/Ridecell/ridectl/pkg/kubernetes"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
@@ -33,16 +34,18 @@ import (
 )
 
 var eraseDatabaseFlag bool
+var loadflavorDryRunFlag bool
 
 func init() {
 	rootCmd.AddCommand(loadflavorCmd)
 	loadflavorCmd.Flags().BoolVar(&eraseDatabaseFlag, "erase-database", false, "Erases database before loading flavor data.")
+	loadflavorCmd.Flags().BoolVar(&loadflavorDryRunFlag, "dry-run", false, "(optional) Only download and validate the flavor, without loading it")
 }
 
 var loadflavorCmd = &cobra.Command{
 	Use:   "loadflavor [flags] <cluster_name> <filepath|flavor_name>",
 	Short: "Loads a database flavor into a Summon container",
-	Long:  `Loads specified database flavor into a Summon database from s3 or local file.`,
+	Long:  `Loads specified database flavor into a Summon database from a local file or the flavors bucket, see ridectl flavor ls.`,
 	Args: func(_ *cobra.Command, args []string) error {
 		if len(args) < 2 {
 			return fmt.Errorf("Cluster name and flavor arguments are required")
@@ -52,11 +55,38 @@ var loadflavorCmd = &cobra.Command{
 		}
 		return nil
 	},
-	RunE: func(_ *cobra.Command, args []string) error {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		target, err := kubernetes.ParseSubject(args[0])
 		if err != nil {
 			return errors.Wrap(err, "not a valid target")
 		}
+		// Get the whole flavor first, so a bad download never reaches the pod.
+		flavorFile, flavorSize, compressed, cleanup, err := openFlavor(args[1])
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		flavorReader := func(bar *progressBar) (io.Reader, *progressReader) {
+			counter := &progressReader{Reader: flavorFile, total: flavorSize, bar: bar}
+			if compressed {
+				return bzip2.NewReader(counter), counter
+			}
+			return counter, counter
+		}
+
+		if loadflavorDryRunFlag {
+			reader, counter := flavorReader(nil)
+			err = validateFlavor(reader, args[1])
+			if err != nil {
+				return err
+			}
+			if counter.done == 0 {
+				return errors.Errorf("flavor %s is empty", args[1])
+			}
+			fmt.Fprintf(os.Stderr, "Flavor %s is valid\n", args[1])
+			return nil
+		}
+
 		labelSelector := fmt.Sprintf("app.kubernetes.io/instance=%s-web", args[0])
 
 		fetchObject := &kubernetes.KubeObject{}
@@ -65,51 +95,98 @@ var loadflavorCmd = &cobra.Command{
 			return errors.Wrap(err, "unable to find pod")
 		}
 
-		contextName := fetchObject.Context.Name
-
 		pod, ok := fetchObject.Top.(*corev1.Pod)
 		if !ok {
 			return errors.New("unable to convert runtime.object to corev1.pod")
 		}
 
-		cmdArgs := []string{"exec", "-i", "-n", pod.Namespace, pod.Name, "--context", contextName, "--", "python", "manage.py", "loadflavor", "/dev/stdin"}
+		command := []string{"python", "manage.py", "loadflavor", "/dev/stdin"}
 		if eraseDatabaseFlag {
-			cmdArgs = append(cmdArgs, "--erase-database")
+			command = append(command, "--erase-database")
 		}
-		cmd := exec.Command("kubectl", cmdArgs...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
 
-		// Need to check if our input is a file or not.
-		inFile, err := os.Open(args[1])
-		if err != nil && !os.IsNotExist(err) {
-			return err
+		bar := newProgressBar("Loading " + args[1])
+		stdin, _ := flavorReader(bar)
+		err = execInPod(fetchObject, pod, "", command, stdin)
+		bar.Finish()
+		if err != nil {
+			return silenceExitStatus(cmd, err)
 		}
-		cmd.Stdin = inFile
 
-		if os.IsNotExist(err) {
-			// Our arg is not a file, assume it's an s3 key
-			sess, err := session.NewSession()
-			if err != nil {
-				return err
-			}
-			s3svc := s3.New(sess, aws.NewConfig().WithRegion("us-west-2"))
-			object, err := s3svc.GetObject(&s3.GetObjectInput{
-				Bucket: aws.String("ridecell-flavors"),
-				Key:    aws.String(args[1]),
-			})
-			if err != nil {
-				return errors.Wrap(err, "failed to download file from s3")
-			}
-			// Decompress bzip2
-			cmd.Stdin = bzip2.NewReader(object.Body)
-		}
+		return nil
+	},
+}
 
-		err = cmd.Run()
+// openFlavor opens a local flavor file, or downloads and verifies a flavor
+// from the flavors bucket into a temp file. It also returns the size and
+// whether the flavor is bzip2 compressed. Bucket flavors always are, local
+// files are passed to loadflavor as they are.
+func openFlavor(name string) (*os.File, int64, bool, func(), error) {
+	inFile, err := os.Open(name)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, 0, false, nil, err
+	}
+	if err == nil {
+		info, err := inFile.Stat()
 		if err != nil {
-			return err
+			inFile.Close()
+			return nil, 0, false, nil, err
 		}
+		return inFile, info.Size(), false, func() { inFile.Close() }, nil
+	}
+
+	// Our arg is not a file, assume it's a flavor name
+	store, err := flavor.NewStore()
+	if err != nil {
+		return nil, 0, false, nil, err
+	}
+	tempFile, err := ioutil.TempFile("", "ridectl-flavor")
+	if err != nil {
+		return nil, 0, false, nil, errors.Wrap(err, "unable to create temp file")
+	}
+	cleanup := func() {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+	}
+	bar := newProgressBar("Downloading " + name)
+	fetched, err := store.Fetch(name, tempFile, bar.Update)
+	bar.Finish()
+	if err != nil {
+		cleanup()
+		return nil, 0, false, nil, err
+	}
+	if kind, _ := flavor.ExpectedChecksum(fetched); kind == "" {
+		fmt.Fprintf(os.Stderr, "Flavor %s has no usable checksum, it could not be verified\n", name)
+	}
+	return tempFile, fetched.Size, true, cleanup, nil
+}
 
-		return nil
-	},
+// validateFlavor reads a whole flavor to make sure it decompresses, and that
+// JSON flavors parse.
+func validateFlavor(in io.Reader, name string) error {
+	if !strings.Contains(name, ".json") {
+		_, err := io.Copy(ioutil.Discard, in)
+		return errors.Wrapf(err, "flavor %s is not valid", name)
+	}
+	// Going token by token so big flavors don't have to fit in memory.
+	decoder := json.NewDecoder(in)
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF && depth == 0 {
+			return nil
+		}
+		if err == io.EOF {
+			return errors.Errorf("flavor %s is not valid: unexpected end of JSON", name)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "flavor %s is not valid", name)
+		}
+		switch token {
+		case json.Delim('['), json.Delim('{'):
+			depth++
+		case json.Delim(']'), json.Delim('}'):
+			depth--
+		}
+	}
 }
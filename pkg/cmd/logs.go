@@ -0,0 +1,184 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Ridecell/ridectl/pkg/kubernetes"
+)
+
+var logsFollowFlag bool
+var logsSinceFlag time.Duration
+var logsGrepFlag string
+var logsContainerFlag string
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+	logsCmd.Flags().BoolVarP(&logsFollowFlag, "follow", "f", false, "(optional) Keep streaming new log lines")
+	logsCmd.Flags().DurationVar(&logsSinceFlag, "since", 0, "(optional) Only show logs newer than this, like 10m or 2h")
+	logsCmd.Flags().StringVar(&logsGrepFlag, "grep", "", "(optional) Only show lines matching this regex")
+	logsCmd.Flags().StringVarP(&logsContainerFlag, "container", "c", "", "(optional) Container to read, defaults to each pod's first container")
+}
+
+// Colors for the pod name prefixes, handed out in order.
+var logsColors = []color.Attribute{color.FgCyan, color.FgGreen, color.FgYellow, color.FgMagenta, color.FgBlue, color.FgRed}
+
+var logsCmd = &cobra.Command{
+	Use:   "logs [flags] <cluster_name> [pod_type]",
+	Short: "Show logs from the pods of a Summon instance or microservice",
+	Long: `Streams the logs of every pod of a Summon instance or microservice at once, each line prefixed with the pod it came from.
+
+Shows all pod types unless one of web, celeryd, celerybeat or channelworker is given.
+Examples:
+	ridectl logs darwin-qa
+	ridectl logs darwin-qa celeryd -f --since 10m --grep ERROR`,
+	Args: func(_ *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("Cluster name argument is required")
+		}
+		if len(args) > 2 {
+			return fmt.Errorf("Too many arguments")
+		}
+		return nil
+	},
+	RunE: func(_ *cobra.Command, args []string) error {
+		target, err := kubernetes.ParseSubject(args[0])
+		if err != nil {
+			return errors.Wrap(err, "not a valid target")
+		}
+		podType := ""
+		if len(args) > 1 {
+			podType = args[1]
+		}
+		labelSelector, err := podLabelSelector(target, args[0], podType)
+		if err != nil {
+			return err
+		}
+		var grep *regexp.Regexp
+		if logsGrepFlag != "" {
+			grep, err = regexp.Compile(logsGrepFlag)
+			if err != nil {
+				return errors.Wrap(err, "invalid grep regex")
+			}
+		}
+
+		fetchObject := &kubernetes.KubeObject{Region: target.Region}
+		err = kubernetes.ListPods(kubeconfigFlag, nil, &labelSelector, target.Namespace, fetchObject)
+		if err != nil {
+			return errors.Wrap(err, "unable to find pods")
+		}
+		podList, ok := fetchObject.Top.(*corev1.PodList)
+		if !ok {
+			return errors.New("unable to convert runtime.object to corev1.podlist")
+		}
+
+		// Pad the prefixes so the log lines line up.
+		width := 0
+		for _, pod := range podList.Items {
+			if len(pod.Name) > width {
+				width = len(pod.Name)
+			}
+		}
+
+		out := &logsWriter{out: os.Stdout}
+		errs := make([]error, len(podList.Items))
+		wg := sync.WaitGroup{}
+		for i := range podList.Items {
+			pod := &podList.Items[i]
+			prefix := color.New(logsColors[i%len(logsColors)]).Sprintf("%-*s |", width, pod.Name)
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = streamPodLogs(fetchObject, pod, prefix, grep, out)
+			}(i)
+		}
+		wg.Wait()
+
+		failed := 0
+		for i, err := range errs {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", podList.Items[i].Name, err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			return errors.Errorf("unable to read logs from %d pods", failed)
+		}
+		return nil
+	},
+}
+
+// logsWriter keeps lines from different pods from getting interleaved.
+type logsWriter struct {
+	lock sync.Mutex
+	out  io.Writer
+}
+
+func (w *logsWriter) writeLine(prefix string, line string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	fmt.Fprintf(w.out, "%s %s\n", prefix, line)
+}
+
+func streamPodLogs(fetchObject *kubernetes.KubeObject, pod *corev1.Pod, prefix string, grep *regexp.Regexp, out *logsWriter) error {
+	options := &corev1.PodLogOptions{
+		Container: logsContainerFlag,
+		Follow:    logsFollowFlag,
+	}
+	if options.Container == "" && len(pod.Spec.Containers) > 0 {
+		options.Container = pod.Spec.Containers[0].Name
+	}
+	if logsSinceFlag > 0 {
+		seconds := int64(logsSinceFlag.Seconds())
+		options.SinceSeconds = &seconds
+	}
+
+	stream, err := kubernetes.GetPodLogs(fetchObject, pod, options)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	return copyLogLines(stream, prefix, grep, out)
+}
+
+// copyLogLines writes each line matching grep to out with the pod's prefix.
+func copyLogLines(in io.Reader, prefix string, grep *regexp.Regexp, out *logsWriter) error {
+	scanner := bufio.NewScanner(in)
+	// Allow long lines, like JSON logs and tracebacks.
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if grep != nil && !grep.MatchString(line) {
+			continue
+		}
+		out.writeLine(prefix, line)
+	}
+	return scanner.Err()
+}
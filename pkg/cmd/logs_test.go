@@ -0,0 +1,67 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd_test
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Ridecell/ridectl/pkg/cmd"
+	"github.com/Ridecell/ridectl/pkg/kubernetes"
+)
+
+var _ = Describe("logs", func() {
+	logs := "starting\nERROR: database is down\nretrying\nERROR: giving up\n"
+
+	It("prefixes every line", func() {
+		out := &bytes.Buffer{}
+		err := cmd.CopyLogLines(strings.NewReader(logs), "web-1 |", nil, out)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out.String()).To(Equal("web-1 | starting\nweb-1 | ERROR: database is down\nweb-1 | retrying\nweb-1 | ERROR: giving up\n"))
+	})
+
+	It("only keeps lines matching grep", func() {
+		out := &bytes.Buffer{}
+		err := cmd.CopyLogLines(strings.NewReader(logs), "web-1 |", regexp.MustCompile("^ERROR"), out)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out.String()).To(Equal("web-1 | ERROR: database is down\nweb-1 | ERROR: giving up\n"))
+	})
+
+	It("keeps long lines", func() {
+		line := strings.Repeat("x", 100*1024)
+		out := &bytes.Buffer{}
+		err := cmd.CopyLogLines(strings.NewReader(line+"\n"), "web-1 |", nil, out)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out.String()).To(Equal("web-1 | " + line + "\n"))
+	})
+
+	It("selects every pod type without one", func() {
+		summon := kubernetes.Subject{Type: "summon", Name: "darwin-qa", Env: "qa", Namespace: "summon-qa"}
+		selector, err := cmd.PodLabelSelector(summon, "darwin-qa", "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(selector).To(Equal("app.kubernetes.io/instance in (darwin-qa-web, darwin-qa-celeryd, darwin-qa-celerybeat, darwin-qa-channelworker)"))
+
+		microservice := kubernetes.Subject{Type: "microservice", Name: "svc-us-qa-dispatch", Region: "us", Env: "qa", Namespace: "dispatch"}
+		selector, err = cmd.PodLabelSelector(microservice, "svc-us-qa-dispatch", "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(selector).To(Equal("environment=qa, region=us"))
+	})
+})
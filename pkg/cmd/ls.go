@@ -17,15 +17,32 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"regexp"
+	"sort"
 	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/duration"
 
+	"github.com/Ridecell/ridectl/pkg/config"
 	"github.com/Ridecell/ridectl/pkg/kubernetes"
 )
 
+var lsVersionFlag string
+var lsStatusFlag string
+var lsContextFlag string
+var lsSortFlag string
+
 func init() {
 	rootCmd.AddCommand(lsCmd)
+	lsCmd.Flags().StringVar(&lsVersionFlag, "version", "", "(optional) Only show instances whose version or autodeploy setting matches this regex")
+	lsCmd.Flags().StringVar(&lsStatusFlag, "status", "", "(optional) Only show instances with this status")
+	lsCmd.Flags().StringVar(&lsContextFlag, "context", "", "(optional) Only show instances in a context matching this regex")
+	lsCmd.Flags().StringVar(&lsSortFlag, "sort", "name", "(optional) Sort by name, context, version, status or age")
 }
 
 var lsCmd = &cobra.Command{
@@ -33,7 +50,7 @@ var lsCmd = &cobra.Command{
 	Short: "Lists tenants that ridectl can connect to",
 	Long: "Lists all SummonPlatform instances or just instances in [environment] that ridectl" +
 		"can connect to/interact with. Note: you may be restricted depending on your permissions.\n" +
-		"Examples:\n\tridectl ls\n\tridectl ls dev\n\tridectl ls darwin-qa",
+		"Examples:\n\tridectl ls\n\tridectl ls dev\n\tridectl ls darwin-qa\n\tridectl ls qa --version master --sort age",
 	Args: func(_ *cobra.Command, args []string) error {
 		if len(args) > 1 {
 			return fmt.Errorf("ls takes at most one optional argument: [environment]")
@@ -41,44 +58,170 @@ var lsCmd = &cobra.Command{
 		return nil
 	},
 	RunE: func(_ *cobra.Command, args []string) error {
-		namespaces := []string{"summon-qa", "summon-dev", "summon-uat", "summon-prod"}
+		ridectlConfig, err := config.Get()
+		if err != nil {
+			return err
+		}
+		envs := []string{"qa", "dev", "uat", "prod"}
+		namespaces := []string{}
+		for _, env := range envs {
+			namespaces = append(namespaces, ridectlConfig.Namespace(env))
+		}
 		var nameregex string
 		if len(args) == 1 {
 			search := strings.ToLower(args[0])
 			nameregex = search
 			// If user listed an environment, only get tenants in that environment
-			if strings.HasSuffix(search, "qa") {
-				namespaces = []string{"summon-qa"}
-			} else if strings.HasSuffix(search, "dev") {
-				namespaces = []string{"summon-dev"}
-			} else if strings.HasSuffix(search, "uat") {
-				namespaces = []string{"summon-uat"}
-			} else if strings.HasSuffix(search, "prod") {
-				namespaces = []string{"summon-prod"}
-			} else {
+			namespaces = nil
+			for _, env := range envs {
+				if strings.HasSuffix(search, env) {
+					namespaces = []string{ridectlConfig.Namespace(env)}
+					break
+				}
+			}
+			if namespaces == nil {
 				return fmt.Errorf("%s not found or recognized.\n", search)
 			}
 
-			// If arg was just "qa", 'dev", "uat", "prod" or "summon-<env>",the then we actually
+			// If arg was just "qa", 'dev", "uat", "prod" or "<prefix><env>",the then we actually
 			// want to set nameregex to empty so ListSummonPlatform will traverse the proper code path.
-			for _, env := range []string{"summon-qa", "summon-dev", "summon-uat", "summon-prod", "qa", "dev", "uat", "prod"} {
-				if nameregex == env {
+			for _, env := range envs {
+				if nameregex == env || nameregex == ridectlConfig.Namespace(env) {
 					nameregex = ""
 				}
 			}
 		}
 
+		filters, err := newLsFilters()
+		if err != nil {
+			return err
+		}
+		sortInstances, err := newInstanceSort(lsSortFlag)
+		if err != nil {
+			return err
+		}
+
+		allInstances := []kubernetes.SummonPlatformItem{}
+		byNamespace := map[string][]kubernetes.SummonPlatformItem{}
 		for _, namespace := range namespaces {
 			instances, err := kubernetes.ListSummonPlatforms(kubeconfigFlag, nameregex, namespace)
 			if err != nil {
 				continue
 			}
+			instances = filters.apply(instances)
+			sortInstances(instances)
+			allInstances = append(allInstances, instances...)
+			byNamespace[namespace] = instances
+		}
 
-			fmt.Printf("\n%s\n=========================\n", strings.ToUpper(namespace))
-			for _, instance := range instances.Items {
-				fmt.Printf("%s\n", instance.Name)
+		return printOutput(allInstances, func(out io.Writer) error {
+			now := time.Now()
+			for _, namespace := range namespaces {
+				instances, ok := byNamespace[namespace]
+				if !ok || len(instances) == 0 {
+					continue
+				}
+				fmt.Fprintf(out, "\n%s\n=========================\n", strings.ToUpper(namespace))
+				w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+				fmt.Fprintf(w, "NAME\tCONTEXT\tVERSION\tSTATUS\tAGE\n")
+				for _, instance := range instances {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", instance.Name, instance.Context, instanceVersion(instance), valueOrNone(instance.Status.Status), instanceAge(instance, now))
+				}
+				w.Flush()
 			}
-		}
-		return nil
+			return nil
+		})
 	},
 }
+
+type lsFilters struct {
+	version *regexp.Regexp
+	context *regexp.Regexp
+	status  string
+}
+
+func newLsFilters() (*lsFilters, error) {
+	filters := &lsFilters{status: lsStatusFlag}
+	var err error
+	if lsVersionFlag != "" {
+		filters.version, err = regexp.Compile(lsVersionFlag)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid --version regex")
+		}
+	}
+	if lsContextFlag != "" {
+		filters.context, err = regexp.Compile(lsContextFlag)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid --context regex")
+		}
+	}
+	return filters, nil
+}
+
+func (f *lsFilters) apply(instances []kubernetes.SummonPlatformItem) []kubernetes.SummonPlatformItem {
+	filtered := []kubernetes.SummonPlatformItem{}
+	for _, instance := range instances {
+		if f.version != nil && !f.version.MatchString(instanceVersion(instance)) {
+			continue
+		}
+		if f.context != nil && !f.context.MatchString(instance.Context) {
+			continue
+		}
+		if f.status != "" && !strings.EqualFold(f.status, instance.Status.Status) {
+			continue
+		}
+		filtered = append(filtered, instance)
+	}
+	return filtered
+}
+
+// newInstanceSort returns a function sorting instances by a --sort key.
+func newInstanceSort(sortBy string) (func([]kubernetes.SummonPlatformItem), error) {
+	var key func(kubernetes.SummonPlatformItem) string
+	switch sortBy {
+	case "name":
+		key = func(i kubernetes.SummonPlatformItem) string { return i.Name }
+	case "context":
+		key = func(i kubernetes.SummonPlatformItem) string { return i.Context }
+	case "version":
+		key = instanceVersion
+	case "status":
+		key = func(i kubernetes.SummonPlatformItem) string { return i.Status.Status }
+	case "age":
+		// Newest first, same as the AGE column reads top to bottom.
+		return func(instances []kubernetes.SummonPlatformItem) {
+			sort.SliceStable(instances, func(i, j int) bool {
+				return instances[j].CreationTimestamp.Before(&instances[i].CreationTimestamp)
+			})
+		}, nil
+	default:
+		return nil, errors.Errorf("unknown sort %s, must be name, context, version, status or age", sortBy)
+	}
+	return func(instances []kubernetes.SummonPlatformItem) {
+		sort.SliceStable(instances, func(i, j int) bool {
+			return key(instances[i]) < key(instances[j])
+		})
+	}, nil
+}
+
+// instanceVersion shows the pinned version, or the branch being autodeployed.
+func instanceVersion(instance kubernetes.SummonPlatformItem) string {
+	if instance.Spec.AutoDeploy != "" {
+		return "autodeploy:" + instance.Spec.AutoDeploy
+	}
+	return valueOrNone(instance.Spec.Version)
+}
+
+func instanceAge(instance kubernetes.SummonPlatformItem, now time.Time) string {
+	if instance.CreationTimestamp.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(now.Sub(instance.CreationTimestamp.Time))
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
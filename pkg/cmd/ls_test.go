@@ -0,0 +1,116 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd_test
+
+import (
+	"time"
+
+	summonv1beta1 "github.com/Ridecell/ridecell-operator/pkg/apis/summon/v1beta1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Ridecell/ridectl/pkg/cmd"
+	"github.com/Ridecell/ridectl/pkg/kubernetes"
+)
+
+var _ = Describe("ls", func() {
+	var instances []kubernetes.SummonPlatformItem
+	now := time.Now()
+
+	instance := func(name string, context string, version string, autoDeploy string, status string, age time.Duration) kubernetes.SummonPlatformItem {
+		item := kubernetes.SummonPlatformItem{Context: context}
+		item.Name = name
+		item.CreationTimestamp = metav1.NewTime(now.Add(-age))
+		item.Spec = summonv1beta1.SummonPlatformSpec{Version: version, AutoDeploy: autoDeploy}
+		item.Status.Status = status
+		return item
+	}
+	names := func(instances []kubernetes.SummonPlatformItem) []string {
+		result := []string{}
+		for _, instance := range instances {
+			result = append(result, instance.Name)
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		instances = []kubernetes.SummonPlatformItem{
+			instance("darwin-qa", "us-qa", "1-abcdef0", "", "Ready", 3*time.Hour),
+			instance("alpha-qa", "eu-qa", "", "master", "Error", time.Hour),
+			instance("bravo-qa", "us-qa", "2-1234567", "", "ready", 2*time.Hour),
+		}
+	})
+
+	Context("filters", func() {
+		It("keeps everything without flags", func() {
+			filtered, err := cmd.FilterInstances("", "", "", instances)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(names(filtered)).To(Equal([]string{"darwin-qa", "alpha-qa", "bravo-qa"}))
+		})
+
+		It("matches versions and autodeploy branches", func() {
+			filtered, err := cmd.FilterInstances("^1-", "", "", instances)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(names(filtered)).To(Equal([]string{"darwin-qa"}))
+			filtered, err = cmd.FilterInstances("master", "", "", instances)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(names(filtered)).To(Equal([]string{"alpha-qa"}))
+		})
+
+		It("matches contexts and statuses", func() {
+			filtered, err := cmd.FilterInstances("", "^us-", "READY", instances)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(names(filtered)).To(Equal([]string{"darwin-qa", "bravo-qa"}))
+		})
+
+		It("rejects invalid regexes", func() {
+			_, err := cmd.FilterInstances("(", "", "", instances)
+			Expect(err).To(MatchError(ContainSubstring("invalid --version regex")))
+			_, err = cmd.FilterInstances("", "[", "", instances)
+			Expect(err).To(MatchError(ContainSubstring("invalid --context regex")))
+		})
+	})
+
+	Context("sorting", func() {
+		It("sorts by name", func() {
+			sortInstances, err := cmd.NewInstanceSort("name")
+			Expect(err).ToNot(HaveOccurred())
+			sortInstances(instances)
+			Expect(names(instances)).To(Equal([]string{"alpha-qa", "bravo-qa", "darwin-qa"}))
+		})
+
+		It("sorts by version with autodeploy branches", func() {
+			sortInstances, err := cmd.NewInstanceSort("version")
+			Expect(err).ToNot(HaveOccurred())
+			sortInstances(instances)
+			Expect(names(instances)).To(Equal([]string{"darwin-qa", "bravo-qa", "alpha-qa"}))
+		})
+
+		It("sorts by age newest first", func() {
+			sortInstances, err := cmd.NewInstanceSort("age")
+			Expect(err).ToNot(HaveOccurred())
+			sortInstances(instances)
+			Expect(names(instances)).To(Equal([]string{"alpha-qa", "bravo-qa", "darwin-qa"}))
+		})
+
+		It("rejects unknown keys", func() {
+			_, err := cmd.NewInstanceSort("size")
+			Expect(err).To(MatchError(ContainSubstring("unknown sort size")))
+		})
+	})
+})
@@ -0,0 +1,85 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var outputFlag string
+
+// outputFormats are the --output formats every command supports.
+var outputFormats = []string{"json", "yaml", "table"}
+
+// extraOutputFormats is the command annotation listing the comma separated
+// formats it supports on top of outputFormats. The command's help should
+// describe them.
+const extraOutputFormats = "ridectl.output-formats"
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&outputFlag, "output", "o", "table", "(optional) Output format for read commands: json, yaml or table, some commands support more as described in their help")
+}
+
+// checkOutputFormat makes sure --output is a format cmd supports.
+func checkOutputFormat(cmd *cobra.Command) error {
+	formats := outputFormats
+	if extra, ok := cmd.Annotations[extraOutputFormats]; ok {
+		formats = append(strings.Split(extra, ","), formats...)
+	}
+	for _, format := range formats {
+		if outputFlag == format {
+			return nil
+		}
+	}
+	return errors.Errorf("unknown output format %s, must be one of %s", outputFlag, strings.Join(formats, ", "))
+}
+
+// printOutput writes data in the format picked with --output. The table
+// format is whatever human readable text the command printed before.
+func printOutput(data interface{}, table func(out io.Writer) error) error {
+	return writeOutput(os.Stdout, outputFlag, data, table)
+}
+
+func writeOutput(out io.Writer, format string, data interface{}, table func(out io.Writer) error) error {
+	switch format {
+	case "json":
+		encoded, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "error encoding JSON")
+		}
+		_, err = out.Write(append(encoded, '\n'))
+		return err
+	case "yaml":
+		encoded, err := yaml.Marshal(data)
+		if err != nil {
+			return errors.Wrap(err, "error encoding YAML")
+		}
+		_, err = out.Write(encoded)
+		return err
+	case "table", "":
+		return table(out)
+	default:
+		return errors.Errorf("unknown output format %s, must be json, yaml or table", format)
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/cobra"
+
+	"github.com/Ridecell/ridectl/pkg/cmd"
+)
+
+var _ = Describe("output", func() {
+	type item struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	data := []item{{Name: "summon-qa", Version: "1-abcdef0"}}
+	table := func(out io.Writer) error {
+		_, err := fmt.Fprintf(out, "summon-qa 1-abcdef0\n")
+		return err
+	}
+
+	Context("writeOutput", func() {
+		It("writes JSON", func() {
+			out := &bytes.Buffer{}
+			Expect(cmd.WriteOutput(out, "json", data, table)).To(Succeed())
+			Expect(out.String()).To(MatchJSON(`[{"name": "summon-qa", "version": "1-abcdef0"}]`))
+			Expect(out.String()).To(HaveSuffix("\n"))
+		})
+
+		It("writes YAML", func() {
+			out := &bytes.Buffer{}
+			Expect(cmd.WriteOutput(out, "yaml", data, table)).To(Succeed())
+			Expect(out.String()).To(MatchYAML("- name: summon-qa\n  version: 1-abcdef0\n"))
+		})
+
+		It("writes the table by default", func() {
+			for _, format := range []string{"table", ""} {
+				out := &bytes.Buffer{}
+				Expect(cmd.WriteOutput(out, format, data, table)).To(Succeed())
+				Expect(out.String()).To(Equal("summon-qa 1-abcdef0\n"))
+			}
+		})
+
+		It("rejects unknown formats", func() {
+			err := cmd.WriteOutput(&bytes.Buffer{}, "xml", data, table)
+			Expect(err).To(MatchError(ContainSubstring("unknown output format xml")))
+		})
+	})
+
+	Context("checkOutputFormat", func() {
+		AfterEach(func() {
+			cmd.SetOutputFlag("table")
+		})
+
+		It("accepts the common formats on every command", func() {
+			for _, format := range []string{"json", "yaml", "table"} {
+				cmd.SetOutputFlag(format)
+				Expect(cmd.CheckOutputFormat(&cobra.Command{})).To(Succeed())
+			}
+		})
+
+		It("accepts extra formats only on commands declaring them", func() {
+			cmd.SetOutputFlag("csv")
+			err := cmd.CheckOutputFormat(&cobra.Command{})
+			Expect(err).To(MatchError("unknown output format csv, must be one of json, yaml, table"))
+
+			withCSV := &cobra.Command{Annotations: map[string]string{cmd.ExtraOutputFormats: "csv"}}
+			Expect(cmd.CheckOutputFormat(withCSV)).To(Succeed())
+			cmd.SetOutputFlag("name")
+			err = cmd.CheckOutputFormat(withCSV)
+			Expect(err).To(MatchError("unknown output format name, must be one of csv, json, yaml, table"))
+		})
+	})
+})
@@ -18,6 +18,7 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -31,6 +32,11 @@ func init() {
 	rootCmd.AddCommand(passwordCmd)
 }
 
+type passwordOutput struct {
+	Instance string `json:"instance"`
+	Password string `json:"password"`
+}
+
 var passwordCmd = &cobra.Command{
 	Use:   "password [flags] <cluster_name>",
 	Short: "Gets dispatcher password from a Summon Instance",
@@ -60,7 +66,10 @@ var passwordCmd = &cobra.Command{
 			return errors.New("unable to convert to secret object")
 		}
 
-		fmt.Printf("Password for %s: %s\n", args[0], string(secret.Data["password"]))
-		return nil
+		output := passwordOutput{Instance: args[0], Password: string(secret.Data["password"])}
+		return printOutput(output, func(out io.Writer) error {
+			_, err := fmt.Fprintf(out, "Password for %s: %s\n", output.Instance, output.Password)
+			return err
+		})
 	},
 }
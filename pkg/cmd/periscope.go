@@ -17,6 +17,7 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -32,6 +33,15 @@ func init() {
 	rootCmd.AddCommand(periscopeCmd)
 }
 
+type periscopeOutput struct {
+	Type     string `json:"type"`
+	Host     string `json:"host"`
+	Port     uint16 `json:"port"`
+	Database string `json:"database"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
 var periscopeCmd = &cobra.Command{
 	Use:   "periscope <cluster_name>",
 	Short: "Dumps Periscope data to setup database.",
@@ -80,13 +90,23 @@ var periscopeCmd = &cobra.Command{
 			return errors.New("unable to get PostgresDatabase object")
 		}
 
-		fmt.Printf("Periscope Data\n================\n")
-		fmt.Printf("Database Type: Postgres\n") // Hard code-y
-		fmt.Printf("Database Host: %s\n", database.Status.Connection.Host)
-		fmt.Printf("Database Port: %d\n", database.Status.Connection.Port)
-		fmt.Printf("Database Name: %s\n", database.Status.Connection.Database)
-		fmt.Printf("Database Username: periscope\n")
-		fmt.Printf("Database Password: %s\n\n", string(secret.Data["password"]))
-		return nil
+		output := periscopeOutput{
+			Type:     "Postgres", // Hard code-y
+			Host:     database.Status.Connection.Host,
+			Port:     database.Status.Connection.Port,
+			Database: database.Status.Connection.Database,
+			Username: "periscope",
+			Password: string(secret.Data["password"]),
+		}
+		return printOutput(output, func(out io.Writer) error {
+			fmt.Fprintf(out, "Periscope Data\n================\n")
+			fmt.Fprintf(out, "Database Type: %s\n", output.Type)
+			fmt.Fprintf(out, "Database Host: %s\n", output.Host)
+			fmt.Fprintf(out, "Database Port: %d\n", output.Port)
+			fmt.Fprintf(out, "Database Name: %s\n", output.Database)
+			fmt.Fprintf(out, "Database Username: %s\n", output.Username)
+			fmt.Fprintf(out, "Database Password: %s\n\n", output.Password)
+			return nil
+		})
 	},
 }
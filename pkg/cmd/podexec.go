@@ -0,0 +1,220 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	osexec "os/exec"
+	"strings"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	utilexec "k8s.io/client-go/util/exec"
+
+	"github.com/Ridecell/ridectl/pkg/exec"
+	"github.com/Ridecell/ridectl/pkg/kubernetes"
+)
+
+var podTypeFlag string
+var podRegexFlag string
+var containerFlag string
+
+var podTypes = []string{"web", "celeryd", "celerybeat", "channelworker"}
+
+// addPodFlags adds the flags for picking which pod and container to use.
+func addPodFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&podTypeFlag, "pod-type", "web", fmt.Sprintf("(optional) Type of pod to connect to: %s", strings.Join(podTypes, ", ")))
+	cmd.Flags().StringVar(&podRegexFlag, "pod", "", "(optional) Regex the pod name must match")
+	cmd.Flags().StringVarP(&containerFlag, "container", "c", "", "(optional) Container to use, defaults to the pod's first container")
+}
+
+// podLabelSelector builds the label selector for the pods of an instance. An
+// empty pod type selects pods of every type.
+func podLabelSelector(target kubernetes.Subject, instance string, podType string) (string, error) {
+	if podType != "" {
+		validType := false
+		for _, knownType := range podTypes {
+			validType = validType || knownType == podType
+		}
+		if !validType {
+			return "", errors.Errorf("unknown pod type %s, must be one of %s", podType, strings.Join(podTypes, ", "))
+		}
+	}
+
+	if target.Type == "summon" {
+		if podType == "" {
+			instances := []string{}
+			for _, knownType := range podTypes {
+				instances = append(instances, fmt.Sprintf("%s-%s", instance, knownType))
+			}
+			return fmt.Sprintf("app.kubernetes.io/instance in (%s)", strings.Join(instances, ", ")), nil
+		}
+		return fmt.Sprintf("app.kubernetes.io/instance=%s-%s", instance, podType), nil
+	} else if target.Type == "microservice" {
+		if podType == "" {
+			return fmt.Sprintf("environment=%s, region=%s", target.Env, target.Region), nil
+		}
+		return fmt.Sprintf("environment=%s, region=%s, role=%s", target.Env, target.Region, podType), nil
+	}
+	return "", fmt.Errorf("Cannot find pod without knowing the target's type: %#v", target)
+}
+
+// findTargetPod finds a ready pod of an instance picked with the pod flags.
+// When several match and pick is set, the user picks one if there is a
+// terminal.
+func findTargetPod(instance string, pick bool) (*kubernetes.KubeObject, *corev1.Pod, error) {
+	target, err := kubernetes.ParseSubject(instance)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "not a valid target")
+	}
+
+	labelSelector, err := podLabelSelector(target, instance, podTypeFlag)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var nameRegex *string
+	if podRegexFlag != "" {
+		nameRegex = &podRegexFlag
+	}
+	fetchObject := &kubernetes.KubeObject{Region: target.Region}
+	err = kubernetes.GetPods(kubeconfigFlag, nameRegex, &labelSelector, target.Namespace, fetchObject)
+	if err != nil {
+		description := "pod"
+		if podTypeFlag != "" {
+			description = podTypeFlag + " pod"
+		}
+		if nameRegex != nil {
+			description += " matching " + *nameRegex
+		}
+		return nil, nil, errors.Wrapf(err, "unable to find a ready %s for %s", description, instance)
+	}
+	podList, ok := fetchObject.Top.(*corev1.PodList)
+	if !ok {
+		return nil, nil, errors.New("unable to convert runtime.object to corev1.podlist")
+	}
+
+	var choose func(items []string) (int, error)
+	if pick && terminal.IsTerminal(int(os.Stdin.Fd())) {
+		choose = func(items []string) (int, error) {
+			prompt := promptui.Select{
+				Label: "Select a pod",
+				Items: items,
+			}
+			i, _, err := prompt.Run()
+			return i, err
+		}
+	}
+	pod, err := pickPod(podList.Items, choose)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = checkContainer(pod, containerFlag)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fetchObject, pod, nil
+}
+
+// pickPod lets choose pick one of several pods from a description of each,
+// without choose the first pod is used.
+func pickPod(pods []corev1.Pod, choose func(items []string) (int, error)) (*corev1.Pod, error) {
+	if len(pods) == 0 {
+		return nil, errors.New("no pods to pick from")
+	}
+	if choose == nil || len(pods) == 1 {
+		return &pods[0], nil
+	}
+	items := []string{}
+	for _, item := range pods {
+		items = append(items, fmt.Sprintf("%s (%s, started %s ago)", item.Name, item.Spec.NodeName, duration.HumanDuration(time.Since(item.CreationTimestamp.Time))))
+	}
+	i, err := choose(items)
+	if err != nil {
+		return nil, err
+	}
+	return &pods[i], nil
+}
+
+// checkContainer makes sure the pod has the container, an empty name means
+// the pod's first container.
+func checkContainer(pod *corev1.Pod, container string) error {
+	if container == "" {
+		return nil
+	}
+	names := []string{}
+	for _, podContainer := range pod.Spec.Containers {
+		if podContainer.Name == container {
+			return nil
+		}
+		names = append(names, podContainer.Name)
+	}
+	return errors.Errorf("pod %s has no container %s, must be one of %s", pod.Name, container, strings.Join(names, ", "))
+}
+
+// execInPod runs a command in a pod through the API server, falling back to
+// kubectl exec if that can't be set up. If the command fails, the error is an
+// exitStatusError with the same status.
+func execInPod(fetchObject *kubernetes.KubeObject, pod *corev1.Pod, container string, command []string, stdin io.Reader) error {
+	err := kubernetes.ExecPod(fetchObject, pod, kubernetes.ExecOptions{
+		Command:   command,
+		Container: container,
+		Stdin:     stdin,
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+	})
+	if kubernetes.IsExecUnavailable(err) {
+		fmt.Fprintf(os.Stderr, "Unable to exec through the API server, falling back to kubectl: %v\n", err)
+		return kubectlExec(fetchObject, pod, container, command, stdin)
+	}
+	if exitErr, ok := err.(utilexec.ExitError); ok {
+		return exitStatusError{status: exitErr.ExitStatus()}
+	}
+	return err
+}
+
+func kubectlExec(fetchObject *kubernetes.KubeObject, pod *corev1.Pod, container string, command []string, stdin io.Reader) error {
+	kubectlArgs := []string{"kubectl", "exec", "--context", fetchObject.Context.Name, "-n", pod.Namespace, pod.Name}
+	if container != "" {
+		kubectlArgs = append(kubectlArgs, "-c", container)
+	}
+	if stdin == os.Stdin {
+		if terminal.IsTerminal(int(os.Stdin.Fd())) {
+			kubectlArgs = append(kubectlArgs, "-it")
+		} else {
+			kubectlArgs = append(kubectlArgs, "-i")
+		}
+		// Nothing to feed in, so kubectl can take over the process.
+		return exec.Exec(append(append(kubectlArgs, "--"), command...))
+	}
+
+	if stdin != nil {
+		kubectlArgs = append(kubectlArgs, "-i")
+	}
+	cmd := osexec.Command(kubectlArgs[0], append(append(kubectlArgs[1:], "--"), command...)...)
+	cmd.Stdin = stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Ridecell/ridectl/pkg/cmd"
+	"github.com/Ridecell/ridectl/pkg/kubernetes"
+)
+
+var _ = Describe("pod exec", func() {
+	summon := kubernetes.Subject{Type: "summon", Name: "darwin-qa", Env: "qa", Namespace: "summon-qa"}
+	microservice := kubernetes.Subject{Type: "microservice", Name: "svc-us-qa-dispatch", Region: "us", Env: "qa", Namespace: "dispatch"}
+
+	Context("podLabelSelector", func() {
+		It("selects summon pods by type", func() {
+			selector, err := cmd.PodLabelSelector(summon, "darwin-qa", "celeryd")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(selector).To(Equal("app.kubernetes.io/instance=darwin-qa-celeryd"))
+		})
+
+		It("selects microservice pods by role", func() {
+			selector, err := cmd.PodLabelSelector(microservice, "svc-us-qa-dispatch", "web")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(selector).To(Equal("environment=qa, region=us, role=web"))
+		})
+
+		It("rejects unknown pod types", func() {
+			_, err := cmd.PodLabelSelector(summon, "darwin-qa", "worker")
+			Expect(err).To(MatchError("unknown pod type worker, must be one of web, celeryd, celerybeat, channelworker"))
+		})
+
+		It("rejects targets without a type", func() {
+			_, err := cmd.PodLabelSelector(kubernetes.Subject{}, "darwin-qa", "web")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("pickPod", func() {
+		pods := []corev1.Pod{
+			{ObjectMeta: metav1.ObjectMeta{Name: "darwin-qa-web-1"}, Spec: corev1.PodSpec{NodeName: "node-a"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "darwin-qa-web-2"}, Spec: corev1.PodSpec{NodeName: "node-b"}},
+		}
+
+		It("uses the first pod without a chooser", func() {
+			pod, err := cmd.PickPod(pods, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pod.Name).To(Equal("darwin-qa-web-1"))
+		})
+
+		It("doesn't ask when there is one pod", func() {
+			pod, err := cmd.PickPod(pods[1:], func([]string) (int, error) {
+				Fail("asked to choose a single pod")
+				return 0, nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pod.Name).To(Equal("darwin-qa-web-2"))
+		})
+
+		It("uses the chosen pod", func() {
+			var offered []string
+			pod, err := cmd.PickPod(pods, func(items []string) (int, error) {
+				offered = items
+				return 1, nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pod.Name).To(Equal("darwin-qa-web-2"))
+			Expect(offered).To(HaveLen(2))
+			Expect(offered[0]).To(HavePrefix("darwin-qa-web-1 (node-a, started "))
+			Expect(offered[1]).To(HavePrefix("darwin-qa-web-2 (node-b, started "))
+		})
+
+		It("fails when choosing fails", func() {
+			_, err := cmd.PickPod(pods, func([]string) (int, error) {
+				return 0, errors.New("^C")
+			})
+			Expect(err).To(MatchError("^C"))
+		})
+
+		It("fails without pods", func() {
+			_, err := cmd.PickPod(nil, nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("checkContainer", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "darwin-qa-web-1"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "default"}, {Name: "cloudsql-proxy"}}},
+		}
+
+		It("accepts the pod's containers or none", func() {
+			Expect(cmd.CheckContainer(pod, "cloudsql-proxy")).To(Succeed())
+			Expect(cmd.CheckContainer(pod, "")).To(Succeed())
+		})
+
+		It("lists the containers when one is missing", func() {
+			err := cmd.CheckContainer(pod, "web")
+			Expect(err).To(MatchError("pod darwin-qa-web-1 has no container web, must be one of default, cloudsql-proxy"))
+		})
+	})
+})
@@ -0,0 +1,83 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const progressBarWidth = 30
+
+// progressBar draws a progress bar on stderr when it is a terminal.
+type progressBar struct {
+	label   string
+	enabled bool
+	drawn   time.Time
+}
+
+func newProgressBar(label string) *progressBar {
+	return &progressBar{label: label, enabled: terminal.IsTerminal(int(os.Stderr.Fd()))}
+}
+
+// Update redraws the bar, at most ten times a second. A total of 0 means the
+// size is unknown and only the count is shown.
+func (b *progressBar) Update(done int64, total int64) {
+	if !b.enabled || (done < total && time.Since(b.drawn) < 100*time.Millisecond) {
+		return
+	}
+	b.drawn = time.Now()
+	if total <= 0 {
+		fmt.Fprintf(os.Stderr, "\r%s %s\x1b[K", b.label, formatSize(done))
+		return
+	}
+	if done > total {
+		done = total
+	}
+	filled := int(progressBarWidth * done / total)
+	fmt.Fprintf(os.Stderr, "\r%s [%s%s] %3d%% %s / %s\x1b[K", b.label, strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled), 100*done/total, formatSize(done), formatSize(total))
+}
+
+// Finish ends the bar's line, so later output starts on its own.
+func (b *progressBar) Finish() {
+	if b.enabled && !b.drawn.IsZero() {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// progressReader counts what is read through it and updates a progress bar
+// if there is one.
+type progressReader struct {
+	io.Reader
+	done  int64
+	total int64
+	bar   *progressBar
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.done += int64(n)
+	if r.bar != nil {
+		r.bar.Update(r.done, r.total)
+	}
+	return n, err
+}
@@ -18,18 +18,14 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
-	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
-
-	"github.com/Ridecell/ridectl/pkg/exec"
-	"github.com/Ridecell/ridectl/pkg/kubernetes"
-
-	corev1 "k8s.io/api/core/v1"
 )
 
 func init() {
 	rootCmd.AddCommand(pyShellCmd)
+	addPodFlags(pyShellCmd)
 }
 
 var pyShellCmd = &cobra.Command{
@@ -45,34 +41,14 @@ var pyShellCmd = &cobra.Command{
 		}
 		return nil
 	},
-	RunE: func(_ *cobra.Command, args []string) error {
-		target, err := kubernetes.ParseSubject(args[0])
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fetchObject, pod, err := findTargetPod(args[0], true)
 		if err != nil {
-			return errors.Wrap(err, "not a valid target")
+			return err
 		}
 
-		var labelSelector string
-		if target.Type == "summon" {
-			labelSelector = fmt.Sprintf("app.kubernetes.io/instance=%s-web", args[0])
-		} else if target.Type == "microservice" {
-			labelSelector = fmt.Sprintf("environment=%s, region=%s, role=web", target.Env, target.Region)
-		} else {
-			return fmt.Errorf("Cannot find pod without knowing the target's type: %#v", target)
-		}
-		fetchObject := &kubernetes.KubeObject{}
-		err = kubernetes.GetPod(kubeconfigFlag, nil, &labelSelector, target.Namespace, fetchObject)
-		if err != nil {
-			return errors.Wrap(err, "unable to find pod")
-		}
-
-		pod, ok := fetchObject.Top.(*corev1.Pod)
-		if !ok {
-			return errors.New("unable to convert runtime.object to corev1.pod")
-		}
 		fmt.Printf("Connecting to %s/%s\n", pod.Namespace, pod.Name)
 
-		// Spawn kubectl exec.
-		kubectlArgs := []string{"kubectl", "exec", "-it", "-n", pod.Namespace, pod.Name, "--context", fetchObject.Context.Name, "--", "bash", "-l", "-c", "python manage.py shell"}
-		return exec.Exec(kubectlArgs)
+		return silenceExitStatus(cmd, execInPod(fetchObject, pod, containerFlag, []string{"bash", "-l", "-c", "python manage.py shell"}, os.Stdin))
 	},
 }
@@ -19,22 +19,33 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"time"
 
 	"github.com/Ridecell/ridectl/pkg/kubernetes"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
 	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+var migrationsNoWaitFlag bool
+var migrationsTimeoutFlag time.Duration
+
 func init() {
 	rootCmd.AddCommand(restartMigrationsCmd)
+	restartMigrationsCmd.Flags().BoolVar(&migrationsNoWaitFlag, "no-wait", false, "(optional) Exit after deleting the job instead of following the new one")
+	restartMigrationsCmd.Flags().DurationVar(&migrationsTimeoutFlag, "timeout", 30*time.Minute, "(optional) How long to wait for the migrations to finish")
 }
 
 var restartMigrationsCmd = &cobra.Command{
 	Use:   "restart-migrations [flags] <cluster_name> ",
 	Short: "Restart migrations for target summon instance.",
-	Long:  "Restart migrations for target summon instance.",
+	Long:  "Restart migrations for target summon instance. Waits for the operator to start the migrations again and shows their output, exiting with an error if they fail.",
 	Args: func(_ *cobra.Command, args []string) error {
 		if len(args) == 0 {
 			return fmt.Errorf("Cluster name argument is required")
@@ -64,11 +75,51 @@ var restartMigrationsCmd = &cobra.Command{
 
 		fmt.Printf("Restarting migrations for %s\n", args[0])
 
-		err = fetchObject.Client.Delete(context.Background(), job)
+		// Take the old pods along, otherwise they are left behind.
+		err = fetchObject.Client.Delete(context.Background(), job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil {
+			return err
+		}
+		if migrationsNoWaitFlag {
+			return nil
+		}
+
+		deadline := time.Now().Add(migrationsTimeoutFlag)
+		fmt.Printf("Waiting for the migrations job to be recreated\n")
+		newJob, err := kubernetes.WaitForRecreatedJob(fetchObject, job, time.Until(deadline))
+		if err != nil {
+			return err
+		}
+		pod, err := kubernetes.WaitForJobPod(fetchObject, newJob, time.Until(deadline))
 		if err != nil {
 			return err
 		}
+		fmt.Printf("Following logs from %s\n", pod.Name)
+		stream, err := kubernetes.GetPodLogs(fetchObject, pod, &corev1.PodLogOptions{Follow: true})
+		if err != nil {
+			return errors.Wrap(err, "unable to read migration logs")
+		}
+		_, err = io.Copy(os.Stdout, stream)
+		stream.Close()
+		if err != nil {
+			return errors.Wrap(err, "error reading migration logs")
+		}
 
+		err = kubernetes.WaitForJob(fetchObject, newJob, time.Until(deadline))
+		if err != nil {
+			// The pod usually knows more about what went wrong than the job.
+			getErr := kubernetes.GetObjectWithClient(fetchObject.Client, pod.Name, pod.Namespace, pod)
+			if getErr == nil {
+				for _, status := range pod.Status.ContainerStatuses {
+					terminated := status.State.Terminated
+					if terminated != nil && terminated.ExitCode != 0 {
+						return errors.Errorf("%v, container %s exited with code %d (%s)", err, status.Name, terminated.ExitCode, terminated.Reason)
+					}
+				}
+			}
+			return err
+		}
+		fmt.Printf("Migrations finished\n")
 		return nil
 	},
 }
@@ -17,28 +17,34 @@ limitations under the License.
 package cmd
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"html/template"
+	"strings"
 	"time"
 
-	"github.com/Ridecell/ridectl/pkg/exec"
 	"github.com/Ridecell/ridectl/pkg/kubernetes"
 	"github.com/pkg/errors"
-	"github.com/shurcooL/httpfs/vfsutil"
 	"github.com/spf13/cobra"
 
 	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/util/retry"
 )
 
+var restartTimeoutFlag time.Duration
+
 func init() {
 	rootCmd.AddCommand(rollingRestartCmd)
+	rollingRestartCmd.Flags().DurationVar(&restartTimeoutFlag, "timeout", 10*time.Minute, "(optional) How long to wait for the restarted pods to become available")
 }
 
 var rollingRestartCmd = &cobra.Command{
-	Use:   "restart [flags] <cluster_name> <pod_type>",
+	Use:   "restart [flags] <cluster_name> <pod_type>...",
 	Short: "Performs a rolling restart of pods.",
-	Long:  `Restarts all pods of a certain type (web|celeryd|etc).`,
+	Long: `Restarts all pods of one or more types (web|celeryd|etc), or every type with "all", and waits until the new pods are available.
+Examples:
+	ridectl restart darwin-qa web
+	ridectl restart darwin-qa web celeryd --timeout 20m
+	ridectl restart darwin-qa all`,
 	Args: func(_ *cobra.Command, args []string) error {
 		if len(args) == 0 {
 			return fmt.Errorf("Cluster name argument is required.")
@@ -46,9 +52,6 @@ var rollingRestartCmd = &cobra.Command{
 		if len(args) == 1 {
 			return fmt.Errorf("Deployment type argument is required.")
 		}
-		if len(args) > 2 {
-			return fmt.Errorf("Too many arguments")
-		}
 		return nil
 	},
 	RunE: func(_ *cobra.Command, args []string) error {
@@ -56,44 +59,81 @@ var rollingRestartCmd = &cobra.Command{
 		if err != nil {
 			return errors.Wrap(err, "not a valid target")
 		}
-		objectName := fmt.Sprintf("%s-%s", args[0], args[1])
-
-		fetchObject := &kubernetes.KubeObject{
-			Top: &appsv1.Deployment{},
-		}
-		err = kubernetes.GetObject(kubeconfigFlag, objectName, target.Namespace, fetchObject)
-		if err != nil {
-			return errors.Wrap(err, "unable to find deployment")
+		restartAll := len(args) == 2 && args[1] == "all"
+		podTypeArgs := args[1:]
+		if restartAll {
+			podTypeArgs = podTypes
 		}
 
-		deployment, ok := fetchObject.Top.(*appsv1.Deployment)
-		if !ok {
-			return errors.New("unable to convert runtime.object to corev1.pod")
+		timestamp := time.Now().UTC().Format(time.RFC3339)
+		restarted := []*kubernetes.KubeObject{}
+		for _, podType := range podTypeArgs {
+			objectName := fmt.Sprintf("%s-%s", args[0], podType)
+
+			fetchObject := &kubernetes.KubeObject{
+				Top: &appsv1.Deployment{},
+			}
+			err = kubernetes.GetObject(kubeconfigFlag, objectName, target.Namespace, fetchObject)
+			if err != nil {
+				if restartAll {
+					// Not every instance runs every type of pod.
+					continue
+				}
+				return errors.Wrapf(err, "unable to find deployment %s", objectName)
+			}
+
+			deployment, ok := fetchObject.Top.(*appsv1.Deployment)
+			if !ok {
+				return errors.New("unable to convert runtime.object to appsv1.Deployment")
+			}
+
+			fmt.Printf("Initiating rolling restart of pods belonging to %s/%s\n", deployment.Namespace, deployment.Name)
+			err = restartDeployment(fetchObject, deployment, timestamp)
+			if err != nil {
+				return err
+			}
+			restarted = append(restarted, fetchObject)
+		}
+		if len(restarted) == 0 {
+			return errors.Errorf("unable to find any deployments for %s", args[0])
 		}
 
-		templateData, err := vfsutil.ReadFile(Templates, "rolling_restart.json.tpl")
-		if err != nil {
-			return errors.Wrap(err, "error reading rolling_restart.json.tpl")
+		// The deployments roll out at the same time, so they share one deadline.
+		deadline := time.Now().Add(restartTimeoutFlag)
+		failed := []string{}
+		for _, fetchObject := range restarted {
+			deployment := fetchObject.Top.(*appsv1.Deployment)
+			err = kubernetes.WaitForRollout(fetchObject, deployment, time.Until(deadline), func(message string) {
+				fmt.Printf("%s: %s\n", deployment.Name, message)
+			})
+			if err != nil {
+				fmt.Printf("%s: %v\n", deployment.Name, err)
+				failed = append(failed, deployment.Name)
+			}
 		}
-		restartTemplate, err := template.New("rolling_restart.json").Parse(string(templateData))
-		if err != nil {
-			return errors.Wrap(err, "failed to parse restart template")
+		if len(failed) > 0 {
+			return errors.Errorf("restart did not finish for %s", strings.Join(failed, ", "))
 		}
+		return nil
+	},
+}
 
-		buffer := &bytes.Buffer{}
-		err = restartTemplate.Execute(buffer, struct {
-			Timestamp string
-		}{
-			Timestamp: time.Now().UTC().Format(time.RFC3339),
-		})
+// restartDeployment changes an annotation on the pod template, which makes
+// the deployment roll out new pods.
+func restartDeployment(fetchObject *kubernetes.KubeObject, deployment *appsv1.Deployment, timestamp string) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := kubernetes.GetObjectWithClient(fetchObject.Client, deployment.Name, deployment.Namespace, deployment)
 		if err != nil {
-			return errors.Wrap(err, "unable to execute template")
+			return err
 		}
-
-		fmt.Printf("Initiating rolling restart of pods belonging to %s/%s\n", deployment.Namespace, deployment.Name)
-
-		// Spawn kubectl exec.
-		kubectlArgs := []string{"kubectl", "patch", "deployment", "-n", deployment.Namespace, deployment.Name, "--context", fetchObject.Context.Name, "-p", buffer.String()}
-		return exec.Exec(kubectlArgs)
-	},
+		if deployment.Spec.Template.Annotations == nil {
+			deployment.Spec.Template.Annotations = map[string]string{}
+		}
+		deployment.Spec.Template.Annotations["lastManualRestart"] = timestamp
+		return fetchObject.Client.Update(context.Background(), deployment)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "unable to restart deployment %s", deployment.Name)
+	}
+	return nil
 }
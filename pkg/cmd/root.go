@@ -36,6 +36,9 @@ var version string
 var rootCmd = &cobra.Command{
 	Use:   "ridectl",
 	Short: "Ridectl controls Summon instances in Kubernetes",
+	PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+		return checkOutputFormat(cmd)
+	},
 	RunE: func(_ *cobra.Command, args []string) error {
 		if versionFlag {
 			fmt.Printf("ridectl version %s\n", version)
@@ -58,7 +61,37 @@ func init() {
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
+		if exitErr, ok := err.(exitStatusError); ok {
+			os.Exit(exitErr.status)
+		}
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
+
+// exitStatusError is returned by commands that should make ridectl exit with
+// a status other than 1, like the one of a command run in a pod. Returning it
+// instead of exiting right away lets deferred cleanup run.
+type exitStatusError struct {
+	status int
+}
+
+func (e exitStatusError) Error() string {
+	return fmt.Sprintf("exit status %d", e.status)
+}
+
+// silentFailure is returned by commands that already printed why they failed,
+// so ridectl exits with status 1 and nothing else.
+func silentFailure(cmd *cobra.Command) error {
+	return silenceExitStatus(cmd, exitStatusError{status: 1})
+}
+
+// silenceExitStatus stops cobra from printing err and the usage for cmd if err
+// is an exitStatusError, whatever failed has already said why.
+func silenceExitStatus(cmd *cobra.Command, err error) error {
+	if _, ok := err.(exitStatusError); ok {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+	}
+	return err
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/cobra"
+
+	"github.com/Ridecell/ridectl/pkg/cmd"
+)
+
+var _ = Describe("exit status", func() {
+	It("silences commands exiting with a status", func() {
+		command := &cobra.Command{}
+		err := cmd.SilenceExitStatus(command, cmd.ExitStatusError(3))
+		Expect(err).To(MatchError("exit status 3"))
+		Expect(cmd.ExitStatus(err)).To(Equal(3))
+		Expect(command.SilenceErrors).To(BeTrue())
+		Expect(command.SilenceUsage).To(BeTrue())
+	})
+
+	It("leaves other errors to be printed", func() {
+		command := &cobra.Command{}
+		err := cmd.SilenceExitStatus(command, errors.New("no pods found"))
+		Expect(err).To(MatchError("no pods found"))
+		Expect(command.SilenceErrors).To(BeFalse())
+		Expect(command.SilenceUsage).To(BeFalse())
+		Expect(cmd.SilenceExitStatus(command, nil)).To(Succeed())
+		Expect(command.SilenceErrors).To(BeFalse())
+	})
+})
@@ -0,0 +1,253 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Ridecell/ridectl/pkg/cmd/edit"
+	"github.com/Ridecell/ridectl/pkg/lint"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var rotateDryRunFlag bool
+var rotateConcurrencyFlag int
+var rotateKeyIdFlag string
+
+func init() {
+	rootCmd.AddCommand(rotateKeyCmd)
+	rotateKeyCmd.Flags().BoolVar(&rotateDryRunFlag, "dry-run", false, "(optional) Only report which files and keys would change")
+	rotateKeyCmd.Flags().IntVarP(&rotateConcurrencyFlag, "concurrency", "j", 4, "(optional) Number of files to process at once")
+	rotateKeyCmd.Flags().StringVarP(&rotateKeyIdFlag, "key", "k", "", "(optional) KMS key ID to use instead of the one from .keys.yml")
+}
+
+var rotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key [flags] <path>...",
+	Short: "Re-encrypt manifests with their configured key",
+	Long: `Re-encrypts every EncryptedSecret whose values were encrypted with a different key than the one .keys.yml now resolves to.
+
+Defaults to the current directory when no paths are given.`,
+	Args: cobra.ArbitraryArgs,
+	RunE: func(_ *cobra.Command, args []string) error {
+		if rotateConcurrencyFlag < 1 {
+			return errors.New("concurrency must be at least 1")
+		}
+
+		var fileNames []string
+		var err error
+		if len(args) > 0 {
+			fileNames, err = lint.Files(args)
+		} else {
+			var cwd string
+			cwd, err = os.Getwd()
+			if err == nil {
+				fileNames, err = lint.Files([]string{cwd})
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		cipher, err := newCipher()
+		if err != nil {
+			return err
+		}
+		r := &keyRotator{cipher: cipher, dryRun: rotateDryRunFlag, keyIds: edit.NewKeyIdCache(cipher)}
+
+		// Fan the files out to a fixed number of workers so KMS calls stay bounded.
+		results := make([]rotateResult, len(fileNames))
+		jobs := make(chan int)
+		wg := sync.WaitGroup{}
+		for i := 0; i < rotateConcurrencyFlag; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := range jobs {
+					changes, err := r.rotate(fileNames[j])
+					results[j] = rotateResult{filename: fileNames[j], changes: changes, err: err}
+				}
+			}()
+		}
+		for i := range fileNames {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+
+		verb := "Rotated"
+		summary := "%d of %d files rotated\n"
+		if rotateDryRunFlag {
+			verb = "Would rotate"
+			summary = "%d of %d files need rotation\n"
+		}
+		changed := 0
+		failed := 0
+		for _, result := range results {
+			if result.err != nil {
+				fmt.Printf("%s: %v\n", result.filename, result.err)
+				failed++
+				continue
+			}
+			for _, change := range result.changes {
+				fmt.Printf("%s %s %s from %s to %s: %s\n", verb, result.filename, change.name, change.oldKeyId, change.newKeyId, strings.Join(change.keys, ", "))
+			}
+			if len(result.changes) > 0 {
+				changed++
+			}
+		}
+		fmt.Printf(summary, changed, len(fileNames))
+		if failed > 0 {
+			return errors.Errorf("%d files failed", failed)
+		}
+		return nil
+	},
+}
+
+type rotateChange struct {
+	name     string
+	oldKeyId string
+	newKeyId string
+	keys     []string
+}
+
+type rotateResult struct {
+	filename string
+	changes  []rotateChange
+	err      error
+}
+
+type keyRotator struct {
+	cipher edit.Cipher
+	dryRun bool
+	keyIds *edit.KeyIdCache
+}
+
+func (r *keyRotator) rotate(filename string) ([]rotateChange, error) {
+	keyId := rotateKeyIdFlag
+	if keyId == "" {
+		var err error
+		keyId, err = edit.FindKeyId(filename)
+		if err != nil {
+			return nil, errors.Wrap(err, "error finding key ID")
+		}
+		if keyId == "" {
+			// No key configured, nothing to rotate to.
+			return nil, nil
+		}
+	}
+	targetKeyId, err := r.keyIds.CanonicalKeyId(keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	inFile, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	inManifest, err := edit.NewManifest(inFile)
+	inFile.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding manifest")
+	}
+	err = inManifest.Decrypt(r.cipher)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decrypting manifest")
+	}
+
+	// Find the secrets that are on a different key.
+	var changes []rotateChange
+	stale := map[string]bool{}
+	for _, obj := range inManifest {
+		if obj.Kind == "" || obj.KeyId == "" || obj.KeyId == targetKeyId {
+			continue
+		}
+		keys := []string{}
+		for key := range obj.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		name := fmt.Sprintf("%s/%s", obj.Meta.GetNamespace(), obj.Meta.GetName())
+		changes = append(changes, rotateChange{name: name, oldKeyId: obj.KeyId, newKeyId: keyId, keys: keys})
+		stale[name] = true
+	}
+	if len(changes) == 0 || r.dryRun {
+		return changes, nil
+	}
+
+	// Round trip through the decrypted text like edit does, so everything else is untouched.
+	manifestBuf := bytes.Buffer{}
+	err = inManifest.Serialize(&manifestBuf)
+	if err != nil {
+		return nil, errors.Wrap(err, "error serializing manifest")
+	}
+	afterManifest, err := edit.NewManifest(&manifestBuf)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding decrypted YAML")
+	}
+	afterManifest.CorrelateWith(inManifest)
+	for _, obj := range afterManifest {
+		rotate := stale[fmt.Sprintf("%s/%s", obj.Meta.GetNamespace(), obj.Meta.GetName())]
+		err = obj.Encrypt(r.cipher, keyId, rotate, rotate)
+		if err != nil {
+			return nil, errors.Wrap(err, "error encrypting manifest")
+		}
+	}
+
+	err = replaceManifest(filename, afterManifest)
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// replaceManifest writes a manifest to a temp file next to filename and
+// renames it into place, so a failed write never leaves a truncated file.
+func replaceManifest(filename string, manifest edit.Manifest) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	// Hidden, so it's skipped by lint and rotate-key if it is ever left behind.
+	outFile, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".")
+	if err != nil {
+		return errors.Wrap(err, "error creating temp file")
+	}
+	err = manifest.Serialize(outFile)
+	if err == nil {
+		err = outFile.Chmod(info.Mode())
+	}
+	closeErr := outFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(outFile.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(outFile.Name())
+		return errors.Wrap(err, "error writing manifest")
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Ridecell/ridectl/pkg/kubernetes"
+)
+
+var runJobFlag bool
+var runTimeoutFlag time.Duration
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+	addPodFlags(runCmd)
+	runCmd.Flags().BoolVar(&runJobFlag, "job", false, "(optional) Run in a new Job cloned from the web deployment instead of an existing pod")
+	runCmd.Flags().DurationVar(&runTimeoutFlag, "timeout", 5*time.Minute, "(optional) How long to wait for the Job's pod to start, and for it to exit once its logs end")
+}
+
+var runCmd = &cobra.Command{
+	Use:   "run [flags] <cluster_name> -- <command> [args...]",
+	Short: "Run a manage.py command on a Summon instance",
+	Long: `Runs python manage.py with the given arguments on a Summon instance and exits with the command's exit code. Input piped into ridectl is passed to the command.
+
+With --job the command runs in a new Job using the web deployment's pod spec, so long running commands are not cut off when the web pods are replaced. Input is not passed to Jobs, and the Job is deleted once the command exits or ridectl is interrupted.
+Examples:
+	ridectl run darwin-qa -- migrate --plan
+	ridectl run darwin-qa --job -- rebuild_index --noinput`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("Cluster name argument is required")
+		}
+		if len(args) == 1 {
+			return fmt.Errorf("Command argument is required")
+		}
+		if cmd.ArgsLenAtDash() > 1 {
+			return fmt.Errorf("Too many arguments before --")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		command := append([]string{"python", "manage.py"}, args[1:]...)
+		if runJobFlag {
+			return silenceExitStatus(cmd, runInJob(args[0], command))
+		}
+
+		fetchObject, pod, err := findTargetPod(args[0], false)
+		if err != nil {
+			return err
+		}
+		// Only pass stdin along when something is piped in, there is no TTY.
+		var stdin io.Reader
+		if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+			stdin = os.Stdin
+		}
+		return silenceExitStatus(cmd, execInPod(fetchObject, pod, containerFlag, command, stdin))
+	},
+}
+
+func runInJob(instance string, command []string) error {
+	target, err := kubernetes.ParseSubject(instance)
+	if err != nil {
+		return errors.Wrap(err, "not a valid target")
+	}
+	if target.Type != "summon" {
+		return errors.New("--job is only supported for Summon instances")
+	}
+	fetchObject := &kubernetes.KubeObject{
+		Top: &appsv1.Deployment{},
+	}
+	err = kubernetes.GetObject(kubeconfigFlag, fmt.Sprintf("%s-web", instance), target.Namespace, fetchObject)
+	if err != nil {
+		return errors.Wrap(err, "unable to find web deployment")
+	}
+	deployment, ok := fetchObject.Top.(*appsv1.Deployment)
+	if !ok {
+		return errors.New("unable to convert runtime.object to appsv1.Deployment")
+	}
+
+	if len(deployment.Spec.Template.Spec.Containers) == 0 {
+		return errors.New("web deployment has no containers")
+	}
+	job := newRunJob(deployment, instance, command)
+	err = fetchObject.Client.Create(context.Background(), job)
+	if err != nil {
+		return errors.Wrap(err, "unable to create job")
+	}
+	fmt.Fprintf(os.Stderr, "Started job %s/%s\n", job.Namespace, job.Name)
+
+	// The job is only needed for the output, so it's removed afterwards, also
+	// when ridectl is interrupted.
+	defer func() {
+		err := fetchObject.Client.Delete(context.Background(), job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to delete job %s: %v\n", job.Name, err)
+		}
+	}()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	type result struct {
+		exitCode int
+		err      error
+	}
+	results := make(chan result, 1)
+	go func() {
+		exitCode, err := followRunJob(fetchObject, job)
+		results <- result{exitCode: exitCode, err: err}
+	}()
+
+	select {
+	case <-signals:
+		return exitStatusError{status: 1}
+	case result := <-results:
+		if result.err != nil {
+			return result.err
+		}
+		if result.exitCode != 0 {
+			return exitStatusError{status: result.exitCode}
+		}
+		return nil
+	}
+}
+
+// followRunJob prints the logs of a job's pod and returns its exit code.
+func followRunJob(fetchObject *kubernetes.KubeObject, job *batchv1.Job) (int, error) {
+	pod, err := kubernetes.WaitForJobPod(fetchObject, job, runTimeoutFlag)
+	if err != nil {
+		return 0, err
+	}
+	// Follow the logs until the command exits, then look up how it went.
+	stream, err := kubernetes.GetPodLogs(fetchObject, pod, &corev1.PodLogOptions{Follow: true})
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to read job logs")
+	}
+	_, err = io.Copy(os.Stdout, stream)
+	stream.Close()
+	if err != nil {
+		return 0, errors.Wrap(err, "error reading job logs")
+	}
+	return kubernetes.WaitForContainerExit(fetchObject, pod, runTimeoutFlag)
+}
+
+// newRunJob builds a Job running a command with the web deployment's pod spec.
+func newRunJob(deployment *appsv1.Deployment, instance string, command []string) *batchv1.Job {
+	podSpec := deployment.Spec.Template.Spec.DeepCopy()
+	// Sidecars would keep the Job running forever, so only keep the main container.
+	container := podSpec.Containers[0]
+	container.Command = command
+	container.Args = nil
+	container.Ports = nil
+	container.LivenessProbe = nil
+	container.ReadinessProbe = nil
+	podSpec.Containers = []corev1.Container{container}
+	podSpec.RestartPolicy = corev1.RestartPolicyNever
+
+	// Not reusing the web labels, so the pod doesn't get traffic from the web service.
+	labels := map[string]string{
+		"app.kubernetes.io/instance":  fmt.Sprintf("%s-run", instance),
+		"app.kubernetes.io/part-of":   instance,
+		"app.kubernetes.io/component": "run",
+	}
+	backoffLimit := int32(0)
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-run-%d", instance, time.Now().Unix()),
+			Namespace: deployment.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      labels,
+					Annotations: deployment.Spec.Template.Annotations,
+				},
+				Spec: *podSpec,
+			},
+		},
+	}
+}
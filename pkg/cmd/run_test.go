@@ -0,0 +1,94 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Ridecell/ridectl/pkg/cmd"
+)
+
+var _ = Describe("run", func() {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "darwin-qa-web", Namespace: "summon-qa"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      map[string]string{"app.kubernetes.io/instance": "darwin-qa-web"},
+					Annotations: map[string]string{"iam.amazonaws.com/role": "darwin-qa"},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:           "default",
+							Image:          "summon:1-abcdef0",
+							Command:        []string{"gunicorn"},
+							Args:           []string{"summon.wsgi"},
+							Ports:          []corev1.ContainerPort{{ContainerPort: 8000}},
+							LivenessProbe:  &corev1.Probe{},
+							ReadinessProbe: &corev1.Probe{},
+						},
+						{Name: "cloudsql-proxy", Image: "cloudsql-proxy"},
+					},
+					RestartPolicy: corev1.RestartPolicyAlways,
+				},
+			},
+		},
+	}
+
+	It("runs the command in the main container only", func() {
+		job := cmd.NewRunJob(deployment, "darwin-qa", []string{"python", "manage.py", "migrate"})
+		Expect(job.Namespace).To(Equal("summon-qa"))
+		Expect(job.Name).To(HavePrefix("darwin-qa-run-"))
+		Expect(*job.Spec.BackoffLimit).To(BeEquivalentTo(0))
+
+		podSpec := job.Spec.Template.Spec
+		Expect(podSpec.RestartPolicy).To(Equal(corev1.RestartPolicyNever))
+		Expect(podSpec.Containers).To(HaveLen(1))
+		container := podSpec.Containers[0]
+		Expect(container.Name).To(Equal("default"))
+		Expect(container.Image).To(Equal("summon:1-abcdef0"))
+		Expect(container.Command).To(Equal([]string{"python", "manage.py", "migrate"}))
+		Expect(container.Args).To(BeNil())
+		Expect(container.Ports).To(BeNil())
+		Expect(container.LivenessProbe).To(BeNil())
+		Expect(container.ReadinessProbe).To(BeNil())
+	})
+
+	It("uses its own labels and keeps the annotations", func() {
+		job := cmd.NewRunJob(deployment, "darwin-qa", []string{"true"})
+		Expect(job.Spec.Template.Labels).To(Equal(map[string]string{
+			"app.kubernetes.io/instance":  "darwin-qa-run",
+			"app.kubernetes.io/part-of":   "darwin-qa",
+			"app.kubernetes.io/component": "run",
+		}))
+		Expect(job.Labels).To(Equal(job.Spec.Template.Labels))
+		Expect(job.Spec.Template.Annotations).To(Equal(map[string]string{"iam.amazonaws.com/role": "darwin-qa"}))
+	})
+
+	It("leaves the deployment alone", func() {
+		cmd.NewRunJob(deployment, "darwin-qa", []string{"true"})
+		Expect(deployment.Spec.Template.Spec.Containers).To(HaveLen(2))
+		Expect(deployment.Spec.Template.Spec.Containers[0].Command).To(Equal([]string{"gunicorn"}))
+		Expect(deployment.Spec.Template.Spec.Containers[0].LivenessProbe).ToNot(BeNil())
+		Expect(deployment.Spec.Template.Spec.RestartPolicy).To(Equal(corev1.RestartPolicyAlways))
+	})
+})
@@ -0,0 +1,275 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/Ridecell/ridectl/pkg/cmd/edit"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var secretFileFlag string
+var secretNameFlag string
+var secretFromFileFlag string
+var secretStdinFlag bool
+
+func init() {
+	rootCmd.AddCommand(secretCmd)
+	secretCmd.AddCommand(secretGetCmd)
+	secretCmd.AddCommand(secretSetCmd)
+	secretCmd.AddCommand(secretUnsetCmd)
+
+	secretCmd.PersistentFlags().StringVarP(&secretFileFlag, "file", "f", "", "(optional) Path to the manifest file")
+	secretCmd.PersistentFlags().StringVar(&secretNameFlag, "name", "", "(optional) Name of the EncryptedSecret if the file has more than one")
+	secretSetCmd.Flags().StringVar(&secretFromFileFlag, "from-file", "", "(optional) Read the value from a file")
+	secretSetCmd.Flags().BoolVar(&secretStdinFlag, "stdin", false, "(optional) Read the value from stdin")
+}
+
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "Read or change single secret values",
+	Long:  `Read or change single values in an instance manifest without opening an editor`,
+}
+
+var secretGetCmd = &cobra.Command{
+	Use:   "get [flags] <cluster_name> <key>",
+	Short: "Print a decrypted secret value",
+	Args:  secretArgs(1, 1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		filename, args, err := secretFilename(args)
+		if err != nil {
+			return err
+		}
+		manifest, _, err := loadSecretManifest(filename)
+		if err != nil {
+			return err
+		}
+		obj, err := findSecretObject(manifest)
+		if err != nil {
+			return err
+		}
+		value, ok := obj.Data[args[0]]
+		if !ok {
+			return errors.Errorf("key %s not found", args[0])
+		}
+		if !strings.HasSuffix(value, "\n") {
+			value += "\n"
+		}
+		fmt.Print(value)
+		return nil
+	},
+}
+
+var secretSetCmd = &cobra.Command{
+	Use:   "set [flags] <cluster_name> <key> [value]",
+	Short: "Set a secret value",
+	Long: `Set a secret value, encrypting only that value and leaving the rest of the file alone.
+
+The value is taken from the last argument, --from-file or --stdin.`,
+	Args: secretArgs(1, 2),
+	RunE: func(_ *cobra.Command, args []string) error {
+		filename, args, err := secretFilename(args)
+		if err != nil {
+			return err
+		}
+		value, err := secretValue(args[1:])
+		if err != nil {
+			return err
+		}
+		return updateSecret(filename, func(obj *edit.Object) error {
+			return obj.SetKey(args[0], value)
+		})
+	},
+}
+
+var secretUnsetCmd = &cobra.Command{
+	Use:   "unset [flags] <cluster_name> <key>",
+	Short: "Remove a secret value",
+	Args:  secretArgs(1, 1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		filename, args, err := secretFilename(args)
+		if err != nil {
+			return err
+		}
+		return updateSecret(filename, func(obj *edit.Object) error {
+			return obj.RemoveKey(args[0])
+		})
+	},
+}
+
+// secretArgs validates the arguments, which start with the instance name
+// unless --file was passed.
+func secretArgs(min, max int) cobra.PositionalArgs {
+	return func(_ *cobra.Command, args []string) error {
+		offset := 0
+		if secretFileFlag == "" {
+			offset = 1
+		}
+		if len(args) < min+offset {
+			if secretFileFlag == "" {
+				return fmt.Errorf("Cluster name and key arguments are required")
+			}
+			return fmt.Errorf("Key argument is required")
+		}
+		if len(args) > max+offset {
+			return fmt.Errorf("Too many arguments")
+		}
+		return nil
+	}
+}
+
+// secretFilename works out which file to use and returns the remaining args.
+func secretFilename(args []string) (string, []string, error) {
+	if secretFileFlag != "" {
+		return secretFileFlag, args, nil
+	}
+	filename, err := findManifest(args[0])
+	if err != nil {
+		return "", nil, err
+	}
+	if filename == "" {
+		return "", nil, errors.Errorf("no manifest found for %s", args[0])
+	}
+	return filename, args[1:], nil
+}
+
+// secretValue reads the new value from exactly one of the possible sources.
+func secretValue(args []string) (string, error) {
+	sources := len(args)
+	if secretFromFileFlag != "" {
+		sources++
+	}
+	if secretStdinFlag {
+		sources++
+	}
+	if sources != 1 {
+		return "", errors.New("exactly one of a value argument, --from-file or --stdin is required")
+	}
+
+	switch {
+	case len(args) == 1:
+		return args[0], nil
+	case secretFromFileFlag != "":
+		value, err := ioutil.ReadFile(secretFromFileFlag)
+		if err != nil {
+			return "", errors.Wrapf(err, "error reading %s", secretFromFileFlag)
+		}
+		return string(value), nil
+	default:
+		value, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return "", errors.Wrap(err, "error reading stdin")
+		}
+		return string(value), nil
+	}
+}
+
+func loadSecretManifest(filename string) (edit.Manifest, edit.Cipher, error) {
+	inFile, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error reading input file %s", filename)
+	}
+	defer inFile.Close()
+
+	manifest, err := edit.NewManifest(inFile)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error decoding input YAML")
+	}
+	cipher, err := newCipher()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = manifest.Decrypt(cipher)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error decrypting input manifest")
+	}
+	return manifest, cipher, nil
+}
+
+// findSecretObject picks the secret to work on, using --name if there is more
+// than one in the manifest.
+func findSecretObject(manifest edit.Manifest) (*edit.Object, error) {
+	var found *edit.Object
+	for _, obj := range manifest {
+		if obj.Kind == "" {
+			continue
+		}
+		if secretNameFlag != "" && obj.Meta.GetName() != secretNameFlag {
+			continue
+		}
+		if found != nil {
+			return nil, errors.New("found multiple secrets, use --name to pick one")
+		}
+		found = obj
+	}
+	if found == nil {
+		return nil, errors.New("no matching secret found")
+	}
+	return found, nil
+}
+
+// updateSecret runs an update on the secret in a manifest and writes it back
+// out. Values that didn't change keep their existing ciphertext.
+func updateSecret(filename string, update func(*edit.Object) error) error {
+	inManifest, cipher, err := loadSecretManifest(filename)
+	if err != nil {
+		return err
+	}
+
+	// Round trip through the decrypted text, same as edit does with the tempfile.
+	manifestBuf := bytes.Buffer{}
+	err = inManifest.Serialize(&manifestBuf)
+	if err != nil {
+		return errors.Wrap(err, "error serializing manifest")
+	}
+	afterManifest, err := edit.NewManifest(&manifestBuf)
+	if err != nil {
+		return errors.Wrap(err, "error decoding decrypted YAML")
+	}
+	afterManifest.CorrelateWith(inManifest)
+
+	obj, err := findSecretObject(afterManifest)
+	if err != nil {
+		return err
+	}
+	err = update(obj)
+	if err != nil {
+		return err
+	}
+
+	keyId, err := edit.FindKeyId(filename)
+	if err != nil {
+		return errors.Wrap(err, "error finding key ID")
+	}
+	err = afterManifest.Encrypt(cipher, keyId, false, false)
+	if err != nil {
+		return errors.Wrap(err, "error encrypting after manifest")
+	}
+
+	outFile, err := os.Create(filename)
+	if err != nil {
+		return errors.Wrapf(err, "error opening %s for writing", filename)
+	}
+	defer outFile.Close()
+	return afterManifest.Serialize(outFile)
+}
@@ -18,24 +18,22 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
-	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
-
-	"github.com/Ridecell/ridectl/pkg/exec"
-	"github.com/Ridecell/ridectl/pkg/kubernetes"
-
-	corev1 "k8s.io/api/core/v1"
 )
 
 func init() {
 	rootCmd.AddCommand(shellCmd)
+	addPodFlags(shellCmd)
 }
 
 var shellCmd = &cobra.Command{
 	Use:   "shell [flags] <cluster_name>",
 	Short: "Open a shell on a Summon instance or microservice",
-	Long:  `Open an interactive bash terminal on a Summon instance or microservice running on Kubernetes`,
+	Long: `Open an interactive bash terminal on a Summon instance or microservice running on Kubernetes.
+
+Connects to a web pod by default, use --pod-type to pick another kind of pod and --pod to narrow it down by name. If several pods match you are asked which one to use.`,
 	Args: func(_ *cobra.Command, args []string) error {
 		if len(args) == 0 {
 			return fmt.Errorf("Cluster name argument is required")
@@ -45,38 +43,16 @@ var shellCmd = &cobra.Command{
 		}
 		return nil
 	},
-	RunE: func(_ *cobra.Command, args []string) error {
-		target, err := kubernetes.ParseSubject(args[0])
-		if err != nil {
-			return errors.Wrap(err, "not a valid target")
-		}
-
-		var labelSelector string
-		if target.Type == "summon" {
-			labelSelector = fmt.Sprintf("app.kubernetes.io/instance=%s-web", args[0])
-		} else if target.Type == "microservice" {
-			labelSelector = fmt.Sprintf("environment=%s, region=%s, role=web", target.Env, target.Region)
-		} else {
-			return fmt.Errorf("Cannot find pod without knowing the target's type: %#v", target)
-		}
-
-		fetchObject := &kubernetes.KubeObject{}
-		err = kubernetes.GetPod(kubeconfigFlag, nil, &labelSelector, target.Namespace, fetchObject)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fetchObject, pod, err := findTargetPod(args[0], true)
 		if err != nil {
-			return errors.Wrap(err, "unable to find pod")
-		}
-
-		pod, ok := fetchObject.Top.(*corev1.Pod)
-		if !ok {
-			return errors.New("unable to convert runtime.object to corev1.pod")
+			return err
 		}
 
 		fmt.Printf("Connecting to %s/%s\n", pod.Namespace, pod.Name)
 		// Warn people that this is a container.
 		fmt.Printf("Remember that this is a container and most changes will have no effect\n")
 
-		// Spawn kubectl exec.
-		kubectlArgs := []string{"kubectl", "exec", "--context", fetchObject.Context.Name, "-it", "-n", pod.Namespace, pod.Name, "--", "bash", "-l"}
-		return exec.Exec(kubectlArgs)
+		return silenceExitStatus(cmd, execInPod(fetchObject, pod, containerFlag, []string{"bash", "-l"}, os.Stdin))
 	},
 }
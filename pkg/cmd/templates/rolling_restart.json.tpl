@@ -1,11 +0,0 @@
-{
-  "spec": {
-    "template": {
-      "metadata": {
-        "annotations": {
-          "lastManualRestart": "{{ .Timestamp }}"
-        }
-      }
-    }
-  }
-}
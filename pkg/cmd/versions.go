@@ -19,6 +19,7 @@ package cmd
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"net/http"
 	"os/exec"
 	"regexp"
@@ -35,15 +36,17 @@ func init() {
 }
 
 type parsedTag struct {
-	tag, sha, branch string
-	build            int
+	Tag    string `json:"tag"`
+	Sha    string `json:"sha"`
+	Branch string `json:"branch"`
+	Build  int    `json:"build"`
 }
 
 type byBuild []parsedTag
 
 func (a byBuild) Len() int           { return len(a) }
 func (a byBuild) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a byBuild) Less(i, j int) bool { return a[i].build > a[j].build }
+func (a byBuild) Less(i, j int) bool { return a[i].Build > a[j].Build }
 
 var versionsCmd = &cobra.Command{
 	Use:   "versions [flags] [branch]",
@@ -94,7 +97,7 @@ var versionsCmd = &cobra.Command{
 			if err != nil {
 				panic(err)
 			}
-			parsedTags = append(parsedTags, parsedTag{tag: tag, build: build, sha: parts[2], branch: parts[3]})
+			parsedTags = append(parsedTags, parsedTag{Tag: tag, Build: build, Sha: parts[2], Branch: parts[3]})
 		}
 
 		// Check which mode we are in.
@@ -102,9 +105,9 @@ var versionsCmd = &cobra.Command{
 			// Show the latest build on important branches (master, ^release)
 			byBranch := map[string]parsedTag{}
 			for _, parsed := range parsedTags {
-				existing, ok := byBranch[parsed.branch]
-				if !ok || parsed.build > existing.build {
-					byBranch[parsed.branch] = parsed
+				existing, ok := byBranch[parsed.Branch]
+				if !ok || parsed.Build > existing.Build {
+					byBranch[parsed.Branch] = parsed
 				}
 			}
 			branchRegexp := regexp.MustCompile(`^(master$|release)`)
@@ -115,11 +118,16 @@ var versionsCmd = &cobra.Command{
 				}
 			}
 			sort.Strings(branches)
+			latestTags := []parsedTag{}
 			for _, b := range branches {
-				parsed := byBranch[b]
-				fmt.Printf("%s: %s\n", parsed.branch, parsed.tag)
+				latestTags = append(latestTags, byBranch[b])
 			}
-
+			return printOutput(latestTags, func(out io.Writer) error {
+				for _, parsed := range latestTags {
+					fmt.Fprintf(out, "%s: %s\n", parsed.Branch, parsed.Tag)
+				}
+				return nil
+			})
 		} else {
 			// Show the past 10 builds on a branch matching this substring.
 			branchRegexp, err := regexp.Compile(args[0])
@@ -128,19 +136,20 @@ var versionsCmd = &cobra.Command{
 			}
 			matchingTags := byBuild{}
 			for _, parsed := range parsedTags {
-				if branchRegexp.MatchString(parsed.branch) {
+				if branchRegexp.MatchString(parsed.Branch) {
 					matchingTags = append(matchingTags, parsed)
 				}
 			}
 			sort.Sort(matchingTags)
-			for i, parsed := range matchingTags {
-				fmt.Println(parsed.tag)
-				if i > 10 {
-					break
-				}
+			if len(matchingTags) > 12 {
+				matchingTags = matchingTags[:12]
 			}
+			return printOutput(matchingTags, func(out io.Writer) error {
+				for _, parsed := range matchingTags {
+					fmt.Fprintln(out, parsed.Tag)
+				}
+				return nil
+			})
 		}
-
-		return nil
 	},
 }
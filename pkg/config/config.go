@@ -0,0 +1,228 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// Cluster is a Kubernetes cluster ridectl should know about. Region is the
+// prefix of instances and manifest directories in it, like us in us-prod.
+type Cluster struct {
+	Name   string `json:"name"`
+	Region string `json:"region,omitempty"`
+	Server string `json:"server"`
+}
+
+// Config is the user level ridectl configuration from ~/.ridectl/config.yaml.
+type Config struct {
+	// Clusters are checked and set up by ridectl doctor. Contexts pointing at
+	// one of their servers are always searched.
+	Clusters []Cluster `json:"clusters"`
+	// HostPatterns are regular expressions for API server URLs of other
+	// contexts that should be searched for instances.
+	HostPatterns []string `json:"hostPatterns"`
+	// NamespacePrefix is put in front of the environment to get the namespace
+	// of a summon instance. It can be set to "" to use the environment as is.
+	NamespacePrefix string `json:"namespacePrefix"`
+	// Flavors is where database flavors are stored.
+	Flavors Flavors `json:"flavors"`
+	// KMS is the AWS KMS region used for encrypted manifests.
+	KMS KMS `json:"kms"`
+
+	hostRegexps []*regexp.Regexp
+}
+
+// Flavors is the S3 bucket holding database flavors.
+type Flavors struct {
+	Bucket string `json:"bucket"`
+	Region string `json:"region"`
+}
+
+// KMS configures the AWS KMS client.
+type KMS struct {
+	Region string `json:"region"`
+}
+
+// Default is used for anything not set in the config file or environment.
+var Default = Config{
+	Clusters: []Cluster{
+		{Name: "ridecell-aws-us-sandbox", Region: "us", Server: "https://api.us-sandbox.kops.ridecell.io"},
+		{Name: "ridecell-aws-us-prod", Region: "us", Server: "https://api.us-prod.kops.ridecell.io"},
+		{Name: "ridecell-aws-eu-prod", Region: "eu", Server: "https://api.eu-prod.kops.ridecell.io"},
+		{Name: "ridecell-aws-in-prod", Region: "in", Server: "https://api.in-prod.kops.ridecell.io"},
+	},
+	HostPatterns:    []string{`\.kops\.ridecell\.io`},
+	NamespacePrefix: "summon-",
+	Flavors: Flavors{
+		Bucket: "ridecell-flavors",
+		Region: "us-west-2",
+	},
+	KMS: KMS{
+		Region: "us-west-1",
+	},
+}
+
+var loadOnce sync.Once
+var loaded *Config
+var loadErr error
+
+// Get returns the configuration, loading it the first time it is needed.
+func Get() (*Config, error) {
+	loadOnce.Do(func() {
+		loaded, loadErr = Load()
+	})
+	return loaded, loadErr
+}
+
+// Load reads the config file and applies environment overrides on top. The
+// file path can be changed with $RIDECTL_CONFIG, and a missing file just
+// means the defaults.
+func Load() (*Config, error) {
+	path := os.Getenv("RIDECTL_CONFIG")
+	if path == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return nil, errors.Wrap(err, "error finding home directory")
+		}
+		path = filepath.Join(home, ".ridectl", "config.yaml")
+	}
+
+	// The prefix can be set to "", so its default can't be filled in after.
+	cfg := &Config{NamespacePrefix: Default.NamespacePrefix}
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "error reading %s", path)
+	}
+	if err == nil {
+		err = yaml.UnmarshalStrict(data, cfg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s", path)
+		}
+	}
+
+	err = cfg.applyEnv()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Clusters == nil {
+		cfg.Clusters = Default.Clusters
+	}
+	if cfg.HostPatterns == nil {
+		cfg.HostPatterns = Default.HostPatterns
+	}
+	if cfg.Flavors.Bucket == "" {
+		cfg.Flavors.Bucket = Default.Flavors.Bucket
+	}
+	if cfg.Flavors.Region == "" {
+		cfg.Flavors.Region = Default.Flavors.Region
+	}
+	if cfg.KMS.Region == "" {
+		cfg.KMS.Region = Default.KMS.Region
+	}
+
+	for _, pattern := range cfg.HostPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid host pattern %s", pattern)
+		}
+		cfg.hostRegexps = append(cfg.hostRegexps, re)
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides settings from $RIDECTL_CLUSTERS (comma separated
+// name=server pairs), $RIDECTL_HOST_PATTERNS (comma separated),
+// $RIDECTL_NAMESPACE_PREFIX, $RIDECTL_FLAVOR_BUCKET, $RIDECTL_FLAVOR_REGION and
+// $RIDECTL_KMS_REGION.
+func (c *Config) applyEnv() error {
+	if value, ok := os.LookupEnv("RIDECTL_CLUSTERS"); ok {
+		c.Clusters = []Cluster{}
+		for _, entry := range splitList(value) {
+			parts := strings.SplitN(entry, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return errors.Errorf("invalid RIDECTL_CLUSTERS entry %s, must be name=server", entry)
+			}
+			c.Clusters = append(c.Clusters, Cluster{Name: parts[0], Server: parts[1]})
+		}
+	}
+	if value, ok := os.LookupEnv("RIDECTL_HOST_PATTERNS"); ok {
+		c.HostPatterns = splitList(value)
+	}
+	if value, ok := os.LookupEnv("RIDECTL_NAMESPACE_PREFIX"); ok {
+		c.NamespacePrefix = value
+	}
+	if value := os.Getenv("RIDECTL_FLAVOR_BUCKET"); value != "" {
+		c.Flavors.Bucket = value
+	}
+	if value := os.Getenv("RIDECTL_FLAVOR_REGION"); value != "" {
+		c.Flavors.Region = value
+	}
+	if value := os.Getenv("RIDECTL_KMS_REGION"); value != "" {
+		c.KMS.Region = value
+	}
+	return nil
+}
+
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// AllowsHost checks if ridectl should look for instances on an API server.
+func (c *Config) AllowsHost(host string) bool {
+	if c.ClusterForHost(host) != nil {
+		return true
+	}
+	for _, re := range c.hostRegexps {
+		if re.MatchString(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClusterForHost returns the configured cluster with an API server, or nil if
+// it isn't one of them.
+func (c *Config) ClusterForHost(host string) *Cluster {
+	for i, cluster := range c.Clusters {
+		if strings.TrimSuffix(cluster.Server, "/") == strings.TrimSuffix(host, "/") {
+			return &c.Clusters[i]
+		}
+	}
+	return nil
+}
+
+// Namespace returns the summon namespace for an environment.
+func (c *Config) Namespace(env string) string {
+	return c.NamespacePrefix + env
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Ridecell/ridectl/pkg/config"
+)
+
+var _ = Describe("Config", func() {
+	var dir string
+	var path string
+	envVars := []string{"RIDECTL_CONFIG", "RIDECTL_CLUSTERS", "RIDECTL_HOST_PATTERNS", "RIDECTL_NAMESPACE_PREFIX", "RIDECTL_FLAVOR_BUCKET", "RIDECTL_FLAVOR_REGION", "RIDECTL_KMS_REGION"}
+	oldEnv := map[string]*string{}
+
+	writeConfig := func(content string) {
+		err := ioutil.WriteFile(path, []byte(content), 0600)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		for _, name := range envVars {
+			if value, ok := os.LookupEnv(name); ok {
+				oldEnv[name] = &value
+			} else {
+				oldEnv[name] = nil
+			}
+			os.Unsetenv(name)
+		}
+		var err error
+		dir, err = ioutil.TempDir("", "ridectl-config")
+		Expect(err).ToNot(HaveOccurred())
+		path = filepath.Join(dir, "config.yaml")
+		os.Setenv("RIDECTL_CONFIG", path)
+	})
+
+	AfterEach(func() {
+		for name, value := range oldEnv {
+			if value == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *value)
+			}
+		}
+		os.RemoveAll(dir)
+	})
+
+	It("uses the defaults without a config file", func() {
+		cfg, err := config.Load()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cfg.Clusters).To(Equal(config.Default.Clusters))
+		Expect(cfg.HostPatterns).To(Equal(config.Default.HostPatterns))
+		Expect(cfg.Namespace("qa")).To(Equal("summon-qa"))
+		Expect(cfg.Flavors).To(Equal(config.Default.Flavors))
+		Expect(cfg.KMS).To(Equal(config.Default.KMS))
+		Expect(cfg.AllowsHost("https://api.us-prod.kops.ridecell.io")).To(BeTrue())
+		Expect(cfg.AllowsHost("https://127.0.0.1:6443")).To(BeFalse())
+	})
+
+	It("reads the config file", func() {
+		writeConfig(`clusters:
+- name: local
+  region: dev
+  server: https://127.0.0.1:6443/
+hostPatterns: []
+namespacePrefix: test-
+flavors:
+  bucket: my-flavors
+`)
+		cfg, err := config.Load()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cfg.Clusters).To(Equal([]config.Cluster{{Name: "local", Region: "dev", Server: "https://127.0.0.1:6443/"}}))
+		Expect(cfg.Namespace("qa")).To(Equal("test-qa"))
+		Expect(cfg.Flavors).To(Equal(config.Flavors{Bucket: "my-flavors", Region: config.Default.Flavors.Region}))
+		Expect(cfg.AllowsHost("https://127.0.0.1:6443")).To(BeTrue())
+		Expect(cfg.AllowsHost("https://api.us-prod.kops.ridecell.io")).To(BeFalse())
+		Expect(cfg.ClusterForHost("https://127.0.0.1:6443")).To(Equal(&cfg.Clusters[0]))
+		Expect(cfg.ClusterForHost("https://127.0.0.1:6444")).To(BeNil())
+	})
+
+	It("lets the environment override the config file", func() {
+		writeConfig(`clusters:
+- name: local
+  server: https://127.0.0.1:6443
+namespacePrefix: test-
+flavors:
+  bucket: my-flavors
+kms:
+  region: eu-central-1
+`)
+		os.Setenv("RIDECTL_CLUSTERS", "one=https://one.example.com, two=https://two.example.com")
+		os.Setenv("RIDECTL_HOST_PATTERNS", `\.example\.org$`)
+		os.Setenv("RIDECTL_NAMESPACE_PREFIX", "env-")
+		os.Setenv("RIDECTL_FLAVOR_BUCKET", "env-flavors")
+		os.Setenv("RIDECTL_KMS_REGION", "us-east-1")
+		cfg, err := config.Load()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cfg.Clusters).To(Equal([]config.Cluster{{Name: "one", Server: "https://one.example.com"}, {Name: "two", Server: "https://two.example.com"}}))
+		Expect(cfg.HostPatterns).To(Equal([]string{`\.example\.org$`}))
+		Expect(cfg.Namespace("qa")).To(Equal("env-qa"))
+		Expect(cfg.Flavors.Bucket).To(Equal("env-flavors"))
+		Expect(cfg.KMS.Region).To(Equal("us-east-1"))
+		Expect(cfg.AllowsHost("https://api.example.org")).To(BeTrue())
+	})
+
+	It("allows an empty namespace prefix in the config file", func() {
+		writeConfig("namespacePrefix: \"\"\n")
+		cfg, err := config.Load()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cfg.Namespace("qa")).To(Equal("qa"))
+	})
+
+	It("allows an empty namespace prefix in the environment", func() {
+		writeConfig("namespacePrefix: test-\n")
+		os.Setenv("RIDECTL_NAMESPACE_PREFIX", "")
+		cfg, err := config.Load()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cfg.Namespace("qa")).To(Equal("qa"))
+	})
+
+	It("rejects unknown settings", func() {
+		writeConfig("namespacePrefixes: test-\n")
+		_, err := config.Load()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects invalid clusters in the environment", func() {
+		os.Setenv("RIDECTL_CLUSTERS", "noserver")
+		_, err := config.Load()
+		Expect(err).To(MatchError("invalid RIDECTL_CLUSTERS entry noserver, must be name=server"))
+	})
+
+	It("rejects invalid host patterns", func() {
+		os.Setenv("RIDECTL_HOST_PATTERNS", "(")
+		_, err := config.Load()
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,188 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flavor
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+)
+
+// ChecksumMetadata is the metadata key uploads store the SHA-256 of the
+// compressed flavor under.
+const ChecksumMetadata = "sha256"
+
+// FetchAttempts is how many times Fetch tries a download before giving up,
+// it always tries at least once.
+var FetchAttempts = 4
+
+// RetryDelay is how long Fetch waits before its first retry, it doubles for
+// every retry after that.
+var RetryDelay = time.Second
+
+// transientError is a failed download worth trying again.
+type transientError struct {
+	error
+}
+
+// Fetch downloads a flavor into dest and checks it against its checksum,
+// retrying when the download fails part way or comes out wrong. progress, if
+// set, is called with the bytes downloaded so far and the total. dest is
+// rewound to the start afterwards.
+func (s *Store) Fetch(name string, dest *os.File, progress func(done int64, total int64)) (*Flavor, error) {
+	attempts := FetchAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(RetryDelay << uint(attempt-1))
+		}
+		var flavor *Flavor
+		flavor, err = s.fetchOnce(name, dest, progress)
+		if _, ok := err.(*transientError); !ok {
+			return flavor, err
+		}
+	}
+	return nil, errors.Wrapf(err.(*transientError).error, "giving up on flavor %s after %d attempts", name, attempts)
+}
+
+func (s *Store) fetchOnce(name string, dest *os.File, progress func(done int64, total int64)) (*Flavor, error) {
+	_, err := dest.Seek(0, io.SeekStart)
+	if err == nil {
+		err = dest.Truncate(0)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to reset download file")
+	}
+
+	object, err := s.S3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, &NotFoundError{Name: name}
+		}
+		retry := request.IsErrorRetryable(err) || request.IsErrorThrottle(err)
+		err = errors.Wrapf(err, "failed to download flavor %s", name)
+		if retry {
+			return nil, &transientError{err}
+		}
+		return nil, err
+	}
+	defer object.Body.Close()
+	flavor := &Flavor{
+		Name:                 name,
+		Size:                 aws.Int64Value(object.ContentLength),
+		LastModified:         aws.TimeValue(object.LastModified),
+		ETag:                 aws.StringValue(object.ETag),
+		Metadata:             aws.StringValueMap(object.Metadata),
+		ServerSideEncryption: aws.StringValue(object.ServerSideEncryption),
+	}
+
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	body := &downloadReader{Reader: object.Body, hashes: []hash.Hash{md5Hash, sha256Hash}, total: flavor.Size, progress: progress}
+	_, err = io.Copy(dest, body)
+	if body.err != nil {
+		return nil, &transientError{errors.Wrapf(body.err, "error downloading flavor %s", name)}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to write download file")
+	}
+	if flavor.Size > 0 && body.done != flavor.Size {
+		return nil, &transientError{errors.Errorf("flavor %s download stopped at %d of %d bytes", name, body.done, flavor.Size)}
+	}
+
+	kind, expected := ExpectedChecksum(flavor)
+	actual := ""
+	switch kind {
+	case "sha256":
+		actual = hex.EncodeToString(sha256Hash.Sum(nil))
+	case "md5":
+		actual = hex.EncodeToString(md5Hash.Sum(nil))
+	}
+	if actual != expected {
+		return nil, &transientError{errors.Errorf("flavor %s failed its %s check, expected %s but got %s", name, kind, expected, actual)}
+	}
+
+	_, err = dest.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to rewind download file")
+	}
+	return flavor, nil
+}
+
+// ExpectedChecksum returns which checksum a flavor can be checked with and
+// its value. The SHA-256 from upload is preferred, and otherwise the ETag is
+// used, which is only the MD5 of the object when it is unencrypted or
+// encrypted with S3 managed keys and wasn't a multipart upload. kind is empty
+// when neither is available.
+func ExpectedChecksum(flavor *Flavor) (kind string, value string) {
+	for key, value := range flavor.Metadata {
+		// S3 changes the case of metadata keys.
+		if strings.EqualFold(key, ChecksumMetadata) {
+			return "sha256", strings.ToLower(value)
+		}
+	}
+	if flavor.ServerSideEncryption != "" && flavor.ServerSideEncryption != s3.ServerSideEncryptionAes256 {
+		return "", ""
+	}
+	etag := strings.Trim(flavor.ETag, `"`)
+	if etag != "" && !strings.Contains(etag, "-") {
+		return "md5", strings.ToLower(etag)
+	}
+	return "", ""
+}
+
+// downloadReader hashes and counts what goes through it, and keeps read
+// errors apart from errors writing the download.
+type downloadReader struct {
+	io.Reader
+	hashes   []hash.Hash
+	done     int64
+	total    int64
+	progress func(done int64, total int64)
+	err      error
+}
+
+func (r *downloadReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	for _, h := range r.hashes {
+		h.Write(p[:n])
+	}
+	r.done += int64(n)
+	if r.progress != nil && n > 0 {
+		r.progress(r.done, r.total)
+	}
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
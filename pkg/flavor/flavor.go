@@ -0,0 +1,207 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flavor
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/pkg/errors"
+
+	"github.com/Ridecell/ridectl/pkg/config"
+)
+
+// Store is the S3 bucket holding database flavors, bzip2 compressed files
+// for manage.py loadflavor. A flavor's name is its object key.
+type Store struct {
+	S3     s3iface.S3API
+	Bucket string
+}
+
+// Flavor is a flavor in the bucket.
+type Flavor struct {
+	Name                 string            `json:"name"`
+	Size                 int64             `json:"size"`
+	LastModified         time.Time         `json:"lastModified"`
+	ETag                 string            `json:"etag,omitempty"`
+	Metadata             map[string]string `json:"metadata,omitempty"`
+	ServerSideEncryption string            `json:"serverSideEncryption,omitempty"`
+}
+
+// NotFoundError is returned for a flavor that isn't in the bucket.
+type NotFoundError struct {
+	Name string
+}
+
+func (e *NotFoundError) Error() string {
+	return "flavor " + e.Name + " not found"
+}
+
+// IsNotFound checks if an error is a NotFoundError.
+func IsNotFound(err error) bool {
+	_, ok := errors.Cause(err).(*NotFoundError)
+	return ok
+}
+
+// NewStore connects to the flavor bucket from the ridectl config.
+func NewStore() (*Store, error) {
+	cfg, err := config.Get()
+	if err != nil {
+		return nil, err
+	}
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating AWS session")
+	}
+	return &Store{
+		S3:     s3.New(sess, aws.NewConfig().WithRegion(cfg.Flavors.Region)),
+		Bucket: cfg.Flavors.Bucket,
+	}, nil
+}
+
+// List returns the flavors whose names start with prefix, sorted by name.
+func (s *Store) List(prefix string) ([]Flavor, error) {
+	flavors := []Flavor{}
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(prefix),
+	}
+	err := s.S3.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			flavors = append(flavors, Flavor{
+				Name:         aws.StringValue(object.Key),
+				Size:         aws.Int64Value(object.Size),
+				LastModified: aws.TimeValue(object.LastModified),
+				ETag:         aws.StringValue(object.ETag),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing flavors in %s", s.Bucket)
+	}
+	sort.Slice(flavors, func(i, j int) bool { return flavors[i].Name < flavors[j].Name })
+	return flavors, nil
+}
+
+// Describe looks up a single flavor along with its metadata.
+func (s *Store) Describe(name string) (*Flavor, error) {
+	head, err := s.S3.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, &NotFoundError{Name: name}
+		}
+		return nil, errors.Wrapf(err, "error looking up flavor %s", name)
+	}
+	return &Flavor{
+		Name:                 name,
+		Size:                 aws.Int64Value(head.ContentLength),
+		LastModified:         aws.TimeValue(head.LastModified),
+		ETag:                 aws.StringValue(head.ETag),
+		Metadata:             aws.StringValueMap(head.Metadata),
+		ServerSideEncryption: aws.StringValue(head.ServerSideEncryption),
+	}, nil
+}
+
+// Upload stores a flavor, compressing it with bzip2 unless it already is,
+// along with its checksum for Fetch. Any existing flavor with the same name is
+// replaced.
+func (s *Store) Upload(name string, in io.Reader, metadata map[string]string) error {
+	body, err := compress(in)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(body.Name())
+	defer body.Close()
+
+	checksum := sha256.New()
+	_, err = io.Copy(checksum, body)
+	if err == nil {
+		_, err = body.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return errors.Wrap(err, "error reading compressed flavor")
+	}
+	allMetadata := map[string]string{ChecksumMetadata: hex.EncodeToString(checksum.Sum(nil))}
+	for key, value := range metadata {
+		allMetadata[key] = value
+	}
+
+	_, err = s.S3.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(name),
+		Body:        body,
+		ContentType: aws.String("application/x-bzip2"),
+		Metadata:    aws.StringMap(allMetadata),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to upload flavor %s", name)
+	}
+	return nil
+}
+
+// compress writes bzip2 compressed input to a temp file, since S3 uploads
+// need to know the size up front.
+func compress(in io.Reader) (*os.File, error) {
+	tempFile, err := ioutil.TempFile("", "ridectl-flavor")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create temp file")
+	}
+	buffered := bufio.NewReader(in)
+	magic, _ := buffered.Peek(3)
+	if string(magic) == "BZh" {
+		_, err = io.Copy(tempFile, buffered)
+	} else {
+		cmd := exec.Command("bzip2", "-c")
+		cmd.Stdin = buffered
+		cmd.Stdout = tempFile
+		cmd.Stderr = os.Stderr
+		err = errors.Wrap(cmd.Run(), "bzip2 failed")
+	}
+	if err == nil {
+		_, err = tempFile.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+		return nil, err
+	}
+	return tempFile, nil
+}
+
+func isS3NotFound(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	return awsErr.Code() == s3.ErrCodeNoSuchKey || awsErr.Code() == "NotFound"
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flavor_test
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Ridecell/ridectl/pkg/flavor"
+)
+
+// fakeS3 keeps objects in memory. Anything it doesn't implement panics.
+type fakeS3 struct {
+	s3iface.S3API
+	objects  map[string][]byte
+	metadata map[string]map[string]*string
+	etags    map[string]string
+	sse      map[string]string
+	// brokenGets is how many downloads should fail half way through.
+	brokenGets int
+	gets       int
+}
+
+type brokenReader struct{}
+
+func (brokenReader) Read(p []byte) (int, error) {
+	return 0, errors.New("connection reset by peer")
+}
+
+func (f *fakeS3) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	// One object per page, to check that every page is read.
+	for _, key := range []string{"darwin.json.bz2", "darwin-small.json.bz2", "other.json.bz2"} {
+		data, ok := f.objects[key]
+		if !ok || !bytes.HasPrefix([]byte(key), []byte(aws.StringValue(input.Prefix))) {
+			continue
+		}
+		page := &s3.ListObjectsV2Output{Contents: []*s3.Object{{
+			Key:          aws.String(key),
+			Size:         aws.Int64(int64(len(data))),
+			LastModified: aws.Time(time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)),
+		}}}
+		if !fn(page, false) {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeS3) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	data, ok := f.objects[aws.StringValue(input.Key)]
+	if !ok {
+		return nil, awserr.New("NotFound", "Not Found", nil)
+	}
+	return &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(data))),
+		ETag:          aws.String(`"abc"`),
+		Metadata:      f.metadata[aws.StringValue(input.Key)],
+	}, nil
+}
+
+func (f *fakeS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	f.gets++
+	data, ok := f.objects[aws.StringValue(input.Key)]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+	}
+	var body io.Reader = bytes.NewReader(data)
+	if f.brokenGets > 0 {
+		f.brokenGets--
+		body = io.MultiReader(bytes.NewReader(data[:len(data)/2]), brokenReader{})
+	}
+	return &s3.GetObjectOutput{
+		Body:                 ioutil.NopCloser(body),
+		ContentLength:        aws.Int64(int64(len(data))),
+		ETag:                 aws.String(f.etags[aws.StringValue(input.Key)]),
+		Metadata:             f.metadata[aws.StringValue(input.Key)],
+		ServerSideEncryption: aws.String(f.sse[aws.StringValue(input.Key)]),
+	}, nil
+}
+
+func (f *fakeS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	data, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.objects[aws.StringValue(input.Key)] = data
+	f.metadata[aws.StringValue(input.Key)] = input.Metadata
+	return &s3.PutObjectOutput{}, nil
+}
+
+var _ = Describe("Store", func() {
+	var fake *fakeS3
+	var store *flavor.Store
+	var dest *os.File
+
+	BeforeEach(func() {
+		fake = &fakeS3{
+			objects: map[string][]byte{
+				"darwin.json.bz2":       []byte("1234"),
+				"darwin-small.json.bz2": []byte("12"),
+				"other.json.bz2":        []byte("1"),
+			},
+			metadata: map[string]map[string]*string{},
+			etags:    map[string]string{},
+			sse:      map[string]string{},
+		}
+		store = &flavor.Store{S3: fake, Bucket: "flavors"}
+		flavor.RetryDelay = time.Millisecond
+		var err error
+		dest, err = ioutil.TempFile("", "flavor-test")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		dest.Close()
+		os.Remove(dest.Name())
+	})
+
+	readDest := func() string {
+		data, err := ioutil.ReadAll(dest)
+		Expect(err).ToNot(HaveOccurred())
+		return string(data)
+	}
+
+	It("lists flavors by prefix across pages sorted by name", func() {
+		flavors, err := store.List("darwin")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(flavors).To(HaveLen(2))
+		Expect(flavors[0].Name).To(Equal("darwin-small.json.bz2"))
+		Expect(flavors[0].Size).To(Equal(int64(2)))
+		Expect(flavors[1].Name).To(Equal("darwin.json.bz2"))
+		Expect(flavors[1].Size).To(Equal(int64(4)))
+	})
+
+	It("reports missing flavors as not found", func() {
+		_, err := store.Describe("missing.json.bz2")
+		Expect(flavor.IsNotFound(err)).To(BeTrue())
+		_, err = store.Fetch("missing.json.bz2", dest, nil)
+		Expect(flavor.IsNotFound(err)).To(BeTrue())
+		Expect(fake.gets).To(Equal(1))
+	})
+
+	It("compresses uploads and keeps their metadata", func() {
+		err := store.Upload("new.json.bz2", bytes.NewBufferString(`{"flavor": true}`), map[string]string{"uploaded-by": "someone"})
+		Expect(err).ToNot(HaveOccurred())
+		data, err := ioutil.ReadAll(bzip2.NewReader(bytes.NewReader(fake.objects["new.json.bz2"])))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal(`{"flavor": true}`))
+
+		described, err := store.Describe("new.json.bz2")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(described.Metadata).To(HaveKeyWithValue("uploaded-by", "someone"))
+		Expect(described.Metadata).To(HaveKey("sha256"))
+	})
+
+	It("does not compress uploads twice", func() {
+		err := store.Upload("first.json.bz2", bytes.NewBufferString("data"), nil)
+		Expect(err).ToNot(HaveOccurred())
+		compressed := fake.objects["first.json.bz2"]
+		err = store.Upload("second.json.bz2", bytes.NewReader(compressed), nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fake.objects["second.json.bz2"]).To(Equal(compressed))
+	})
+
+	It("checks downloads against the checksum from upload", func() {
+		err := store.Upload("new.json.bz2", bytes.NewBufferString("data"), nil)
+		Expect(err).ToNot(HaveOccurred())
+		progress := []int64{}
+		fetched, err := store.Fetch("new.json.bz2", dest, func(done int64, total int64) {
+			Expect(total).To(Equal(int64(len(fake.objects["new.json.bz2"]))))
+			progress = append(progress, done)
+		})
+		Expect(err).ToNot(HaveOccurred())
+		kind, _ := flavor.ExpectedChecksum(fetched)
+		Expect(kind).To(Equal("sha256"))
+		Expect(readDest()).To(Equal(string(fake.objects["new.json.bz2"])))
+		Expect(progress[len(progress)-1]).To(Equal(fetched.Size))
+	})
+
+	It("checks downloads against a plain ETag", func() {
+		// MD5 of "1234".
+		fake.etags["darwin.json.bz2"] = `"81dc9bdb52d04dc20036dbd8313ed055"`
+		fetched, err := store.Fetch("darwin.json.bz2", dest, nil)
+		Expect(err).ToNot(HaveOccurred())
+		kind, _ := flavor.ExpectedChecksum(fetched)
+		Expect(kind).To(Equal("md5"))
+		Expect(readDest()).To(Equal("1234"))
+	})
+
+	It("checks downloads against the ETag with S3 managed encryption", func() {
+		fake.etags["darwin.json.bz2"] = `"81dc9bdb52d04dc20036dbd8313ed055"`
+		fake.sse["darwin.json.bz2"] = s3.ServerSideEncryptionAes256
+		fetched, err := store.Fetch("darwin.json.bz2", dest, nil)
+		Expect(err).ToNot(HaveOccurred())
+		kind, _ := flavor.ExpectedChecksum(fetched)
+		Expect(kind).To(Equal("md5"))
+	})
+
+	It("can't check KMS encrypted objects with their ETag", func() {
+		fake.etags["darwin.json.bz2"] = `"0123456789abcdef0123456789abcdef"`
+		fake.sse["darwin.json.bz2"] = s3.ServerSideEncryptionAwsKms
+		fetched, err := store.Fetch("darwin.json.bz2", dest, nil)
+		Expect(err).ToNot(HaveOccurred())
+		kind, _ := flavor.ExpectedChecksum(fetched)
+		Expect(kind).To(Equal(""))
+		Expect(fake.gets).To(Equal(1))
+	})
+
+	It("can't check multipart uploads", func() {
+		fake.etags["darwin.json.bz2"] = `"81dc9bdb52d04dc20036dbd8313ed055-2"`
+		fetched, err := store.Fetch("darwin.json.bz2", dest, nil)
+		Expect(err).ToNot(HaveOccurred())
+		kind, _ := flavor.ExpectedChecksum(fetched)
+		Expect(kind).To(Equal(""))
+	})
+
+	It("retries a download that fails part way", func() {
+		fake.brokenGets = 2
+		_, err := store.Fetch("darwin.json.bz2", dest, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fake.gets).To(Equal(3))
+		Expect(readDest()).To(Equal("1234"))
+	})
+
+	It("gives up on a download that keeps failing its checksum", func() {
+		fake.metadata["darwin.json.bz2"] = map[string]*string{"Sha256": aws.String("0000")}
+		_, err := store.Fetch("darwin.json.bz2", dest, nil)
+		Expect(err).To(MatchError(ContainSubstring("failed its sha256 check")))
+		Expect(fake.gets).To(Equal(flavor.FetchAttempts))
+	})
+
+	It("tries at least once", func() {
+		defer func(attempts int) { flavor.FetchAttempts = attempts }(flavor.FetchAttempts)
+		flavor.FetchAttempts = 0
+		fake.brokenGets = 1
+		_, err := store.Fetch("darwin.json.bz2", dest, nil)
+		Expect(err).To(MatchError(ContainSubstring("after 1 attempts")))
+		Expect(fake.gets).To(Equal(1))
+	})
+})
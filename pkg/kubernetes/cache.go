@@ -0,0 +1,137 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ContextCacheTTL is how long a cached lookup is trusted before searching all
+// contexts again.
+var ContextCacheTTL = 24 * time.Hour
+
+type contextCacheEntry struct {
+	Context   string    `json:"context"`
+	Namespace string    `json:"namespace"`
+	Expires   time.Time `json:"expires"`
+}
+
+// contextCache remembers which kubeconfig context an instance was found in,
+// so later commands can skip asking every cluster. Problems reading or writing
+// the cache file are ignored, it only ever makes things faster.
+type contextCache struct {
+	path    string
+	Entries map[string]contextCacheEntry `json:"entries"`
+}
+
+func loadContextCache() *contextCache {
+	cache := &contextCache{Entries: map[string]contextCacheEntry{}}
+	home, err := homedir.Dir()
+	if err != nil {
+		return cache
+	}
+	cache.path = filepath.Join(home, ".ridectl", "cache.json")
+	data, err := ioutil.ReadFile(cache.path)
+	if err != nil {
+		return cache
+	}
+	err = json.Unmarshal(data, cache)
+	if err != nil || cache.Entries == nil {
+		cache.Entries = map[string]contextCacheEntry{}
+	}
+	return cache
+}
+
+func contextCacheKey(kind string, namespace string, name string) string {
+	return kind + ":" + namespace + "/" + name
+}
+
+func (c *contextCache) lookup(key string) (string, bool) {
+	entry, ok := c.Entries[key]
+	if !ok || time.Now().After(entry.Expires) {
+		return "", false
+	}
+	return entry.Context, true
+}
+
+func (c *contextCache) store(key string, contextName string, namespace string) {
+	c.Entries[key] = contextCacheEntry{Context: contextName, Namespace: namespace, Expires: time.Now().Add(ContextCacheTTL)}
+	c.save()
+}
+
+func (c *contextCache) remove(key string) {
+	delete(c.Entries, key)
+	c.save()
+}
+
+func (c *contextCache) save() {
+	if c.path == "" {
+		return
+	}
+	// Drop anything stale while we are here.
+	now := time.Now()
+	for key, entry := range c.Entries {
+		if now.After(entry.Expires) {
+			delete(c.Entries, key)
+		}
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	err = os.MkdirAll(filepath.Dir(c.path), 0700)
+	if err != nil {
+		return
+	}
+	// Write then rename so a concurrent ridectl never reads half a file.
+	tmpFile, err := ioutil.TempFile(filepath.Dir(c.path), "cache")
+	if err != nil {
+		return
+	}
+	_, err = tmpFile.Write(data)
+	tmpFile.Close()
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return
+	}
+	err = os.Rename(tmpFile.Name(), c.path)
+	if err != nil {
+		os.Remove(tmpFile.Name())
+	}
+}
+
+// cachedKubeContext returns the context a lookup was last found in, if it is
+// still cached and still in the kubeconfig.
+func cachedKubeContext(cache *contextCache, key string, kubeContexts map[string]*api.Context) *kubeContext {
+	contextName, ok := cache.lookup(key)
+	if !ok {
+		return nil
+	}
+	contextObj, ok := kubeContexts[contextName]
+	if !ok {
+		cache.remove(key)
+		return nil
+	}
+	return &kubeContext{Name: contextName, Context: contextObj}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/Ridecell/ridectl/pkg/kubernetes"
+)
+
+var _ = Describe("Context cache", func() {
+	var home string
+	var oldHome string
+	var cacheFile string
+	key := kubernetes.ContextCacheKey("object", "summon-qa", "myinstance")
+
+	BeforeEach(func() {
+		var err error
+		home, err = ioutil.TempDir("", "ridectl-home")
+		Expect(err).ToNot(HaveOccurred())
+		oldHome = os.Getenv("HOME")
+		os.Setenv("HOME", home)
+		homedir.DisableCache = true
+		cacheFile = filepath.Join(home, ".ridectl", "cache.json")
+	})
+
+	AfterEach(func() {
+		os.Setenv("HOME", oldHome)
+		homedir.DisableCache = false
+		kubernetes.ContextCacheTTL = 24 * time.Hour
+		os.RemoveAll(home)
+	})
+
+	It("remembers lookups across loads", func() {
+		kubernetes.LoadContextCache().Store(key, "us-qa", "summon-qa")
+		Expect(cacheFile).To(BeAnExistingFile())
+
+		contextName, ok := kubernetes.LoadContextCache().Lookup(key)
+		Expect(ok).To(BeTrue())
+		Expect(contextName).To(Equal("us-qa"))
+		_, ok = kubernetes.LoadContextCache().Lookup(kubernetes.ContextCacheKey("object", "summon-qa", "other"))
+		Expect(ok).To(BeFalse())
+	})
+
+	It("ignores expired entries", func() {
+		kubernetes.ContextCacheTTL = -time.Minute
+		kubernetes.LoadContextCache().Store(key, "us-qa", "summon-qa")
+		_, ok := kubernetes.LoadContextCache().Lookup(key)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("drops expired entries when saving", func() {
+		kubernetes.ContextCacheTTL = -time.Minute
+		kubernetes.LoadContextCache().Store(key, "us-qa", "summon-qa")
+		kubernetes.ContextCacheTTL = time.Hour
+		otherKey := kubernetes.ContextCacheKey("pods", "summon-qa", "app=other")
+		kubernetes.LoadContextCache().Store(otherKey, "us-qa", "summon-qa")
+
+		data, err := ioutil.ReadFile(cacheFile)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).ToNot(ContainSubstring(key))
+		Expect(string(data)).To(ContainSubstring(otherKey))
+	})
+
+	It("removes entries", func() {
+		kubernetes.LoadContextCache().Store(key, "us-qa", "summon-qa")
+		kubernetes.LoadContextCache().Remove(key)
+		_, ok := kubernetes.LoadContextCache().Lookup(key)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("invalidates entries for contexts no longer in the kubeconfig", func() {
+		kubernetes.LoadContextCache().Store(key, "us-qa", "summon-qa")
+		contexts := map[string]*api.Context{"us-qa": {Cluster: "us-qa"}}
+		Expect(kubernetes.CachedKubeContext(kubernetes.LoadContextCache(), key, contexts)).To(Equal("us-qa"))
+
+		delete(contexts, "us-qa")
+		Expect(kubernetes.CachedKubeContext(kubernetes.LoadContextCache(), key, contexts)).To(Equal(""))
+		_, ok := kubernetes.LoadContextCache().Lookup(key)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("treats a corrupt file as empty", func() {
+		err := os.MkdirAll(filepath.Dir(cacheFile), 0700)
+		Expect(err).ToNot(HaveOccurred())
+		err = ioutil.WriteFile(cacheFile, []byte("{not json"), 0600)
+		Expect(err).ToNot(HaveOccurred())
+		_, ok := kubernetes.LoadContextCache().Lookup(key)
+		Expect(ok).To(BeFalse())
+
+		kubernetes.LoadContextCache().Store(key, "us-qa", "summon-qa")
+		_, ok = kubernetes.LoadContextCache().Lookup(key)
+		Expect(ok).To(BeTrue())
+	})
+})
@@ -0,0 +1,33 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"github.com/pkg/errors"
+	apiextv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+)
+
+// GetCRD fetches a CustomResourceDefinition, like
+// summonplatforms.summon.ridecell.io, from the first cluster that has it.
+func GetCRD(kubeconfig string, name string) (*apiextv1beta1.CustomResourceDefinition, error) {
+	crd := &apiextv1beta1.CustomResourceDefinition{}
+	err := GetObject(kubeconfig, name, "", &KubeObject{Top: crd})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to find CRD %s", name)
+	}
+	return crd, nil
+}
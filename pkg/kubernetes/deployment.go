@@ -0,0 +1,78 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// WaitForRollout waits until every replica of a deployment is running the
+// current pod template and available, like kubectl rollout status. progress
+// is called whenever the status message changes.
+func WaitForRollout(fetchObject *KubeObject, deployment *appsv1.Deployment, timeout time.Duration, progress func(message string)) error {
+	lastMessage := ""
+	err := wait.PollImmediate(pollInterval, timeout, func() (bool, error) {
+		err := GetObjectWithClient(fetchObject.Client, deployment.Name, deployment.Namespace, deployment)
+		if err != nil {
+			return false, err
+		}
+		message, done, err := rolloutStatus(deployment)
+		if err != nil {
+			return false, err
+		}
+		if message != lastMessage {
+			progress(message)
+			lastMessage = message
+		}
+		return done, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return errors.Errorf("timed out waiting for %s to roll out: %s", deployment.Name, lastMessage)
+	}
+	return err
+}
+
+func rolloutStatus(deployment *appsv1.Deployment) (string, bool, error) {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return "waiting for the deployment to be picked up", false, nil
+	}
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			return "", false, errors.Errorf("deployment %s exceeded its progress deadline", deployment.Name)
+		}
+	}
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	if status.UpdatedReplicas < replicas {
+		return fmt.Sprintf("%d of %d new replicas updated", status.UpdatedReplicas, replicas), false, nil
+	}
+	if status.Replicas > status.UpdatedReplicas {
+		return fmt.Sprintf("%d old replicas pending termination", status.Replicas-status.UpdatedReplicas), false, nil
+	}
+	if status.AvailableReplicas < status.UpdatedReplicas {
+		return fmt.Sprintf("%d of %d updated replicas available", status.AvailableReplicas, status.UpdatedReplicas), false, nil
+	}
+	return "successfully rolled out", true, nil
+}
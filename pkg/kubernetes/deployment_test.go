@@ -0,0 +1,129 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Ridecell/ridectl/pkg/kubernetes"
+)
+
+// getClient is a client that only answers Get.
+type getClient struct {
+	client.Client
+	get func(key client.ObjectKey, obj runtime.Object) error
+}
+
+func (c *getClient) Get(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+	return c.get(key, obj)
+}
+
+var _ = Describe("Deployment rollouts", func() {
+	var deployment *appsv1.Deployment
+
+	BeforeEach(func() {
+		replicas := int32(2)
+		deployment = &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "darwin-qa-web", Namespace: "summon-qa", Generation: 2},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status: appsv1.DeploymentStatus{
+				ObservedGeneration: 2,
+				Replicas:           2,
+				UpdatedReplicas:    2,
+				AvailableReplicas:  2,
+			},
+		}
+	})
+
+	Context("rolloutStatus", func() {
+		It("is done when every replica is updated and available", func() {
+			message, done, err := kubernetes.RolloutStatus(deployment)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(done).To(BeTrue())
+			Expect(message).To(Equal("successfully rolled out"))
+		})
+
+		It("waits for the new generation to be observed", func() {
+			deployment.Status.ObservedGeneration = 1
+			message, done, err := kubernetes.RolloutStatus(deployment)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(done).To(BeFalse())
+			Expect(message).To(Equal("waiting for the deployment to be picked up"))
+		})
+
+		It("waits for replicas to be updated, replaced and available", func() {
+			deployment.Status.UpdatedReplicas = 1
+			message, done, _ := kubernetes.RolloutStatus(deployment)
+			Expect(done).To(BeFalse())
+			Expect(message).To(Equal("1 of 2 new replicas updated"))
+
+			deployment.Status.UpdatedReplicas = 2
+			deployment.Status.Replicas = 3
+			message, done, _ = kubernetes.RolloutStatus(deployment)
+			Expect(done).To(BeFalse())
+			Expect(message).To(Equal("1 old replicas pending termination"))
+
+			deployment.Status.Replicas = 2
+			deployment.Status.AvailableReplicas = 1
+			message, done, _ = kubernetes.RolloutStatus(deployment)
+			Expect(done).To(BeFalse())
+			Expect(message).To(Equal("1 of 2 updated replicas available"))
+		})
+
+		It("fails when the progress deadline is exceeded", func() {
+			deployment.Status.Conditions = []appsv1.DeploymentCondition{
+				{Type: appsv1.DeploymentProgressing, Reason: "ProgressDeadlineExceeded"},
+			}
+			_, _, err := kubernetes.RolloutStatus(deployment)
+			Expect(err).To(MatchError("deployment darwin-qa-web exceeded its progress deadline"))
+		})
+	})
+
+	Context("WaitForRollout", func() {
+		It("reports progress until the rollout is done", func() {
+			fetchObject := &kubernetes.KubeObject{Client: &getClient{get: func(key client.ObjectKey, obj runtime.Object) error {
+				Expect(key).To(Equal(client.ObjectKey{Name: "darwin-qa-web", Namespace: "summon-qa"}))
+				deployment.DeepCopyInto(obj.(*appsv1.Deployment))
+				return nil
+			}}}
+			messages := []string{}
+			err := kubernetes.WaitForRollout(fetchObject, deployment.DeepCopy(), time.Minute, func(message string) {
+				messages = append(messages, message)
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(messages).To(Equal([]string{"successfully rolled out"}))
+		})
+
+		It("times out with the last status", func() {
+			deployment.Status.AvailableReplicas = 1
+			fetchObject := &kubernetes.KubeObject{Client: &getClient{get: func(key client.ObjectKey, obj runtime.Object) error {
+				deployment.DeepCopyInto(obj.(*appsv1.Deployment))
+				return nil
+			}}}
+			err := kubernetes.WaitForRollout(fetchObject, deployment.DeepCopy(), time.Millisecond, func(string) {})
+			Expect(err).To(MatchError("timed out waiting for darwin-qa-web to roll out: 1 of 2 updated replicas available"))
+		})
+	})
+})
@@ -0,0 +1,165 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh/terminal"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// ExecOptions describes a command to run in a pod.
+type ExecOptions struct {
+	Command   []string
+	Container string
+	// Stdin is passed to the command if set. When it is os.Stdin and that is a
+	// terminal, the command gets a TTY.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// ExecUnavailableError is returned when a command could not be started
+// through the API server at all, callers can fall back to kubectl.
+type ExecUnavailableError struct {
+	Err error
+}
+
+func (e ExecUnavailableError) Error() string {
+	return e.Err.Error()
+}
+
+// IsExecUnavailable checks if ExecPod failed before the command started.
+func IsExecUnavailable(err error) bool {
+	_, ok := err.(ExecUnavailableError)
+	return ok
+}
+
+// ExecPod runs a command in a pod like kubectl exec, streaming over SPDY with
+// the rest config the pod was found with. A non-zero exit from the command
+// comes back as a k8s.io/client-go/util/exec.ExitError.
+func ExecPod(fetchObject *KubeObject, pod *corev1.Pod, options ExecOptions) error {
+	if fetchObject.Config == nil {
+		return ExecUnavailableError{errors.New("no rest config for pod")}
+	}
+	coreClient, err := clientset.NewForConfig(fetchObject.Config)
+	if err != nil {
+		return ExecUnavailableError{errors.Wrap(err, "error creating kubernetes client")}
+	}
+
+	tty := false
+	var stdinFd int
+	if stdinFile, ok := options.Stdin.(*os.File); ok && stdinFile == os.Stdin {
+		stdinFd = int(stdinFile.Fd())
+		tty = terminal.IsTerminal(stdinFd)
+	}
+
+	req := coreClient.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(pod.Namespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: options.Container,
+			Command:   options.Command,
+			Stdin:     options.Stdin != nil,
+			Stdout:    options.Stdout != nil,
+			Stderr:    options.Stderr != nil && !tty,
+			TTY:       tty,
+		}, scheme.ParameterCodec)
+	executor, err := remotecommand.NewSPDYExecutor(fetchObject.Config, "POST", req.URL())
+	if err != nil {
+		return ExecUnavailableError{errors.Wrap(err, "error creating executor")}
+	}
+
+	streamOptions := remotecommand.StreamOptions{
+		Stdin:  options.Stdin,
+		Stdout: options.Stdout,
+		Stderr: options.Stderr,
+		Tty:    tty,
+	}
+	if tty {
+		// The remote TTY does all the echoing and line editing.
+		oldState, err := terminal.MakeRaw(stdinFd)
+		if err != nil {
+			return ExecUnavailableError{errors.Wrap(err, "error setting terminal to raw mode")}
+		}
+		defer terminal.Restore(stdinFd, oldState)
+
+		sizeQueue := newTerminalSizeQueue(stdinFd)
+		defer sizeQueue.stop()
+		streamOptions.Stderr = nil
+		streamOptions.TerminalSizeQueue = sizeQueue
+	}
+
+	err = executor.Stream(streamOptions)
+	if _, ok := err.(*k8serrors.StatusError); ok {
+		// The API server refused the upgrade and said why.
+		return ExecUnavailableError{err}
+	}
+	if err != nil && strings.HasPrefix(err.Error(), "unable to upgrade connection") {
+		// This client-go has no typed error for a refused upgrade without a status.
+		return ExecUnavailableError{err}
+	}
+	return err
+}
+
+// terminalSizeQueue reports the terminal size at the start and again every
+// time the window is resized.
+type terminalSizeQueue struct {
+	fd      int
+	signals chan os.Signal
+	done    chan struct{}
+	sent    bool
+}
+
+func newTerminalSizeQueue(fd int) *terminalSizeQueue {
+	q := &terminalSizeQueue{fd: fd, signals: make(chan os.Signal, 1), done: make(chan struct{})}
+	signal.Notify(q.signals, syscall.SIGWINCH)
+	return q
+}
+
+func (q *terminalSizeQueue) Next() *remotecommand.TerminalSize {
+	if q.sent {
+		select {
+		case <-q.signals:
+		case <-q.done:
+			return nil
+		}
+	}
+	q.sent = true
+	width, height, err := terminal.GetSize(q.fd)
+	if err != nil {
+		return nil
+	}
+	return &remotecommand.TerminalSize{Width: uint16(width), Height: uint16(height)}
+}
+
+func (q *terminalSizeQueue) stop() {
+	signal.Stop(q.signals)
+	close(q.done)
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+
+	"github.com/Ridecell/ridectl/pkg/kubernetes"
+)
+
+var _ = Describe("ExecPod", func() {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "summon-qa-web-1234", Namespace: "summon-qa"}}
+	options := kubernetes.ExecOptions{Command: []string{"true"}}
+
+	It("is unavailable without a rest config", func() {
+		err := kubernetes.ExecPod(&kubernetes.KubeObject{}, pod, options)
+		Expect(kubernetes.IsExecUnavailable(err)).To(BeTrue())
+	})
+
+	It("is unavailable when the API server refuses the upgrade", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"kind": "Status", "apiVersion": "v1", "status": "Failure", "message": "pods/exec is forbidden", "reason": "Forbidden", "code": 403}`))
+		}))
+		defer server.Close()
+
+		err := kubernetes.ExecPod(&kubernetes.KubeObject{Config: &rest.Config{Host: server.URL}}, pod, options)
+		Expect(err).To(MatchError("pods/exec is forbidden"))
+		Expect(kubernetes.IsExecUnavailable(err)).To(BeTrue())
+	})
+
+	It("is unavailable when the upgrade fails without a status", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("bad gateway"))
+		}))
+		defer server.Close()
+
+		err := kubernetes.ExecPod(&kubernetes.KubeObject{Config: &rest.Config{Host: server.URL}}, pod, options)
+		Expect(err).To(MatchError("unable to upgrade connection: bad gateway"))
+		Expect(kubernetes.IsExecUnavailable(err)).To(BeTrue())
+	})
+})
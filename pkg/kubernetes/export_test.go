@@ -0,0 +1,53 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Exported for tests in kubernetes_test.
+
+type ContextCache = contextCache
+
+var LoadContextCache = loadContextCache
+var ContextCacheKey = contextCacheKey
+var RegionContexts = regionContexts
+
+func (c *contextCache) Lookup(key string) (string, bool) {
+	return c.lookup(key)
+}
+
+func (c *contextCache) Store(key string, contextName string, namespace string) {
+	c.store(key, contextName, namespace)
+}
+
+func (c *contextCache) Remove(key string) {
+	c.remove(key)
+}
+
+// CachedKubeContext returns the name of the cached context, or "" if there
+// isn't one.
+func CachedKubeContext(cache *contextCache, key string, kubeContexts map[string]*api.Context) string {
+	kubeContext := cachedKubeContext(cache, key, kubeContexts)
+	if kubeContext == nil {
+		return ""
+	}
+	return kubeContext.Name
+}
+
+var RolloutStatus = rolloutStatus
@@ -0,0 +1,142 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const pollInterval = 2 * time.Second
+
+// WaitForJobPod waits until a pod of the job is running or has finished, and
+// returns the newest one.
+func WaitForJobPod(fetchObject *KubeObject, job *batchv1.Job, timeout time.Duration) (*corev1.Pod, error) {
+	var found *corev1.Pod
+	err := wait.PollImmediate(pollInterval, timeout, func() (bool, error) {
+		pods := &corev1.PodList{}
+		listOptions := client.InNamespace(job.Namespace).MatchingLabels(map[string]string{"job-name": job.Name})
+		err := fetchObject.Client.List(context.Background(), listOptions, pods)
+		if err != nil {
+			return false, err
+		}
+		for i, pod := range pods.Items {
+			if pod.Status.Phase == corev1.PodPending {
+				continue
+			}
+			if found == nil || pod.CreationTimestamp.After(found.CreationTimestamp.Time) {
+				found = &pods.Items[i]
+			}
+		}
+		return found != nil, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return nil, errors.Errorf("timed out waiting for a pod of job %s to start", job.Name)
+	}
+	return found, err
+}
+
+// WaitForContainerExit waits until the first container of a pod has finished
+// and returns its exit code.
+func WaitForContainerExit(fetchObject *KubeObject, pod *corev1.Pod, timeout time.Duration) (int, error) {
+	exitCode := 0
+	err := wait.PollImmediate(pollInterval, timeout, func() (bool, error) {
+		err := GetObjectWithClient(fetchObject.Client, pod.Name, pod.Namespace, pod)
+		if err != nil {
+			return false, err
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if len(pod.Spec.Containers) > 0 && status.Name == pod.Spec.Containers[0].Name && status.State.Terminated != nil {
+				exitCode = int(status.State.Terminated.ExitCode)
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return 0, errors.Errorf("timed out waiting for pod %s to finish", pod.Name)
+	}
+	return exitCode, err
+}
+
+// WaitForRecreatedJob waits for a deleted job to be created again, for
+// example by the operator, and returns the new one.
+func WaitForRecreatedJob(fetchObject *KubeObject, oldJob *batchv1.Job, timeout time.Duration) (*batchv1.Job, error) {
+	newJob := &batchv1.Job{}
+	err := wait.PollImmediate(pollInterval, timeout, func() (bool, error) {
+		err := GetObjectWithClient(fetchObject.Client, oldJob.Name, oldJob.Namespace, newJob)
+		if k8serrors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return newJob.UID != oldJob.UID, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return nil, errors.Errorf("timed out waiting for job %s to be recreated", oldJob.Name)
+	}
+	return newJob, err
+}
+
+// WaitForJob waits until a job has completed or failed. A failed job comes
+// back as an error with the reason it failed.
+func WaitForJob(fetchObject *KubeObject, job *batchv1.Job, timeout time.Duration) error {
+	var failure error
+	err := wait.PollImmediate(pollInterval, timeout, func() (bool, error) {
+		err := GetObjectWithClient(fetchObject.Client, job.Name, job.Namespace, job)
+		if err != nil {
+			return false, err
+		}
+		for _, condition := range job.Status.Conditions {
+			if condition.Status != corev1.ConditionTrue {
+				continue
+			}
+			switch condition.Type {
+			case batchv1.JobComplete:
+				return true, nil
+			case batchv1.JobFailed:
+				failure = errors.Errorf("job %s failed: %s", job.Name, jobFailureReason(&condition))
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return errors.Errorf("timed out waiting for job %s to finish", job.Name)
+	}
+	if err != nil {
+		return err
+	}
+	return failure
+}
+
+func jobFailureReason(condition *batchv1.JobCondition) string {
+	reason := condition.Reason
+	if condition.Message != "" {
+		reason = fmt.Sprintf("%s: %s", reason, condition.Message)
+	}
+	return reason
+}
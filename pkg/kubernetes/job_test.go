@@ -0,0 +1,108 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Ridecell/ridectl/pkg/kubernetes"
+)
+
+var _ = Describe("Jobs", func() {
+	var oldJob *batchv1.Job
+
+	// jobClient answers Get with a copy of job, or err if it is set.
+	jobClient := func(job *batchv1.Job, err error) *kubernetes.KubeObject {
+		return &kubernetes.KubeObject{Client: &getClient{get: func(key client.ObjectKey, obj runtime.Object) error {
+			if err != nil {
+				return err
+			}
+			job.DeepCopyInto(obj.(*batchv1.Job))
+			return nil
+		}}}
+	}
+
+	BeforeEach(func() {
+		oldJob = &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "darwin-qa-migrations", Namespace: "summon-qa", UID: "old"}}
+	})
+
+	Context("WaitForRecreatedJob", func() {
+		It("returns the job once it has a new UID", func() {
+			newJob := oldJob.DeepCopy()
+			newJob.UID = "new"
+			job, err := kubernetes.WaitForRecreatedJob(jobClient(newJob, nil), oldJob, time.Minute)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(job.UID).To(BeEquivalentTo("new"))
+		})
+
+		It("keeps waiting while the old job is still there", func() {
+			_, err := kubernetes.WaitForRecreatedJob(jobClient(oldJob, nil), oldJob, time.Millisecond)
+			Expect(err).To(MatchError("timed out waiting for job darwin-qa-migrations to be recreated"))
+		})
+
+		It("keeps waiting while there is no job", func() {
+			notFound := k8serrors.NewNotFound(schema.GroupResource{Group: "batch", Resource: "jobs"}, oldJob.Name)
+			_, err := kubernetes.WaitForRecreatedJob(jobClient(nil, notFound), oldJob, time.Millisecond)
+			Expect(err).To(MatchError("timed out waiting for job darwin-qa-migrations to be recreated"))
+		})
+
+		It("fails on other errors", func() {
+			_, err := kubernetes.WaitForRecreatedJob(jobClient(nil, errors.New("forbidden")), oldJob, time.Minute)
+			Expect(err).To(MatchError("forbidden"))
+		})
+	})
+
+	Context("WaitForJob", func() {
+		withCondition := func(condition batchv1.JobCondition) *batchv1.Job {
+			job := oldJob.DeepCopy()
+			job.Status.Conditions = []batchv1.JobCondition{condition}
+			return job
+		}
+
+		It("returns when the job completes", func() {
+			job := withCondition(batchv1.JobCondition{Type: batchv1.JobComplete, Status: corev1.ConditionTrue})
+			Expect(kubernetes.WaitForJob(jobClient(job, nil), oldJob, time.Minute)).To(Succeed())
+		})
+
+		It("fails with the reason the job failed", func() {
+			job := withCondition(batchv1.JobCondition{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded", Message: "Job has reached the specified backoff limit"})
+			err := kubernetes.WaitForJob(jobClient(job, nil), oldJob, time.Minute)
+			Expect(err).To(MatchError("job darwin-qa-migrations failed: BackoffLimitExceeded: Job has reached the specified backoff limit"))
+
+			job = withCondition(batchv1.JobCondition{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "DeadlineExceeded"})
+			err = kubernetes.WaitForJob(jobClient(job, nil), oldJob, time.Minute)
+			Expect(err).To(MatchError("job darwin-qa-migrations failed: DeadlineExceeded"))
+		})
+
+		It("ignores conditions that aren't true", func() {
+			job := withCondition(batchv1.JobCondition{Type: batchv1.JobFailed, Status: corev1.ConditionFalse})
+			err := kubernetes.WaitForJob(jobClient(job, nil), oldJob, time.Millisecond)
+			Expect(err).To(MatchError("timed out waiting for job darwin-qa-migrations to finish"))
+		})
+	})
+})
@@ -21,14 +21,15 @@ import (
 	"fmt"
 	"regexp"
 	"sort"
-	"strings"
 
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	apiextv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -36,10 +37,9 @@ import (
 
 	"github.com/Ridecell/ridecell-operator/pkg/apis"
 	summonv1beta1 "github.com/Ridecell/ridecell-operator/pkg/apis/summon/v1beta1"
+	"github.com/Ridecell/ridectl/pkg/config"
 )
 
-const namespacePrefix = "summon-"
-
 type Subject struct {
 	Region    string
 	Env       string
@@ -51,7 +51,18 @@ type Subject struct {
 type KubeObject struct {
 	Top     runtime.Object
 	Client  client.Client
+	Config  *rest.Config
 	Context *kubeContext
+	// Region limits the search to contexts that could be in that region, like
+	// us for svc-us-prod-... microservices.
+	Region string
+}
+
+// SummonPlatformItem is a SummonPlatform along with where it was found.
+type SummonPlatformItem struct {
+	summonv1beta1.SummonPlatform `json:",inline"`
+	Context                      string `json:"context"`
+	Cluster                      string `json:"cluster"`
 }
 
 type kubeContext struct {
@@ -65,10 +76,14 @@ func init() {
 		// Panic cause this should not happen.
 		panic(err)
 	}
+	err = apiextv1beta1.AddToScheme(scheme.Scheme)
+	if err != nil {
+		panic(err)
+	}
 }
 
 func listPodsWithContext(kubeconfig string, contextObj *kubeContext, listOptions *client.ListOptions, podList chan *KubeObject) {
-	contextClient, err := getClientByContext(kubeconfig, contextObj.Context)
+	contextClient, contextConfig, err := getClientByContext(kubeconfig, contextObj.Context)
 	if err != nil {
 		// User may have an invalid context that causes this to fail. Just return nil and continue.
 		podList <- nil
@@ -90,12 +105,55 @@ func listPodsWithContext(kubeconfig string, contextObj *kubeContext, listOptions
 	newKubeObject := &KubeObject{
 		Top:     fetchPodList,
 		Client:  contextClient,
+		Config:  contextConfig,
 		Context: contextObj,
 	}
 	podList <- newKubeObject
 }
 
+// GetPod finds the first ready pod matching the label selector and, if given,
+// the name regex.
 func GetPod(kubeconfig string, nameRegex *string, labelSelector *string, namespace string, fetchObject *KubeObject) error {
+	err := GetPods(kubeconfig, nameRegex, labelSelector, namespace, fetchObject)
+	if err != nil {
+		return err
+	}
+	podList := fetchObject.Top.(*corev1.PodList)
+	fetchObject.Top = &podList.Items[0]
+	return nil
+}
+
+// GetPods finds all ready pods matching the label selector and, if given, the
+// name regex. They are put in fetchObject.Top as a *corev1.PodList.
+func GetPods(kubeconfig string, nameRegex *string, labelSelector *string, namespace string, fetchObject *KubeObject) error {
+	err := ListPods(kubeconfig, nameRegex, labelSelector, namespace, fetchObject)
+	if err != nil {
+		return err
+	}
+	readyPods := &corev1.PodList{}
+	for _, pod := range fetchObject.Top.(*corev1.PodList).Items {
+		if isPodReady(&pod) {
+			readyPods.Items = append(readyPods.Items, pod)
+		}
+	}
+	if len(readyPods.Items) == 0 {
+		return errors.New("no matching pods are running and ready")
+	}
+	fetchObject.Top = readyPods
+	return nil
+}
+
+// ListPods is like GetPods but includes pods that aren't ready.
+func ListPods(kubeconfig string, nameRegex *string, labelSelector *string, namespace string, fetchObject *KubeObject) error {
+	var nameRegexp *regexp.Regexp
+	if nameRegex != nil {
+		var err error
+		nameRegexp, err = regexp.Compile(*nameRegex)
+		if err != nil {
+			return errors.Wrap(err, "invalid pod name regex")
+		}
+	}
+
 	listOptions := &client.ListOptions{
 		Namespace: namespace,
 	}
@@ -104,25 +162,46 @@ func GetPod(kubeconfig string, nameRegex *string, labelSelector *string, namespa
 		listOptions.SetLabelSelector(*labelSelector)
 	}
 
-	kubeContexts, err := getKubeContexts()
+	kubeContexts, err := getKubeContexts(fetchObject.Region)
 	if err != nil {
 		return err
 	}
 
-	ch := make(chan *KubeObject, len(kubeContexts))
-	for contextName, contextObj := range kubeContexts {
-		kubeContextObj := &kubeContext{
-			Name:    contextName,
-			Context: contextObj,
+	selector := ""
+	if labelSelector != nil {
+		selector = *labelSelector
+	}
+	cache := loadContextCache()
+	cacheKey := contextCacheKey("pods", namespace, selector)
+
+	var tempObject *KubeObject
+	if cachedContext := cachedKubeContext(cache, cacheKey, kubeContexts); cachedContext != nil {
+		ch := make(chan *KubeObject, 1)
+		listPodsWithContext(kubeconfig, cachedContext, listOptions, ch)
+		tempObject = <-ch
+		if tempObject == nil {
+			cache.remove(cacheKey)
 		}
-		go listPodsWithContext(kubeconfig, kubeContextObj, listOptions, ch)
 	}
 
-	tempObject, err := getChannelOutput(len(kubeContexts), ch)
-	if err != nil {
-		return err
+	if tempObject == nil {
+		ch := make(chan *KubeObject, len(kubeContexts))
+		for contextName, contextObj := range kubeContexts {
+			kubeContextObj := &kubeContext{
+				Name:    contextName,
+				Context: contextObj,
+			}
+			go listPodsWithContext(kubeconfig, kubeContextObj, listOptions, ch)
+		}
+
+		tempObject, err = getChannelOutput(len(kubeContexts), ch)
+		if err != nil {
+			return err
+		}
+		cache.store(cacheKey, tempObject.Context.Name, namespace)
 	}
 	fetchObject.Client = tempObject.Client
+	fetchObject.Config = tempObject.Config
 	fetchObject.Context = tempObject.Context
 
 	podList, ok := tempObject.Top.(*corev1.PodList)
@@ -130,41 +209,72 @@ func GetPod(kubeconfig string, nameRegex *string, labelSelector *string, namespa
 		return errors.New("unable to convert top object to podlist")
 	}
 
-	if nameRegex != nil {
-		for _, pod := range podList.Items {
-			match := regexp.MustCompile(*nameRegex).Match([]byte(pod.Name))
-			if match {
-				fetchObject.Top = &pod
-				return nil
-			}
+	matchingPods := &corev1.PodList{}
+	for _, pod := range podList.Items {
+		if nameRegexp == nil || nameRegexp.MatchString(pod.Name) {
+			matchingPods.Items = append(matchingPods.Items, pod)
 		}
-		return errors.New("unable to find pod matching regex")
 	}
-	fetchObject.Top = &podList.Items[0]
+	if len(matchingPods.Items) == 0 {
+		if nameRegexp != nil {
+			return errors.Errorf("no pods match %s", nameRegexp)
+		}
+		return errors.New("no pods found")
+	}
+	fetchObject.Top = matchingPods
 	return nil
 }
 
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
 func GetObject(kubeconfig string, name string, namespace string, fetchObject *KubeObject) error {
-	kubeContexts, err := getKubeContexts()
+	kubeContexts, err := getKubeContexts(fetchObject.Region)
 	if err != nil {
 		return err
 	}
 
-	ch := make(chan *KubeObject, len(kubeContexts))
-	for contextName, contextObj := range kubeContexts {
-		kubeContextObj := &kubeContext{
-			Name:    contextName,
-			Context: contextObj,
+	cache := loadContextCache()
+	cacheKey := contextCacheKey("object", namespace, name)
+
+	var tempObject *KubeObject
+	if cachedContext := cachedKubeContext(cache, cacheKey, kubeContexts); cachedContext != nil {
+		ch := make(chan *KubeObject, 1)
+		getObjectWithContext(kubeconfig, fetchObject.Top, name, namespace, cachedContext, ch)
+		tempObject = <-ch
+		if tempObject == nil {
+			cache.remove(cacheKey)
 		}
-		go getObjectWithContext(kubeconfig, fetchObject.Top, name, namespace, kubeContextObj, ch)
 	}
 
-	tempObject, err := getChannelOutput(len(kubeContexts), ch)
-	if err != nil {
-		return err
+	if tempObject == nil {
+		ch := make(chan *KubeObject, len(kubeContexts))
+		for contextName, contextObj := range kubeContexts {
+			kubeContextObj := &kubeContext{
+				Name:    contextName,
+				Context: contextObj,
+			}
+			go getObjectWithContext(kubeconfig, fetchObject.Top, name, namespace, kubeContextObj, ch)
+		}
+
+		tempObject, err = getChannelOutput(len(kubeContexts), ch)
+		if err != nil {
+			return err
+		}
+		cache.store(cacheKey, tempObject.Context.Name, namespace)
 	}
 	fetchObject.Top = tempObject.Top
 	fetchObject.Client = tempObject.Client
+	fetchObject.Config = tempObject.Config
 	fetchObject.Context = tempObject.Context
 	return nil
 }
@@ -178,7 +288,7 @@ func GetObjectWithClient(contextClient client.Client, name string, namespace str
 }
 
 func getObjectWithContext(kubeconfig string, runtimeObj runtime.Object, name string, namespace string, contextObj *kubeContext, fetchObject chan *KubeObject) {
-	contextClient, err := getClientByContext(kubeconfig, contextObj.Context)
+	contextClient, contextConfig, err := getClientByContext(kubeconfig, contextObj.Context)
 	if err != nil {
 		// User may have an invalid context that causes this to fail. Just return nil and continue.
 		fetchObject <- nil
@@ -194,49 +304,79 @@ func getObjectWithContext(kubeconfig string, runtimeObj runtime.Object, name str
 	newKubeObject := &KubeObject{
 		Top:     runtimeObj,
 		Client:  contextClient,
+		Config:  contextConfig,
 		Context: contextObj,
 	}
 	fetchObject <- newKubeObject
 }
 
-func getKubeContexts() (map[string]*api.Context, error) {
-	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+// getKubeContexts returns the contexts to search, dropping the ones of
+// clusters in other regions when region is set.
+func getKubeContexts(region string) (map[string]*api.Context, error) {
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
 		clientcmd.NewDefaultClientConfigLoadingRules(),
 		&clientcmd.ConfigOverrides{})
-	rawConfig, err := config.RawConfig()
+	rawConfig, err := clientConfig.RawConfig()
+	if err != nil {
+		return nil, err
+	}
+	if region == "" {
+		return rawConfig.Contexts, nil
+	}
+	ridectlConfig, err := config.Get()
 	if err != nil {
 		return nil, err
 	}
-	return rawConfig.Contexts, nil
+	return regionContexts(&rawConfig, ridectlConfig, region), nil
 }
 
-func getClientByContext(kubeconfig string, kubeContext *api.Context) (client.Client, error) {
+// regionContexts drops the contexts pointing at configured clusters of other
+// regions. Other contexts could be anywhere, so they are kept.
+func regionContexts(rawConfig *api.Config, ridectlConfig *config.Config, region string) map[string]*api.Context {
+	contexts := map[string]*api.Context{}
+	for name, kubeContext := range rawConfig.Contexts {
+		if cluster, ok := rawConfig.Clusters[kubeContext.Cluster]; ok {
+			configured := ridectlConfig.ClusterForHost(cluster.Server)
+			if configured != nil && configured.Region != "" && configured.Region != region {
+				continue
+			}
+		}
+		contexts[name] = kubeContext
+	}
+	return contexts
+}
+
+func getClientByContext(kubeconfig string, kubeContext *api.Context) (client.Client, *rest.Config, error) {
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
 	loadingRules.ExplicitPath = kubeconfig
-	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
 		loadingRules,
 		&clientcmd.ConfigOverrides{Context: *kubeContext})
-	cfg, err := config.ClientConfig()
+	cfg, err := clientConfig.ClientConfig()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get client with context")
+		return nil, nil, errors.Wrap(err, "failed to get client with context")
 	}
 
-	// Return error to skip searching non-ridecell hosts
-	if !strings.Contains(cfg.Host, ".kops.ridecell.io") {
-		return nil, errors.New("hostname did not match, ignoring context")
+	// Return error to skip searching hosts that aren't configured
+	ridectlConfig, err := config.Get()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ridectlConfig.AllowsHost(cfg.Host) {
+		return nil, nil, errors.New("hostname did not match, ignoring context")
 	}
 
 	mapper, err := apiutil.NewDiscoveryRESTMapper(cfg)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	client, err := client.New(cfg, client.Options{Scheme: scheme.Scheme, Mapper: mapper})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return client, nil
+	return client, cfg, nil
 }
 
 // Parses the instance and returns an array of strings denoting: [region, env, subject, namespace]
@@ -259,11 +399,15 @@ func ParseSubject(instanceName string) (Subject, error) {
 
 	sMatch := summon.MatchString(instanceName)
 	if sMatch {
+		ridectlConfig, err := config.Get()
+		if err != nil {
+			return subject, err
+		}
 		fields := summon.FindStringSubmatch(instanceName)
 		// summon instances can only parse out name, env and namespace
 		subject.Name = fields[0] // want summon name to keep env as well
 		subject.Env = fields[2]
-		subject.Namespace = namespacePrefix + subject.Env
+		subject.Namespace = ridectlConfig.Namespace(subject.Env)
 		subject.Type = "summon"
 		return subject, nil
 	}
@@ -289,7 +433,7 @@ func getChannelOutput(maxFails int, ch chan *KubeObject) (*KubeObject, error) {
 }
 
 func listSummonPlatformWithContext(kubeconfig string, contextObj *kubeContext, listOptions *client.ListOptions, summonList chan *KubeObject) {
-	contextClient, err := getClientByContext(kubeconfig, contextObj.Context)
+	contextClient, contextConfig, err := getClientByContext(kubeconfig, contextObj.Context)
 	if err != nil {
 		// User may have an invalid context that causes this to fail. Just return nil and continue.
 		summonList <- nil
@@ -311,20 +455,21 @@ func listSummonPlatformWithContext(kubeconfig string, contextObj *kubeContext, l
 	newKubeObject := &KubeObject{
 		Top:     fetchSummonList,
 		Client:  contextClient,
+		Config:  contextConfig,
 		Context: contextObj,
 	}
 	summonList <- newKubeObject
 }
 
-func ListSummonPlatforms(kubeconfig string, nameregex string, namespace string) (summonv1beta1.SummonPlatformList, error) {
-	summonPlatformLists := &summonv1beta1.SummonPlatformList{}
+func ListSummonPlatforms(kubeconfig string, nameregex string, namespace string) ([]SummonPlatformItem, error) {
+	items := []SummonPlatformItem{}
 	listOptions := &client.ListOptions{
 		Namespace: namespace,
 	}
 
-	kubeContexts, err := getKubeContexts()
+	kubeContexts, err := getKubeContexts("")
 	if err != nil {
-		return *summonPlatformLists, err
+		return items, err
 	}
 
 	ch := make(chan *KubeObject, len(kubeContexts))
@@ -345,31 +490,35 @@ func ListSummonPlatforms(kubeconfig string, nameregex string, namespace string)
 
 		summonPlatformList, ok := tempObject.Top.(*summonv1beta1.SummonPlatformList)
 		if !ok {
-			return *summonPlatformList, errors.New("unable to convert top object to summonPlatformList")
+			return items, errors.New("unable to convert top object to summonPlatformList")
 		}
 
-		// if searching for a single tenant, just return a summonPlatformList with that single tenant
-		if nameregex != "" {
-			for _, summonplatform := range summonPlatformList.Items {
+		for _, summonplatform := range summonPlatformList.Items {
+			item := SummonPlatformItem{
+				SummonPlatform: summonplatform,
+				Context:        tempObject.Context.Name,
+				Cluster:        tempObject.Context.Context.Cluster,
+			}
+			// if searching for a single tenant, just return a list with that single tenant
+			if nameregex != "" {
 				match := regexp.MustCompile(nameregex).Match([]byte(summonplatform.Name))
 				if match {
-					summonPlatformLists.Items = append(summonPlatformLists.Items, summonplatform)
-					return *summonPlatformLists, nil
+					return []SummonPlatformItem{item}, nil
 				}
+				continue
 			}
-		} else {
-			summonPlatformLists.Items = append(summonPlatformLists.Items, summonPlatformList.Items...)
+			items = append(items, item)
 		}
 	}
 
 	// if we went through all the clusters and still haven't found a match, return error
 	if nameregex != "" {
-		return *summonPlatformLists, errors.New("unable to find %s" + nameregex + "\n")
+		return items, errors.Errorf("unable to find %s", nameregex)
 	}
 	// Sort the list in alphabetical order
-	sort.Slice(summonPlatformLists.Items, func(i, j int) bool {
-		return summonPlatformLists.Items[i].Name < summonPlatformLists.Items[j].Name
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name < items[j].Name
 	})
 
-	return *summonPlatformLists, nil
+	return items, nil
 }
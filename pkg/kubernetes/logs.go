@@ -0,0 +1,38 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// GetPodLogs opens a stream of a pod's logs, using the rest config the pod was
+// found with.
+func GetPodLogs(fetchObject *KubeObject, pod *corev1.Pod, options *corev1.PodLogOptions) (io.ReadCloser, error) {
+	if fetchObject.Config == nil {
+		return nil, errors.New("no rest config for pod")
+	}
+	coreClient, err := clientset.NewForConfig(fetchObject.Config)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating kubernetes client")
+	}
+	return coreClient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, options).Stream()
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// WaitForPodRunning waits until a pod is running.
+func WaitForPodRunning(fetchObject *KubeObject, pod *corev1.Pod, timeout time.Duration) error {
+	err := wait.PollImmediate(pollInterval, timeout, func() (bool, error) {
+		err := GetObjectWithClient(fetchObject.Client, pod.Name, pod.Namespace, pod)
+		if err != nil {
+			return false, err
+		}
+		switch pod.Status.Phase {
+		case corev1.PodRunning:
+			return true, nil
+		case corev1.PodSucceeded, corev1.PodFailed:
+			return false, errors.Errorf("pod %s stopped before it was ready", pod.Name)
+		}
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return errors.Errorf("timed out waiting for pod %s to start", pod.Name)
+	}
+	return err
+}
+
+// PortForward forwards a free local port to a port on a pod until stopChan is
+// closed, and returns the local port once it is listening.
+func PortForward(fetchObject *KubeObject, pod *corev1.Pod, remotePort int, stopChan chan struct{}) (int, error) {
+	if fetchObject.Config == nil {
+		return 0, errors.New("no rest config for pod")
+	}
+	coreClient, err := clientset.NewForConfig(fetchObject.Config)
+	if err != nil {
+		return 0, errors.Wrap(err, "error creating kubernetes client")
+	}
+	transport, upgrader, err := spdy.RoundTripperFor(fetchObject.Config)
+	if err != nil {
+		return 0, errors.Wrap(err, "error creating port forward transport")
+	}
+	req := coreClient.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(pod.Namespace).
+		SubResource("portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", req.URL())
+
+	readyChan := make(chan struct{})
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{fmt.Sprintf("0:%d", remotePort)}, stopChan, readyChan, ioutil.Discard, ioutil.Discard)
+	if err != nil {
+		return 0, errors.Wrap(err, "error creating port forward")
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- forwarder.ForwardPorts()
+	}()
+
+	select {
+	case <-readyChan:
+	case err := <-errChan:
+		return 0, errors.Wrap(err, "error forwarding port")
+	}
+	ports, err := forwarder.GetPorts()
+	if err != nil {
+		return 0, err
+	}
+	return int(ports[0].Local), nil
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/Ridecell/ridectl/pkg/config"
+	"github.com/Ridecell/ridectl/pkg/kubernetes"
+)
+
+var _ = Describe("Region contexts", func() {
+	rawConfig := &api.Config{
+		Clusters: map[string]*api.Cluster{
+			"us-prod": {Server: "https://api.us-prod.example.com"},
+			"eu-prod": {Server: "https://api.eu-prod.example.com/"},
+			"local":   {Server: "https://127.0.0.1:6443"},
+		},
+		Contexts: map[string]*api.Context{
+			"us-prod": {Cluster: "us-prod"},
+			"eu-prod": {Cluster: "eu-prod"},
+			"local":   {Cluster: "local"},
+			"broken":  {Cluster: "missing"},
+		},
+	}
+	ridectlConfig := &config.Config{
+		Clusters: []config.Cluster{
+			{Name: "us-prod", Region: "us", Server: "https://api.us-prod.example.com"},
+			{Name: "eu-prod", Region: "eu", Server: "https://api.eu-prod.example.com"},
+			{Name: "local", Server: "https://127.0.0.1:6443"},
+		},
+	}
+
+	contextNames := func(contexts map[string]*api.Context) []string {
+		names := []string{}
+		for name := range contexts {
+			names = append(names, name)
+		}
+		return names
+	}
+
+	It("drops contexts of clusters in other regions", func() {
+		Expect(contextNames(kubernetes.RegionContexts(rawConfig, ridectlConfig, "us"))).To(ConsistOf("us-prod", "local", "broken"))
+		Expect(contextNames(kubernetes.RegionContexts(rawConfig, ridectlConfig, "eu"))).To(ConsistOf("eu-prod", "local", "broken"))
+	})
+
+	It("only keeps contexts of unconfigured clusters for a region without clusters", func() {
+		Expect(contextNames(kubernetes.RegionContexts(rawConfig, ridectlConfig, "in"))).To(ConsistOf("local", "broken"))
+	})
+})
@@ -0,0 +1,122 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// RepoConfigFile is the name of the lint config file in the root of a
+// manifest repository. Being hidden keeps it from being linted itself.
+const RepoConfigFile = ".ridectl-lint.yml"
+
+// RepoConfig is the lint configuration of a manifest repository.
+type RepoConfig struct {
+	// Disable lists rules to skip, like --disable.
+	Disable []string `json:"disable"`
+	// Environments are compared with each other for missing secret keys.
+	Environments []string `json:"environments"`
+	// OptionalSecretKeys may be set in some environments and not others.
+	OptionalSecretKeys []string `json:"optionalSecretKeys"`
+	// Promotions are pairs of environments where the second one shouldn't
+	// run an older version than the first.
+	Promotions []Promotion `json:"promotions"`
+	// PinnedEnvironments must set a version instead of using autoDeploy.
+	PinnedEnvironments []string `json:"pinnedEnvironments"`
+}
+
+// Promotion is the order a version moves through two environments in.
+type Promotion struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// DefaultRepoConfig is used for anything not set in the config file.
+var DefaultRepoConfig = RepoConfig{
+	Environments:       []string{"uat", "prod"},
+	Promotions:         []Promotion{{From: "uat", To: "prod"}},
+	PinnedEnvironments: []string{"prod"},
+}
+
+// LoadRepoConfig reads a lint config file.
+func LoadRepoConfig(path string) (*RepoConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", path)
+	}
+	cfg := &RepoConfig{}
+	err = yaml.UnmarshalStrict(data, cfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", path)
+	}
+	for _, rule := range cfg.Disable {
+		if Lookup(rule) == nil {
+			return nil, errors.Errorf("unknown lint rule %s in %s", rule, path)
+		}
+	}
+	if cfg.Environments == nil {
+		cfg.Environments = DefaultRepoConfig.Environments
+	}
+	if cfg.Promotions == nil {
+		cfg.Promotions = DefaultRepoConfig.Promotions
+	}
+	if cfg.PinnedEnvironments == nil {
+		cfg.PinnedEnvironments = DefaultRepoConfig.PinnedEnvironments
+	}
+	return cfg, nil
+}
+
+// FindRepoConfig looks for the lint config file in the directory of path and
+// its parents, up to the root of the git repository. It returns "" if there
+// is none.
+func FindRepoConfig(path string) (string, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	for {
+		candidate := filepath.Join(dir, RepoConfigFile)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return "", nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	summonv1beta1 "github.com/Ridecell/ridecell-operator/pkg/apis/summon/v1beta1"
+	"github.com/pkg/errors"
+
+	"github.com/Ridecell/ridectl/pkg/cmd/edit"
+)
+
+// File is a manifest file being linted.
+type File struct {
+	Path string
+	Raw  []byte
+	// Manifest is nil when the file couldn't be parsed, see ParseError.
+	Manifest   edit.Manifest
+	ParseError error
+	// Region and Env are from the directory name, like us and qa for us-qa.
+	Region string
+	Env    string
+	// Tenant is the file name without the extension, which is the same for
+	// an instance in every environment.
+	Tenant string
+	// Instance is the name the file's objects should have, from the file
+	// and directory names.
+	Instance string
+	// Shared is set for shared.yml, which isn't an instance.
+	Shared bool
+
+	// decryption is set when linting with a Cipher.
+	decryption *decryption
+}
+
+// LoadFile reads and parses a manifest file. Parse errors are kept in the
+// File for the parse rule, only failing to read it is an error.
+func LoadFile(path string) (*File, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dir, base := filepath.Split(path)
+	env := filepath.Base(dir)
+	region := ""
+	if strings.Contains(env, "-") {
+		region = strings.Split(env, "-")[0]
+		env = strings.Split(env, "-")[1]
+	}
+	tenant := strings.Split(base, ".")[0]
+	file := &File{
+		Path:     path,
+		Raw:      raw,
+		Region:   region,
+		Env:      env,
+		Tenant:   tenant,
+		Instance: fmt.Sprintf("%s-%s", tenant, env),
+		Shared:   base == "shared.yml",
+	}
+	file.Manifest, file.ParseError = edit.NewManifest(bytes.NewReader(raw))
+	if file.ParseError != nil {
+		file.Manifest = nil
+	}
+	return file, nil
+}
+
+// Line returns the line number of a byte offset in the file.
+func (f *File) Line(offset int) int {
+	if offset > len(f.Raw) {
+		offset = len(f.Raw)
+	}
+	return bytes.Count(f.Raw[:offset], []byte("\n")) + 1
+}
+
+// ObjectLine returns the line of an object's kind, which is where findings
+// about the whole object point.
+func (f *File) ObjectLine(obj *edit.Object) int {
+	// Secrets already know where their kind is.
+	if obj.KindLoc.End > 0 {
+		return f.Line(obj.Offset + obj.KindLoc.Start)
+	}
+	return f.FieldLine(obj, "kind")
+}
+
+// DataLine returns the line of a secret's data key, or the object's line if
+// it has none.
+func (f *File) DataLine(obj *edit.Object) int {
+	if obj.DataLoc.End > 0 {
+		return f.Line(obj.Offset + obj.DataLoc.Start)
+	}
+	return f.ObjectLine(obj)
+}
+
+// KeyLine returns the line of a secret value, or the data key's line if the
+// key isn't there.
+func (f *File) KeyLine(obj *edit.Object, key string) int {
+	for _, keyLoc := range obj.KeyLocs {
+		if keyLoc.Key == key {
+			return f.Line(obj.Offset + keyLoc.Start)
+		}
+	}
+	return f.DataLine(obj)
+}
+
+// FieldLine returns the line of a field of an object, or where the object
+// starts if the field isn't there.
+func (f *File) FieldLine(obj *edit.Object, path ...string) int {
+	return f.objectLine(obj, obj.FieldLine(path...))
+}
+
+// objectLine turns a line number within an object's raw text into one in
+// the file, with 0 meaning where the object starts.
+func (f *File) objectLine(obj *edit.Object, line int) int {
+	start := f.Line(obj.Offset)
+	if line == 0 {
+		return start
+	}
+	return start + line - 1
+}
+
+// SummonPlatform returns the SummonPlatform at the top of the file, if it's
+// there.
+func (f *File) SummonPlatform() (*edit.Object, *summonv1beta1.SummonPlatform) {
+	if len(f.Manifest) == 0 {
+		return nil, nil
+	}
+	summon, ok := f.Manifest[0].Object.(*summonv1beta1.SummonPlatform)
+	if !ok {
+		return nil, nil
+	}
+	return f.Manifest[0], summon
+}
+
+// EncryptedSecret returns the EncryptedSecret following the SummonPlatform,
+// if it's there.
+func (f *File) EncryptedSecret() *edit.Object {
+	if len(f.Manifest) < 2 || f.Manifest[1].Kind != "EncryptedSecret" {
+		return nil
+	}
+	return f.Manifest[1]
+}
+
+// finding makes a finding for this file.
+func (f *File) finding(line int, format string, args ...interface{}) Finding {
+	return Finding{File: f.Path, Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+// replaceField adds a fix to a finding replacing the value of a string field.
+// Fields that aren't there are left alone, and the finding isn't fixable.
+func (f *File) replaceField(finding Finding, obj *edit.Object, value string, path ...string) Finding {
+	loc, err := obj.FieldLocation(path...)
+	if err != nil {
+		return finding
+	}
+	finding.edits = append(finding.edits, textEdit{start: obj.Offset + loc.Start, end: obj.Offset + loc.End, text: value})
+	return finding
+}
+
+// Files finds the manifests to lint in the given files and directories,
+// skipping hidden ones.
+func Files(paths []string) ([]string, error) {
+	var output []string
+	for _, path := range paths {
+		// If our input is a directory walk it and append to output
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if fileInfo.IsDir() {
+			files, err := walkDir(path)
+			if err != nil {
+				return nil, err
+			}
+			output = append(output, files...)
+		}
+
+		_, filename := filepath.Split(path)
+		// Only care about .yml files and skips hidden files
+		if strings.HasSuffix(filename, ".yml") && !strings.HasPrefix(filename, ".") {
+			output = append(output, path)
+		}
+	}
+	return output, nil
+}
+
+func walkDir(startDir string) ([]string, error) {
+	var fileNames []string
+	err := filepath.Walk(startDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Skip hidden folders
+		if strings.HasPrefix(info.Name(), ".") && info.IsDir() && path != startDir {
+			return filepath.SkipDir
+		}
+		// Only care about .yml files and skips hidden files
+		if strings.HasSuffix(info.Name(), ".yml") && !strings.HasPrefix(info.Name(), ".") {
+			fileNames = append(fileNames, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error walking %s", startDir)
+	}
+	return fileNames, nil
+}
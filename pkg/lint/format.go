@@ -0,0 +1,289 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Formats are the report formats for CI systems, besides the usual --output
+// ones.
+var Formats = []string{"sarif", "junit", "github"}
+
+// Write writes findings in one of Formats. files are all the files that were
+// linted, JUnit reports the ones without findings as passing tests.
+func Write(out io.Writer, format string, files []string, findings []Finding, version string) error {
+	switch format {
+	case "sarif":
+		return WriteSARIF(out, findings, version)
+	case "junit":
+		return WriteJUnit(out, files, findings)
+	case "github":
+		return WriteGitHub(out, findings)
+	default:
+		return errors.Errorf("unknown format %s, must be one of %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// WriteSARIF writes findings as a SARIF 2.1.0 log, for code scanning tools.
+func WriteSARIF(out io.Writer, findings []Finding, version string) error {
+	driver := sarifDriver{
+		Name:           "ridectl lint",
+		Version:        version,
+		InformationURI: "https://github.com/Ridecell/ridectl",
+		Rules:          []sarifRule{},
+	}
+	ruleIndex := map[string]int{}
+	for i, rule := range rules {
+		ruleIndex[rule.ID] = i
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   rule.ID,
+			ShortDescription:     sarifMessage{Text: rule.Description},
+			DefaultConfiguration: sarifConfiguration{Level: string(rule.Severity)},
+		})
+	}
+
+	results := []sarifResult{}
+	for _, finding := range findings {
+		result := sarifResult{
+			RuleID:    finding.Rule,
+			RuleIndex: ruleIndex[finding.Rule],
+			Level:     string(finding.Severity),
+			Message:   sarifMessage{Text: finding.Message},
+		}
+		if finding.File != "" {
+			location := sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(finding.File)},
+			}}
+			if finding.Line > 0 {
+				location.PhysicalLocation.Region = &sarifRegion{StartLine: finding.Line}
+			}
+			result.Locations = append(result.Locations, location)
+		}
+		results = append(results, result)
+	}
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}
+	encoded, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error encoding SARIF")
+	}
+	_, err = out.Write(append(encoded, '\n'))
+	return err
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes a JUnit XML report with a test case for every file. Files
+// with errors fail, warnings only show in the output. Findings without a
+// file get a test case of their own.
+func WriteJUnit(out io.Writer, files []string, findings []Finding) error {
+	byFile := map[string][]Finding{}
+	names := []string{}
+	for _, file := range files {
+		if _, ok := byFile[file]; !ok {
+			names = append(names, file)
+		}
+		byFile[file] = nil
+	}
+	for _, finding := range findings {
+		if _, ok := byFile[finding.File]; !ok {
+			names = append(names, finding.File)
+		}
+		byFile[finding.File] = append(byFile[finding.File], finding)
+	}
+
+	suite := junitTestSuite{Name: "ridectl lint"}
+	for _, name := range names {
+		testCase := junitTestCase{Name: name, ClassName: "ridectl.lint"}
+		if name == "" {
+			testCase.Name = "(no file)"
+		}
+		errorLines := []string{}
+		warningLines := []string{}
+		errorRules := []string{}
+		for _, finding := range byFile[name] {
+			line := fmt.Sprintf("%s: %s [%s]", findingLocation(finding), finding.Message, finding.Rule)
+			if finding.Severity == SeverityError {
+				errorLines = append(errorLines, line)
+				errorRules = append(errorRules, finding.Rule)
+			} else {
+				warningLines = append(warningLines, line)
+			}
+		}
+		if len(errorLines) > 0 {
+			testCase.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d lint errors", len(errorLines)),
+				Type:    strings.Join(uniqueStrings(errorRules), ","),
+				Text:    strings.Join(errorLines, "\n"),
+			}
+			suite.Failures++
+		}
+		testCase.SystemOut = strings.Join(warningLines, "\n")
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	suite.Tests = len(suite.Cases)
+
+	encoded, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error encoding JUnit XML")
+	}
+	_, err = fmt.Fprintf(out, "%s%s\n", xml.Header, encoded)
+	return err
+}
+
+// WriteGitHub writes findings as GitHub Actions workflow commands, which show
+// up as annotations on pull requests.
+func WriteGitHub(out io.Writer, findings []Finding) error {
+	for _, finding := range findings {
+		properties := []string{}
+		if finding.File != "" {
+			properties = append(properties, "file="+githubEscapeProperty(filepath.ToSlash(finding.File)))
+		}
+		if finding.Line > 0 {
+			properties = append(properties, fmt.Sprintf("line=%d", finding.Line))
+		}
+		properties = append(properties, "title="+githubEscapeProperty("ridectl lint "+finding.Rule))
+		_, err := fmt.Fprintf(out, "::%s %s::%s\n", finding.Severity, strings.Join(properties, ","), githubEscapeData(finding.Message))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func githubEscapeData(value string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(value)
+}
+
+func githubEscapeProperty(value string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(value)
+}
+
+func findingLocation(finding Finding) string {
+	if finding.Line > 0 {
+		return fmt.Sprintf("%s:%d", finding.File, finding.Line)
+	}
+	return finding.File
+}
+
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
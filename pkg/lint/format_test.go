@@ -0,0 +1,101 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Ridecell/ridectl/pkg/lint"
+)
+
+var _ = Describe("Formats", func() {
+	findings := []lint.Finding{
+		{Rule: "name-match", Severity: lint.SeverityError, File: "us-qa/darwin.yml", Line: 4, Message: "SummonPlatform name other-qa did not match expected value darwin-qa"},
+		{Rule: "directory", Severity: lint.SeverityWarning, File: "us-qa/darwin.yml", Message: "100%, really: a warning\nover two lines"},
+	}
+
+	It("writes SARIF", func() {
+		out := &bytes.Buffer{}
+		Expect(lint.Write(out, "sarif", nil, findings, "1.2.3")).To(Succeed())
+		log := map[string]interface{}{}
+		Expect(json.Unmarshal(out.Bytes(), &log)).To(Succeed())
+		Expect(log["version"]).To(Equal("2.1.0"))
+		run := log["runs"].([]interface{})[0].(map[string]interface{})
+		driver := run["tool"].(map[string]interface{})["driver"].(map[string]interface{})
+		Expect(driver["version"]).To(Equal("1.2.3"))
+		Expect(driver["rules"]).To(HaveLen(len(lint.Rules())))
+
+		results := run["results"].([]interface{})
+		Expect(results).To(HaveLen(2))
+		first := results[0].(map[string]interface{})
+		Expect(first["ruleId"]).To(Equal("name-match"))
+		Expect(first["level"]).To(Equal("error"))
+		ruleIndex := int(first["ruleIndex"].(float64))
+		Expect(lint.Rules()[ruleIndex].ID).To(Equal("name-match"))
+		location := first["locations"].([]interface{})[0].(map[string]interface{})["physicalLocation"].(map[string]interface{})
+		Expect(location["artifactLocation"]).To(Equal(map[string]interface{}{"uri": "us-qa/darwin.yml"}))
+		Expect(location["region"]).To(Equal(map[string]interface{}{"startLine": 4.0}))
+		second := results[1].(map[string]interface{})
+		Expect(second["level"]).To(Equal("warning"))
+		Expect(second["locations"].([]interface{})[0].(map[string]interface{})["physicalLocation"]).ToNot(HaveKey("region"))
+	})
+
+	It("writes JUnit with a test case per file", func() {
+		out := &bytes.Buffer{}
+		Expect(lint.Write(out, "junit", []string{"us-qa/darwin.yml", "us-qa/other.yml"}, findings, "")).To(Succeed())
+		report := struct {
+			Suites []struct {
+				Tests    int `xml:"tests,attr"`
+				Failures int `xml:"failures,attr"`
+				Cases    []struct {
+					Name    string `xml:"name,attr"`
+					Failure *struct {
+						Type string `xml:"type,attr"`
+						Text string `xml:",chardata"`
+					} `xml:"failure"`
+					SystemOut string `xml:"system-out"`
+				} `xml:"testcase"`
+			} `xml:"testsuite"`
+		}{}
+		Expect(xml.Unmarshal(out.Bytes(), &report)).To(Succeed())
+		suite := report.Suites[0]
+		Expect(suite.Tests).To(Equal(2))
+		Expect(suite.Failures).To(Equal(1))
+		Expect(suite.Cases[0].Name).To(Equal("us-qa/darwin.yml"))
+		Expect(suite.Cases[0].Failure.Type).To(Equal("name-match"))
+		Expect(suite.Cases[0].Failure.Text).To(Equal("us-qa/darwin.yml:4: SummonPlatform name other-qa did not match expected value darwin-qa [name-match]"))
+		Expect(suite.Cases[0].SystemOut).To(ContainSubstring("[directory]"))
+		Expect(suite.Cases[1].Name).To(Equal("us-qa/other.yml"))
+		Expect(suite.Cases[1].Failure).To(BeNil())
+	})
+
+	It("writes GitHub annotations", func() {
+		out := &bytes.Buffer{}
+		Expect(lint.Write(out, "github", nil, findings, "")).To(Succeed())
+		Expect(out.String()).To(Equal("::error file=us-qa/darwin.yml,line=4,title=ridectl lint name-match::SummonPlatform name other-qa did not match expected value darwin-qa\n" +
+			"::warning file=us-qa/darwin.yml,title=ridectl lint directory::100%25, really: a warning%0Aover two lines\n"))
+	})
+
+	It("rejects unknown formats", func() {
+		Expect(lint.Write(&bytes.Buffer{}, "tap", nil, findings, "")).To(MatchError(ContainSubstring("unknown format tap")))
+	})
+})
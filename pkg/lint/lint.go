@@ -0,0 +1,283 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	apiextv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/Ridecell/ridectl/pkg/cmd/edit"
+	"github.com/Ridecell/ridectl/pkg/config"
+)
+
+// Severity is how bad a finding is. Only errors fail a lint run.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Finding is a single problem found by a rule.
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	File     string   `json:"file,omitempty"`
+	Line     int      `json:"line,omitempty"`
+	Message  string   `json:"message"`
+	Fixable  bool     `json:"fixable,omitempty"`
+
+	edits []textEdit
+}
+
+// textEdit replaces a byte range of a file, for --fix.
+type textEdit struct {
+	start int
+	end   int
+	text  string
+}
+
+// Rule is a named check. A new Check is made for every run, so rules that
+// look across files can keep state in it.
+type Rule struct {
+	ID          string
+	Severity    Severity
+	Description string
+	// Shared rules also run on shared.yml, which only gets the basic checks.
+	Shared bool
+	// Gate rules skip the rules after them on files they find problems in,
+	// since those would only add noise.
+	Gate bool
+	New  func(l *Linter) Check
+}
+
+// Check looks at the files of one lint run.
+type Check interface {
+	CheckFile(file *File) []Finding
+}
+
+// Finisher is a Check with findings that need every file, which are asked
+// for after the last one.
+type Finisher interface {
+	Finish() []Finding
+}
+
+// checkFunc is a Check without state.
+type checkFunc func(file *File) []Finding
+
+func (f checkFunc) CheckFile(file *File) []Finding {
+	return f(file)
+}
+
+var rules []*Rule
+
+// Register adds a rule, rules run in the order they were registered.
+func Register(rule *Rule) {
+	if Lookup(rule.ID) != nil {
+		panic("duplicate lint rule " + rule.ID)
+	}
+	rules = append(rules, rule)
+}
+
+// Rules returns every registered rule.
+func Rules() []*Rule {
+	return append([]*Rule{}, rules...)
+}
+
+// Lookup finds a rule by ID, or returns nil.
+func Lookup(id string) *Rule {
+	for _, rule := range rules {
+		if rule.ID == id {
+			return rule
+		}
+	}
+	return nil
+}
+
+// Linter runs the registered rules over manifest files.
+type Linter struct {
+	// Disabled rules are skipped, by ID.
+	Disabled map[string]bool
+	// ImageTags are the Summon versions that exist, nil skips checking them.
+	ImageTags []string
+	// Schemas are the OpenAPI schemas of custom resources, see AddCRD. Kinds
+	// without one aren't validated.
+	Schemas map[schema.GroupVersionKind]*apiextv1beta1.JSONSchemaProps
+	// Config defaults to config.Default.
+	Config *config.Config
+	// Repo is the lint config of the manifest repository, defaulting to
+	// DefaultRepoConfig.
+	Repo *RepoConfig
+	// Cipher decrypts secrets for the decrypt, key-match and mixed-keys
+	// rules, nil skips them.
+	Cipher edit.Cipher
+	// Concurrency is how many files are decrypted at once, 4 by default.
+	Concurrency int
+}
+
+// Disable turns off rules by ID, failing for IDs that don't exist.
+func (l *Linter) Disable(ids ...string) error {
+	if l.Disabled == nil {
+		l.Disabled = map[string]bool{}
+	}
+	for _, id := range ids {
+		if Lookup(id) == nil {
+			known := []string{}
+			for _, rule := range rules {
+				known = append(known, rule.ID)
+			}
+			return errors.Errorf("unknown lint rule %s, must be one of %s", id, strings.Join(known, ", "))
+		}
+		l.Disabled[id] = true
+	}
+	return nil
+}
+
+// Enabled checks if a rule will run.
+func (l *Linter) Enabled(id string) bool {
+	return !l.Disabled[id]
+}
+
+func (l *Linter) config() *config.Config {
+	if l.Config == nil {
+		return &config.Default
+	}
+	return l.Config
+}
+
+func (l *Linter) repo() *RepoConfig {
+	if l.Repo == nil {
+		return &DefaultRepoConfig
+	}
+	return l.Repo
+}
+
+// Lint checks files and returns everything found, sorted by file and line.
+func (l *Linter) Lint(filenames []string) ([]Finding, error) {
+	type activeRule struct {
+		rule  *Rule
+		check Check
+	}
+	active := []activeRule{}
+	for _, rule := range rules {
+		if l.Enabled(rule.ID) {
+			active = append(active, activeRule{rule: rule, check: rule.New(l)})
+		}
+	}
+
+	findings := []Finding{}
+	report := func(rule *Rule, found []Finding) {
+		for _, finding := range found {
+			finding.Rule = rule.ID
+			finding.Severity = rule.Severity
+			finding.Fixable = len(finding.edits) > 0
+			findings = append(findings, finding)
+		}
+	}
+	files := []*File{}
+	for _, filename := range filenames {
+		file, err := LoadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	if l.Cipher != nil && (l.Enabled("decrypt") || l.Enabled("key-match") || l.Enabled("mixed-keys")) {
+		l.decryptFiles(files)
+	}
+
+	for _, file := range files {
+		for _, a := range active {
+			if file.Shared && !a.rule.Shared {
+				continue
+			}
+			found := a.check.CheckFile(file)
+			report(a.rule, found)
+			if a.rule.Gate && len(found) > 0 {
+				break
+			}
+		}
+	}
+	for _, a := range active {
+		if finisher, ok := a.check.(Finisher); ok {
+			report(a.rule, finisher.Finish())
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings, nil
+}
+
+// Passed checks if there are no error findings.
+func Passed(findings []Finding) bool {
+	for _, finding := range findings {
+		if finding.Severity == SeverityError {
+			return false
+		}
+	}
+	return true
+}
+
+// Fix applies the fixes of findings to their files and returns how many
+// were fixed in each file. Fixes that overlap an earlier one are left for
+// another run.
+func Fix(findings []Finding) (map[string]int, error) {
+	byFile := map[string][]textEdit{}
+	counts := map[string]int{}
+	for _, finding := range findings {
+		if len(finding.edits) > 0 {
+			byFile[finding.File] = append(byFile[finding.File], finding.edits...)
+		}
+	}
+	for filename, edits := range byFile {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return counts, err
+		}
+		raw, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return counts, err
+		}
+		// Working backwards keeps the earlier offsets valid.
+		sort.SliceStable(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+		limit := len(raw)
+		for _, edit := range edits {
+			if edit.end > limit {
+				continue
+			}
+			raw = append(raw[:edit.start:edit.start], append([]byte(edit.text), raw[edit.end:]...)...)
+			limit = edit.start
+			counts[filename]++
+		}
+		err = ioutil.WriteFile(filename, raw, info.Mode())
+		if err != nil {
+			return counts, errors.Wrapf(err, "error writing %s", filename)
+		}
+	}
+	return counts, nil
+}
@@ -0,0 +1,37 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint_test
+
+import (
+	"testing"
+
+	"github.com/Ridecell/ridecell-operator/pkg/apis"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	hackapis "github.com/Ridecell/ridectl/pkg/apis"
+)
+
+func TestLint(t *testing.T) {
+	// Register all types from ridecell-operator.
+	apis.AddToScheme(scheme.Scheme)
+	hackapis.AddToScheme(scheme.Scheme)
+
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Lint Suite")
+}
@@ -0,0 +1,395 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Ridecell/ridectl/pkg/cmd/edit"
+	"github.com/Ridecell/ridectl/pkg/lint"
+)
+
+const validManifest = `apiVersion: summon.ridecell.io/v1beta1
+kind: SummonPlatform
+metadata:
+  name: darwin-qa
+  namespace: qa
+spec:
+  version: 1-abcdef1-master
+---
+apiVersion: secrets.ridecell.io/v1beta1
+kind: EncryptedSecret
+metadata:
+  name: darwin-qa
+  namespace: qa
+data:
+  SECRET_KEY: AQICAHsecretkey
+`
+
+const summonCRD = `apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: summonplatforms.summon.ridecell.io
+spec:
+  group: summon.ridecell.io
+  names:
+    kind: SummonPlatform
+    plural: summonplatforms
+  version: v1beta1
+  validation:
+    openAPIV3Schema:
+      properties:
+        spec:
+          type: object
+          required: [hostname]
+          properties:
+            hostname:
+              type: string
+              pattern: ^[a-z0-9.-]+$
+            version:
+              type: string
+            replicas:
+              type: integer
+              minimum: 1
+            config:
+              type: object
+              additionalProperties:
+                type: string
+                enum: [a, b]
+`
+
+var _ = Describe("Linter", func() {
+	var tempDir string
+	var linter *lint.Linter
+
+	writeFile := func(name string, content string) string {
+		path := filepath.Join(tempDir, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+		return path
+	}
+
+	lintFiles := func(paths ...string) []lint.Finding {
+		findings, err := linter.Lint(paths)
+		Expect(err).ToNot(HaveOccurred())
+		return findings
+	}
+
+	rulesOf := func(findings []lint.Finding) []string {
+		ids := []string{}
+		for _, finding := range findings {
+			ids = append(ids, finding.Rule)
+		}
+		return ids
+	}
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "lint-test")
+		Expect(err).ToNot(HaveOccurred())
+		linter = &lint.Linter{}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tempDir)
+	})
+
+	It("passes a valid manifest", func() {
+		findings := lintFiles(writeFile("us-qa/darwin.yml", validManifest))
+		Expect(findings).To(BeEmpty())
+		Expect(lint.Passed(findings)).To(BeTrue())
+	})
+
+	It("reports every finding with its rule and line", func() {
+		manifest := strings.Replace(validManifest, "name: darwin-qa\n  namespace: qa\nspec", "name: other-qa\n  namespace: dev\nspec", 1)
+		manifest = strings.Replace(manifest, "AQICAHsecretkey", "plaintext", 1)
+		path := writeFile("us-qa/darwin.yml", manifest)
+		findings := lintFiles(path)
+		Expect(rulesOf(findings)).To(Equal([]string{"name-match", "namespace-match", "encrypted-preamble"}))
+		Expect(findings[0].File).To(Equal(path))
+		Expect(findings[0].Line).To(Equal(4))
+		Expect(findings[0].Message).To(Equal("SummonPlatform name other-qa did not match expected value darwin-qa"))
+		Expect(findings[0].Severity).To(Equal(lint.SeverityError))
+		Expect(findings[0].Fixable).To(BeTrue())
+		Expect(findings[1].Line).To(Equal(5))
+		Expect(findings[1].Message).To(Equal("SummonPlatform namespace dev did not match expected value qa"))
+		Expect(findings[2].Line).To(Equal(15))
+		Expect(findings[2].Fixable).To(BeFalse())
+		Expect(lint.Passed(findings)).To(BeFalse())
+	})
+
+	It("accepts the prefixed namespace", func() {
+		manifest := strings.Replace(validManifest, "namespace: qa", "namespace: summon-qa", -1)
+		Expect(lintFiles(writeFile("us-qa/darwin.yml", manifest))).To(BeEmpty())
+	})
+
+	It("skips later rules when a gate rule fails", func() {
+		findings := lintFiles(writeFile("us-qa/Darwin.yml", "not: [valid"))
+		Expect(rulesOf(findings)).To(Equal([]string{"filename"}))
+		Expect(findings[0].Message).To(Equal(`invalid file name, must match ^[a-z0-9]+\.yml$`))
+		findings = lintFiles(writeFile("us-qa/darwinxyml", "not: [valid"))
+		Expect(rulesOf(findings)).To(Equal([]string{"filename"}))
+		findings = lintFiles(writeFile("us-qa-old/darwin.yml", "not: [valid"))
+		Expect(rulesOf(findings)).To(Equal([]string{"directory"}))
+		Expect(findings[0].Message).To(Equal("got invalid directory name us-qa-old, must match ^([a-z]+-)?[a-z]+$"))
+		findings = lintFiles(writeFile("us-qa/darwin.yml", validManifest+"---\n"+validManifest))
+		Expect(rulesOf(findings)).To(Equal([]string{"object-order"}))
+	})
+
+	It("only checks the basics in shared.yml", func() {
+		Expect(lintFiles(writeFile("us-qa/shared.yml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: anything\n"))).To(BeEmpty())
+	})
+
+	It("checks autodeploy and version", func() {
+		manifest := strings.Replace(validManifest, "  version: 1-abcdef1-master\n", "  version: 1-abcdef1-master\n  autoDeploy: master\n", 1)
+		findings := lintFiles(writeFile("us-qa/darwin.yml", manifest))
+		Expect(rulesOf(findings)).To(Equal([]string{"autodeploy-version"}))
+		Expect(findings[0].Line).To(Equal(7))
+
+		linter.ImageTags = []string{"2-abcdef1-master"}
+		findings = lintFiles(writeFile("us-qa/darwin.yml", validManifest))
+		Expect(rulesOf(findings)).To(Equal([]string{"image-version"}))
+	})
+
+	It("reports duplicates across files", func() {
+		darwin := writeFile("us-qa/darwin.yml", validManifest)
+		other := writeFile("us-qa/other.yml", strings.Replace(validManifest, "darwin-qa", "other-qa", -1))
+		findings := lintFiles(darwin, other)
+		Expect(rulesOf(findings)).To(Equal([]string{"duplicate-secret", "duplicate-secret"}))
+		Expect(findings[0].File).To(Equal(darwin))
+		Expect(findings[0].Message).To(Equal("Duplicate secret value in SECRET_KEY also used in other-qa: SECRET_KEY"))
+		Expect(findings[1].File).To(Equal(other))
+
+		copied := writeFile("us-qa/copied.yml", validManifest)
+		findings = lintFiles(darwin, copied)
+		Expect(rulesOf(findings)).To(ContainElement("duplicate-name"))
+	})
+
+	It("skips disabled rules", func() {
+		manifest := strings.Replace(validManifest, "AQICAHsecretkey", "plaintext", 1)
+		Expect(linter.Disable("encrypted-preamble")).To(Succeed())
+		Expect(lintFiles(writeFile("us-qa/darwin.yml", manifest))).To(BeEmpty())
+		Expect(linter.Disable("not-a-rule")).To(MatchError(ContainSubstring("unknown lint rule not-a-rule")))
+	})
+
+	It("fixes mismatched names and namespaces in place", func() {
+		manifest := strings.Replace(validManifest, "  name: darwin-qa\n  namespace: qa\nspec", "  # Keep me.\n  name: \"other-qa\"\n  namespace: dev\nspec", 1)
+		manifest = strings.Replace(manifest, "  name: darwin-qa\n  namespace: qa\ndata", "  name: darwin-qa\ndata", 1)
+		path := writeFile("us-qa/darwin.yml", manifest)
+		findings := lintFiles(path)
+		Expect(rulesOf(findings)).To(Equal([]string{"name-match", "namespace-match", "namespace-match"}))
+
+		fixed, err := lint.Fix(findings)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fixed).To(Equal(map[string]int{path: 2}))
+		raw, err := ioutil.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		// Without another valid namespace to follow it becomes the summon one.
+		Expect(string(raw)).To(Equal(strings.Replace(manifest, "  name: \"other-qa\"\n  namespace: dev\n", "  name: darwin-qa\n  namespace: summon-qa\n", 1)))
+
+		// The missing namespace can't be fixed automatically.
+		findings = lintFiles(path)
+		Expect(rulesOf(findings)).To(Equal([]string{"namespace-match"}))
+		Expect(findings[0].Fixable).To(BeFalse())
+	})
+
+	It("fixes namespaces to match the rest of the file", func() {
+		manifest := strings.Replace(validManifest, "namespace: qa\nspec", "namespace: dev\nspec", 1)
+		path := writeFile("us-qa/darwin.yml", manifest)
+		fixed, err := lint.Fix(lintFiles(path))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fixed).To(Equal(map[string]int{path: 1}))
+		raw, err := ioutil.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(raw)).To(Equal(validManifest))
+	})
+
+	It("reports unknown fields", func() {
+		manifest := strings.Replace(validManifest, "  version: 1-abcdef1-master\n", "  version: 1-abcdef1-master\n  Hostname: darwin.example.com\n  notifications:\n    slackChanel: '#qa'\n", 1)
+		findings := lintFiles(writeFile("us-qa/darwin.yml", manifest))
+		Expect(rulesOf(findings)).To(Equal([]string{"unknown-field", "unknown-field"}))
+		Expect(findings[0].Line).To(Equal(8))
+		Expect(findings[0].Message).To(Equal("SummonPlatform has unknown field spec.Hostname, did you mean hostname?"))
+		Expect(findings[1].Line).To(Equal(10))
+		Expect(findings[1].Message).To(Equal("SummonPlatform has unknown field spec.notifications.slackChanel"))
+	})
+
+	It("validates objects against their CRD schema", func() {
+		crds, err := lint.ReadCRDs(strings.NewReader("apiVersion: v1\nkind: Namespace\n---\n" + summonCRD))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(crds).To(HaveLen(1))
+
+		manifest := strings.Replace(validManifest, "  version: 1-abcdef1-master\n", "  version: 1-abcdef1-master\n  replicas: 0\n  config:\n    A: a\n    B: c\n", 1)
+		path := writeFile("us-qa/darwin.yml", manifest)
+		// Nothing to validate against yet.
+		Expect(lintFiles(path)).To(BeEmpty())
+
+		linter.AddCRD(crds[0])
+		findings := lintFiles(path)
+		Expect(rulesOf(findings)).To(Equal([]string{"schema", "schema", "schema"}))
+		Expect(findings[0].Line).To(Equal(6))
+		Expect(findings[0].Message).To(Equal("SummonPlatform field spec is missing required field hostname"))
+		Expect(findings[1].Line).To(Equal(8))
+		Expect(findings[1].Message).To(Equal("SummonPlatform field spec.replicas must be at least 1"))
+		Expect(findings[2].Line).To(Equal(11))
+		Expect(findings[2].Message).To(Equal(`SummonPlatform field spec.config.B must be one of "a", "b"`))
+
+		manifest = strings.Replace(validManifest, "  version: 1-abcdef1-master\n", "  version: 1-abcdef1-master\n  hostname: Darwin.example.com\n", 1)
+		findings = lintFiles(writeFile("us-qa/darwin.yml", manifest))
+		Expect(rulesOf(findings)).To(Equal([]string{"schema"}))
+		Expect(findings[0].Message).To(Equal("SummonPlatform field spec.hostname must match ^[a-z0-9.-]+$"))
+	})
+
+	It("compares tenants across environments", func() {
+		inEnv := func(env string, version string, keys string) string {
+			manifest := strings.Replace(validManifest, "qa", env, -1)
+			manifest = strings.Replace(manifest, "version: 1-abcdef1-master", version, 1)
+			return strings.Replace(manifest, "  SECRET_KEY: AQICAHsecretkey\n", keys, 1)
+		}
+		qa := writeFile("us-qa/darwin.yml", inEnv("qa", "autoDeploy: master", "  SECRET_KEY: AQICAHqa\n  QA_KEY: AQICAHqakey\n"))
+		uat := writeFile("us-uat/darwin.yml", inEnv("uat", "version: 12-abcdef1-master", "  SECRET_KEY: AQICAHuat\n  API_KEY: AQICAHuatapi\n  DEBUG_KEY: AQICAHdebug\n"))
+		prod := writeFile("us-prod/darwin.yml", inEnv("prod", "autoDeploy: master", "  SECRET_KEY: AQICAHprod\n  API_KEY: AQICAHprodapi\n"))
+		findings := lintFiles(qa, uat, prod)
+		Expect(rulesOf(findings)).To(Equal([]string{"pinned-version", "secret-keys-match"}))
+		Expect(findings[0].File).To(Equal(prod))
+		Expect(findings[0].Line).To(Equal(7))
+		Expect(findings[0].Message).To(Equal("darwin-prod uses autoDeploy, prod instances must set a version"))
+		Expect(findings[1].File).To(Equal(prod))
+		Expect(findings[1].Message).To(Equal("EncryptedSecret darwin-prod is missing DEBUG_KEY, which is set in darwin-uat"))
+
+		// Other regions are other tenants.
+		other := writeFile("eu-prod/darwin.yml", inEnv("prod", "version: 11-abcdef1-master", "  SECRET_KEY: AQICAHeu\n"))
+		Expect(lintFiles(other, uat)).To(BeEmpty())
+
+		config := writeFile(lint.RepoConfigFile, "environments: [qa, uat, prod]\npinnedEnvironments: []\n")
+		found, err := lint.FindRepoConfig(prod)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(Equal(config))
+		linter.Repo, err = lint.LoadRepoConfig(found)
+		Expect(err).ToNot(HaveOccurred())
+		findings = lintFiles(qa, uat, prod)
+		Expect(rulesOf(findings)).To(Equal([]string{"secret-keys-match", "secret-keys-match", "secret-keys-match", "secret-keys-match", "secret-keys-match"}))
+		Expect(findings[1].File).To(Equal(prod))
+		Expect(findings[1].Message).To(Equal("EncryptedSecret darwin-prod is missing QA_KEY, which is set in darwin-qa"))
+		Expect(findings[2].File).To(Equal(qa))
+		Expect(findings[2].Line).To(Equal(14))
+		Expect(findings[2].Message).To(Equal("EncryptedSecret darwin-qa is missing API_KEY, which is set in darwin-uat, darwin-prod"))
+
+		writeFile(lint.RepoConfigFile, "optionalSecretKeys: [DEBUG_KEY]\npinnedEnvironments: []\n")
+		linter.Repo, err = lint.LoadRepoConfig(found)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(lintFiles(qa, uat, prod)).To(BeEmpty())
+
+		prod = writeFile("us-prod/darwin.yml", inEnv("prod", "version: 11-abcdef1-master", "  SECRET_KEY: AQICAHprod\n  API_KEY: AQICAHprodapi\n"))
+		findings = lintFiles(uat, prod)
+		Expect(rulesOf(findings)).To(Equal([]string{"version-promotion"}))
+		Expect(findings[0].Severity).To(Equal(lint.SeverityError))
+		Expect(findings[0].Message).To(Equal("darwin-prod version 11-abcdef1-master is older than 12-abcdef1-master in darwin-uat"))
+		Expect(lint.Passed(findings)).To(BeFalse())
+	})
+
+	It("rejects unknown settings in the lint config", func() {
+		_, err := lint.LoadRepoConfig(writeFile(lint.RepoConfigFile, "disable: [not-a-rule]\n"))
+		Expect(err).To(MatchError(ContainSubstring("unknown lint rule not-a-rule")))
+		_, err = lint.LoadRepoConfig(writeFile(lint.RepoConfigFile, "promotion: []\n"))
+		Expect(err).To(MatchError(ContainSubstring("unknown field")))
+	})
+
+	It("decrypts secrets to check their keys", func() {
+		keyDir := filepath.Join(tempDir, "keys")
+		writeFile("keys/dev.key", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+		writeFile("keys/other.key", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32)))
+		cipher := edit.NewNaClCipher(keyDir)
+		encrypt := func(keyId string, value string) string {
+			ciphertext, err := cipher.Encrypt(keyId, []byte(value))
+			Expect(err).ToNot(HaveOccurred())
+			return base64.StdEncoding.EncodeToString(ciphertext)
+		}
+		withData := func(data string) string {
+			return strings.Replace(validManifest, "  SECRET_KEY: AQICAHsecretkey\n", data, 1)
+		}
+		writeFile("us-qa/.keys.yml", "default: nacl:dev\n")
+		path := writeFile("us-qa/darwin.yml", withData("  SECRET_KEY: "+encrypt("nacl:dev", "one")+"\n"))
+
+		// Nothing is decrypted without a cipher.
+		Expect(lintFiles(path)).To(BeEmpty())
+		linter.Cipher = cipher
+		linter.Concurrency = 2
+		Expect(lintFiles(path)).To(BeEmpty())
+
+		writeFile("us-qa/.keys.yml", "default: nacl:dev\ndarwin: nacl:other\n")
+		findings := lintFiles(path)
+		Expect(rulesOf(findings)).To(Equal([]string{"key-match"}))
+		Expect(findings[0].Line).To(Equal(14))
+		Expect(findings[0].Message).To(Equal("EncryptedSecret darwin-qa is encrypted with nacl:dev but .keys.yml says nacl:other, run ridectl rotate-key"))
+
+		path = writeFile("us-qa/darwin.yml", withData("  A_KEY: "+encrypt("nacl:other", "one")+"\n  B_KEY: "+encrypt("nacl:dev", "two")+"\n"))
+		findings = lintFiles(path)
+		Expect(rulesOf(findings)).To(Equal([]string{"mixed-keys"}))
+		Expect(findings[0].Line).To(Equal(16))
+		Expect(findings[0].Message).To(Equal("EncryptedSecret darwin-qa mixes keys, B_KEY is encrypted with nacl:dev but earlier values with nacl:other"))
+
+		corrupt := base64.StdEncoding.EncodeToString(append([]byte("RCNACL\x05other"), bytes.Repeat([]byte{0}, 40)...))
+		path = writeFile("us-qa/darwin.yml", withData("  A_KEY: "+encrypt("nacl:other", "one")+"\n  B_KEY: "+corrupt+"\n"))
+		findings = lintFiles(path)
+		Expect(rulesOf(findings)).To(Equal([]string{"decrypt"}))
+		Expect(findings[0].Line).To(Equal(16))
+		Expect(findings[0].Message).To(HavePrefix("EncryptedSecret darwin-qa could not be decrypted, error decrypting value for B_KEY"))
+
+		// Every value of every file is checked, not just the first failure.
+		corruptValue := func(n byte) string {
+			return base64.StdEncoding.EncodeToString(append([]byte("RCNACL\x05other"), bytes.Repeat([]byte{n}, 40)...))
+		}
+		linter.Concurrency = 3
+		paths := []string{writeFile("us-qa/darwin.yml", withData("  A_KEY: "+corruptValue(1)+"\n  B_KEY: "+encrypt("nacl:other", "one")+"\n  C_KEY: "+corruptValue(2)+"\n  D_KEY: "+encrypt("nacl:dev", "two")+"\n"))}
+		for i, name := range []string{"one", "two", "three", "four"} {
+			manifest := strings.Replace(withData("  E_KEY: "+corruptValue(byte(10+i))+"\n  F_KEY: "+corruptValue(byte(20+i))+"\n"), "darwin-qa", name+"-qa", -1)
+			paths = append(paths, writeFile("us-qa/"+name+".yml", manifest))
+		}
+		findings = lintFiles(paths...)
+		Expect(rulesOf(findings)).To(Equal([]string{"decrypt", "decrypt", "mixed-keys", "decrypt", "decrypt", "decrypt", "decrypt", "decrypt", "decrypt", "decrypt", "decrypt"}))
+		Expect(findings[0].Line).To(Equal(15))
+		Expect(findings[0].Message).To(HavePrefix("EncryptedSecret darwin-qa could not be decrypted, error decrypting value for A_KEY"))
+		Expect(findings[1].Line).To(Equal(17))
+		Expect(findings[1].Message).To(HavePrefix("EncryptedSecret darwin-qa could not be decrypted, error decrypting value for C_KEY"))
+		Expect(findings[2].Line).To(Equal(18))
+		Expect(findings[2].Message).To(Equal("EncryptedSecret darwin-qa mixes keys, D_KEY is encrypted with nacl:dev but earlier values with nacl:other"))
+		for _, finding := range findings[3:] {
+			Expect(finding.File).ToNot(Equal(paths[0]))
+		}
+		Expect(findings[9].Message).To(HavePrefix("EncryptedSecret two-qa could not be decrypted, error decrypting value for E_KEY"))
+		Expect(findings[10].Message).To(HavePrefix("EncryptedSecret two-qa could not be decrypted, error decrypting value for F_KEY"))
+	})
+
+	It("finds manifests in directories", func() {
+		writeFile("us-qa/darwin.yml", validManifest)
+		writeFile("us-qa/.hidden.yml", validManifest)
+		writeFile(".git/config.yml", validManifest)
+		writeFile("us-qa/README.md", "")
+		files, err := lint.Files([]string{tempDir})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(Equal([]string{filepath.Join(tempDir, "us-qa/darwin.yml")}))
+	})
+})
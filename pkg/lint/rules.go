@@ -0,0 +1,317 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Ridecell/ridectl/pkg/cmd/edit"
+)
+
+var fileNameRegexp = regexp.MustCompile(`^[a-z0-9]+\.yml$`)
+var dirNameRegexp = regexp.MustCompile(`^([a-z]+-)?[a-z]+$`)
+
+func init() {
+	Register(&Rule{
+		ID:          "filename",
+		Severity:    SeverityError,
+		Description: "File names must match " + fileNameRegexp.String(),
+		Shared:      true,
+		Gate:        true,
+		New: func(_ *Linter) Check {
+			return checkFunc(func(file *File) []Finding {
+				if !fileNameRegexp.MatchString(filepath.Base(file.Path)) {
+					return []Finding{file.finding(0, "invalid file name, must match %s", fileNameRegexp)}
+				}
+				return nil
+			})
+		},
+	})
+
+	Register(&Rule{
+		ID:          "directory",
+		Severity:    SeverityError,
+		Description: "Directory names must be an environment, optionally after a region like us-qa, matching " + dirNameRegexp.String(),
+		Shared:      true,
+		Gate:        true,
+		New: func(_ *Linter) Check {
+			return checkFunc(func(file *File) []Finding {
+				dir := filepath.Base(filepath.Dir(file.Path))
+				if !dirNameRegexp.MatchString(dir) {
+					return []Finding{file.finding(0, "got invalid directory name %s, must match %s", dir, dirNameRegexp)}
+				}
+				return nil
+			})
+		},
+	})
+
+	Register(&Rule{
+		ID:          "parse",
+		Severity:    SeverityError,
+		Description: "Files must be valid Kubernetes manifests",
+		Shared:      true,
+		Gate:        true,
+		New: func(_ *Linter) Check {
+			return checkFunc(func(file *File) []Finding {
+				if file.ParseError != nil {
+					return []Finding{file.finding(0, "%v", file.ParseError)}
+				}
+				return nil
+			})
+		},
+	})
+
+	Register(&Rule{
+		ID:          "object-order",
+		Severity:    SeverityError,
+		Description: "Files must have a SummonPlatform followed by an EncryptedSecret",
+		Gate:        true,
+		New: func(_ *Linter) Check {
+			return checkFunc(func(file *File) []Finding {
+				if len(file.Manifest) != 2 {
+					return []Finding{file.finding(0, "expected two objects in file got %v", len(file.Manifest))}
+				}
+				if obj, _ := file.SummonPlatform(); obj == nil {
+					return []Finding{file.finding(file.ObjectLine(file.Manifest[0]), "SummonPlatform is required to be the first object in manifest")}
+				}
+				if file.EncryptedSecret() == nil {
+					return []Finding{file.finding(file.ObjectLine(file.Manifest[1]), "EncryptedSecret is required to be the second object in manifest")}
+				}
+				return nil
+			})
+		},
+	})
+
+	Register(&Rule{
+		ID:          "duplicate-name",
+		Severity:    SeverityError,
+		Description: "SummonPlatform names must be unique",
+		New: func(_ *Linter) Check {
+			return &duplicateNameCheck{found: map[string]string{}}
+		},
+	})
+
+	Register(&Rule{
+		ID:          "name-match",
+		Severity:    SeverityError,
+		Description: "Object names must be <file name>-<environment>",
+		New: func(_ *Linter) Check {
+			return checkFunc(func(file *File) []Finding {
+				findings := []Finding{}
+				for _, obj := range file.Manifest {
+					if obj.Meta.GetName() != file.Instance {
+						finding := file.finding(file.FieldLine(obj, "metadata", "name"), "%s name %s did not match expected value %s", objectKind(obj), obj.Meta.GetName(), file.Instance)
+						findings = append(findings, file.replaceField(finding, obj, file.Instance, "metadata", "name"))
+					}
+				}
+				return findings
+			})
+		},
+	})
+
+	Register(&Rule{
+		ID:          "namespace-match",
+		Severity:    SeverityError,
+		Description: "Object namespaces must be the environment from the directory name",
+		New: func(l *Linter) Check {
+			ridectlConfig := l.config()
+			return checkFunc(func(file *File) []Finding {
+				valid := func(namespace string) bool {
+					return namespace == file.Env || namespace == ridectlConfig.Namespace(file.Env)
+				}
+				// Follow the other objects in the file if they have a valid
+				// namespace, both forms are in use.
+				expected := ridectlConfig.Namespace(file.Env)
+				for _, obj := range file.Manifest {
+					if valid(obj.Meta.GetNamespace()) {
+						expected = obj.Meta.GetNamespace()
+						break
+					}
+				}
+				findings := []Finding{}
+				for _, obj := range file.Manifest {
+					namespace := obj.Meta.GetNamespace()
+					if !valid(namespace) {
+						finding := file.finding(file.FieldLine(obj, "metadata", "namespace"), "%s namespace %s did not match expected value %s", objectKind(obj), namespace, expected)
+						findings = append(findings, file.replaceField(finding, obj, expected, "metadata", "namespace"))
+					}
+				}
+				return findings
+			})
+		},
+	})
+
+	Register(&Rule{
+		ID:          "autodeploy-version",
+		Severity:    SeverityError,
+		Description: "Exactly one of autoDeploy and version must be set",
+		New: func(_ *Linter) Check {
+			return checkFunc(func(file *File) []Finding {
+				obj, summon := file.SummonPlatform()
+				if summon == nil {
+					return nil
+				}
+				if summon.Spec.AutoDeploy == "" && summon.Spec.Version == "" {
+					return []Finding{file.finding(file.FieldLine(obj, "spec"), "Neither Autodeploy or Version are set.")}
+				}
+				if summon.Spec.AutoDeploy != "" && summon.Spec.Version != "" {
+					return []Finding{file.finding(file.FieldLine(obj, "spec", "version"), "Autodeploy and Version both set, only one should be set at a time.")}
+				}
+				return nil
+			})
+		},
+	})
+
+	Register(&Rule{
+		ID:          "image-version",
+		Severity:    SeverityError,
+		Description: "The version must be an existing Summon image, only checked with GOOGLE_SERVICE_ACCOUNT_KEY set",
+		New: func(l *Linter) Check {
+			tags := map[string]bool{}
+			for _, tag := range l.ImageTags {
+				tags[tag] = true
+			}
+			return checkFunc(func(file *File) []Finding {
+				obj, summon := file.SummonPlatform()
+				if summon == nil || l.ImageTags == nil || summon.Spec.AutoDeploy != "" || summon.Spec.Version == "" {
+					return nil
+				}
+				if !tags[summon.Spec.Version] {
+					return []Finding{file.finding(file.FieldLine(obj, "spec", "version"), `version "%s" does not exist`, summon.Spec.Version)}
+				}
+				return nil
+			})
+		},
+	})
+
+	Register(&Rule{
+		ID:          "encrypted-preamble",
+		Severity:    SeverityError,
+		Description: "EncryptedSecret values must be encrypted",
+		New: func(_ *Linter) Check {
+			return checkFunc(func(file *File) []Finding {
+				secret := file.EncryptedSecret()
+				if secret == nil {
+					return nil
+				}
+				findings := []Finding{}
+				for _, keyLoc := range secret.KeyLocs {
+					if !edit.IsEncrypted(secret.Data[keyLoc.Key]) {
+						findings = append(findings, file.finding(file.KeyLine(secret, keyLoc.Key), "EncryptedSecret %s missing preamble, may not be encrypted.", keyLoc.Key))
+					}
+				}
+				return findings
+			})
+		},
+	})
+
+	Register(&Rule{
+		ID:          "duplicate-secret",
+		Severity:    SeverityError,
+		Description: "Secret values must not be shared between instances or keys",
+		New: func(_ *Linter) Check {
+			return &duplicateSecretCheck{locations: map[string][]secretLocation{}}
+		},
+	})
+}
+
+func objectKind(obj *edit.Object) string {
+	if obj.Kind != "" {
+		return obj.Kind
+	}
+	return obj.Object.GetObjectKind().GroupVersionKind().Kind
+}
+
+type duplicateNameCheck struct {
+	found map[string]string
+}
+
+func (c *duplicateNameCheck) CheckFile(file *File) []Finding {
+	obj, summon := file.SummonPlatform()
+	if summon == nil {
+		return nil
+	}
+	existing, ok := c.found[summon.Name]
+	if ok {
+		return []Finding{file.finding(file.FieldLine(obj, "metadata", "name"), "Duplicate SummonPlatform names not supported: %s found in %s and %s", summon.Name, existing, file.Path)}
+	}
+	c.found[summon.Name] = file.Path
+	return nil
+}
+
+type secretLocation struct {
+	file    string
+	line    int
+	objName string
+	keyName string
+}
+
+type duplicateSecretCheck struct {
+	locations map[string][]secretLocation
+	values    []string
+}
+
+func (c *duplicateSecretCheck) CheckFile(file *File) []Finding {
+	secret := file.EncryptedSecret()
+	if secret == nil {
+		return nil
+	}
+	for _, keyLoc := range secret.KeyLocs {
+		value := secret.Data[keyLoc.Key]
+		if _, ok := c.locations[value]; !ok {
+			c.values = append(c.values, value)
+		}
+		c.locations[value] = append(c.locations[value], secretLocation{
+			file:    file.Path,
+			line:    file.KeyLine(secret, keyLoc.Key),
+			objName: secret.Meta.GetName(),
+			keyName: keyLoc.Key,
+		})
+	}
+	return nil
+}
+
+// Finish reports every place a duplicated value is used, pointing at the
+// others.
+func (c *duplicateSecretCheck) Finish() []Finding {
+	findings := []Finding{}
+	for _, value := range c.values {
+		locations := c.locations[value]
+		if len(locations) < 2 {
+			continue
+		}
+		for i, location := range locations {
+			others := []string{}
+			for j, other := range locations {
+				if i != j {
+					others = append(others, fmt.Sprintf("%s: %s", other.objName, other.keyName))
+				}
+			}
+			sort.Strings(others)
+			findings = append(findings, Finding{
+				File:    location.file,
+				Line:    location.line,
+				Message: fmt.Sprintf("Duplicate secret value in %s also used in %s", location.keyName, strings.Join(others, ", ")),
+			})
+		}
+	}
+	return findings
+}
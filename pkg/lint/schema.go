@@ -0,0 +1,434 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	apiextv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	"github.com/Ridecell/ridectl/pkg/cmd/edit"
+)
+
+func init() {
+	Register(&Rule{
+		ID:          "unknown-field",
+		Severity:    SeverityError,
+		Description: "Objects must not have fields their type doesn't know, which would be dropped",
+		New: func(_ *Linter) Check {
+			return checkFunc(func(file *File) []Finding {
+				findings := []Finding{}
+				for _, obj := range file.Manifest {
+					root, err := objectNode(obj)
+					if err != nil {
+						continue
+					}
+					for _, problem := range unknownFields(root, reflect.TypeOf(obj.Object), "") {
+						findings = append(findings, file.finding(file.objectLine(obj, problem.line), "%s %s", objectKind(obj), problem.message))
+					}
+				}
+				return findings
+			})
+		},
+	})
+
+	Register(&Rule{
+		ID:          "schema",
+		Severity:    SeverityError,
+		Description: "Objects must match the OpenAPI schema of their CRD, only checked with --crd or --crd-from-cluster",
+		New: func(l *Linter) Check {
+			return checkFunc(func(file *File) []Finding {
+				findings := []Finding{}
+				for _, obj := range file.Manifest {
+					schema := l.Schemas[obj.Object.GetObjectKind().GroupVersionKind()]
+					if schema == nil {
+						continue
+					}
+					root, err := objectNode(obj)
+					if err != nil {
+						continue
+					}
+					for _, problem := range validateSchema(root, root.Line, schema, "") {
+						findings = append(findings, file.finding(file.objectLine(obj, problem.line), "%s %s", objectKind(obj), problem.message))
+					}
+				}
+				return findings
+			})
+		},
+	})
+}
+
+// AddCRD adds the OpenAPI schemas of every version of a custom resource for
+// the schema rule.
+func (l *Linter) AddCRD(crd *apiextv1beta1.CustomResourceDefinition) {
+	if l.Schemas == nil {
+		l.Schemas = map[schema.GroupVersionKind]*apiextv1beta1.JSONSchemaProps{}
+	}
+	versions := []string{}
+	if crd.Spec.Version != "" {
+		versions = append(versions, crd.Spec.Version)
+	}
+	for _, version := range crd.Spec.Versions {
+		gvk := schema.GroupVersionKind{Group: crd.Spec.Group, Version: version.Name, Kind: crd.Spec.Names.Kind}
+		if version.Schema != nil && version.Schema.OpenAPIV3Schema != nil {
+			l.Schemas[gvk] = version.Schema.OpenAPIV3Schema
+		} else {
+			versions = append(versions, version.Name)
+		}
+	}
+	if crd.Spec.Validation == nil || crd.Spec.Validation.OpenAPIV3Schema == nil {
+		return
+	}
+	for _, version := range versions {
+		gvk := schema.GroupVersionKind{Group: crd.Spec.Group, Version: version, Kind: crd.Spec.Names.Kind}
+		if l.Schemas[gvk] == nil {
+			l.Schemas[gvk] = crd.Spec.Validation.OpenAPIV3Schema
+		}
+	}
+}
+
+// ReadCRDs reads the CustomResourceDefinitions from a YAML or JSON stream,
+// skipping any other objects in it.
+func ReadCRDs(in io.Reader) ([]*apiextv1beta1.CustomResourceDefinition, error) {
+	crds := []*apiextv1beta1.CustomResourceDefinition{}
+	reader := k8syaml.NewYAMLReader(bufio.NewReader(in))
+	for {
+		raw, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading CRDs")
+		}
+		crd := &apiextv1beta1.CustomResourceDefinition{}
+		err = sigsyaml.Unmarshal(raw, crd)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decoding CRD")
+		}
+		if crd.Kind == "CustomResourceDefinition" {
+			crds = append(crds, crd)
+		}
+	}
+	return crds, nil
+}
+
+// schemaProblem is something wrong with a field, at a line of the object.
+type schemaProblem struct {
+	line    int
+	message string
+}
+
+// objectNode parses an object's raw text again to get at the lines of its
+// fields.
+func objectNode(obj *edit.Object) (*yaml.Node, error) {
+	doc := yaml.Node{}
+	err := yaml.Unmarshal(obj.Raw, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, errors.New("empty document")
+	}
+	return doc.Content[0], nil
+}
+
+func fieldPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+var jsonUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// unknownFields walks the YAML of an object along the Go type it's decoded
+// into, finding the keys the type has no field for. Types that decode
+// themselves, like times and quantities, are left alone.
+func unknownFields(node *yaml.Node, t reflect.Type, path string) []schemaProblem {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(jsonUnmarshaler) {
+		return nil
+	}
+	problems := []schemaProblem{}
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := jsonFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				message := fmt.Sprintf("has unknown field %s", fieldPath(path, key.Value))
+				for name := range fields {
+					if strings.EqualFold(name, key.Value) {
+						message += fmt.Sprintf(", did you mean %s?", name)
+					}
+				}
+				problems = append(problems, schemaProblem{line: key.Line, message: message})
+				continue
+			}
+			problems = append(problems, unknownFields(value, fieldType, fieldPath(path, key.Value))...)
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			problems = append(problems, unknownFields(node.Content[i+1], t.Elem(), fieldPath(path, node.Content[i].Value))...)
+		}
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			problems = append(problems, unknownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return problems
+}
+
+// jsonFields maps the JSON names of a struct's fields to their types, the
+// same way encoding/json sees them.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	embedded := []reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			fieldType := field.Type
+			for fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				embedded = append(embedded, fieldType)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			// Unexported.
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	// Fields of the struct itself win over embedded ones.
+	for _, embeddedType := range embedded {
+		for name, fieldType := range jsonFields(embeddedType) {
+			if _, ok := fields[name]; !ok {
+				fields[name] = fieldType
+			}
+		}
+	}
+	return fields
+}
+
+// validateSchema checks the YAML of an object against an OpenAPI schema.
+// This covers the keywords CRDs use in practice: type, enum, properties,
+// required, additionalProperties, items, the length, size and range limits,
+// pattern and allOf, anyOf and oneOf. Nulls are treated as unset.
+func validateSchema(node *yaml.Node, line int, schema *apiextv1beta1.JSONSchemaProps, path string) []schemaProblem {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.ShortTag() == "!!null" {
+		return nil
+	}
+	fail := func(line int, format string, args ...interface{}) schemaProblem {
+		message := fmt.Sprintf(format, args...)
+		if path != "" {
+			message = fmt.Sprintf("field %s %s", path, message)
+		}
+		return schemaProblem{line: line, message: message}
+	}
+
+	if schema.Type != "" && !schemaTypeMatches(node, schema.Type) {
+		return []schemaProblem{fail(line, "must be of type %s", schema.Type)}
+	}
+	problems := []schemaProblem{}
+
+	if len(schema.Enum) > 0 && !enumContains(node, schema.Enum) {
+		allowed := []string{}
+		for _, value := range schema.Enum {
+			allowed = append(allowed, string(value.Raw))
+		}
+		problems = append(problems, fail(line, "must be one of %s", strings.Join(allowed, ", ")))
+	}
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		problems = append(problems, validateScalar(node, line, schema, fail)...)
+	case yaml.MappingNode:
+		present := map[string]bool{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			present[key.Value] = true
+			if property, ok := schema.Properties[key.Value]; ok {
+				problems = append(problems, validateSchema(value, key.Line, &property, fieldPath(path, key.Value))...)
+			} else if schema.AdditionalProperties != nil {
+				if schema.AdditionalProperties.Schema != nil {
+					problems = append(problems, validateSchema(value, key.Line, schema.AdditionalProperties.Schema, fieldPath(path, key.Value))...)
+				} else if !schema.AdditionalProperties.Allows {
+					problems = append(problems, schemaProblem{line: key.Line, message: fmt.Sprintf("field %s is not allowed by the schema", fieldPath(path, key.Value))})
+				}
+			}
+		}
+		for _, name := range schema.Required {
+			if !present[name] {
+				problems = append(problems, fail(line, "is missing required field %s", name))
+			}
+		}
+	case yaml.SequenceNode:
+		count := int64(len(node.Content))
+		if schema.MinItems != nil && count < *schema.MinItems {
+			problems = append(problems, fail(line, "must have at least %d items", *schema.MinItems))
+		}
+		if schema.MaxItems != nil && count > *schema.MaxItems {
+			problems = append(problems, fail(line, "must have at most %d items", *schema.MaxItems))
+		}
+		if schema.Items != nil {
+			for i, item := range node.Content {
+				itemSchema := schema.Items.Schema
+				if itemSchema == nil && i < len(schema.Items.JSONSchemas) {
+					itemSchema = &schema.Items.JSONSchemas[i]
+				}
+				if itemSchema != nil {
+					problems = append(problems, validateSchema(item, item.Line, itemSchema, fmt.Sprintf("%s[%d]", path, i))...)
+				}
+			}
+		}
+	}
+
+	for i := range schema.AllOf {
+		problems = append(problems, validateSchema(node, line, &schema.AllOf[i], path)...)
+	}
+	if len(schema.AnyOf) > 0 && matchingSchemas(node, line, schema.AnyOf, path) == 0 {
+		problems = append(problems, fail(line, "must match at least one schema in anyOf"))
+	}
+	if len(schema.OneOf) > 0 && matchingSchemas(node, line, schema.OneOf, path) != 1 {
+		problems = append(problems, fail(line, "must match exactly one schema in oneOf"))
+	}
+	return problems
+}
+
+func validateScalar(node *yaml.Node, line int, schema *apiextv1beta1.JSONSchemaProps, fail func(int, string, ...interface{}) schemaProblem) []schemaProblem {
+	problems := []schemaProblem{}
+	switch node.ShortTag() {
+	case "!!int", "!!float":
+		var value float64
+		if node.Decode(&value) != nil {
+			return nil
+		}
+		if schema.Minimum != nil && (value < *schema.Minimum || (schema.ExclusiveMinimum && value == *schema.Minimum)) {
+			problems = append(problems, fail(line, "must be at least %v", *schema.Minimum))
+		}
+		if schema.Maximum != nil && (value > *schema.Maximum || (schema.ExclusiveMaximum && value == *schema.Maximum)) {
+			problems = append(problems, fail(line, "must be at most %v", *schema.Maximum))
+		}
+	case "!!bool":
+	default:
+		length := int64(utf8.RuneCountInString(node.Value))
+		if schema.MinLength != nil && length < *schema.MinLength {
+			problems = append(problems, fail(line, "must be at least %d characters", *schema.MinLength))
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			problems = append(problems, fail(line, "must be at most %d characters", *schema.MaxLength))
+		}
+		if schema.Pattern != "" {
+			pattern, err := regexp.Compile(schema.Pattern)
+			if err == nil && !pattern.MatchString(node.Value) {
+				problems = append(problems, fail(line, "must match %s", schema.Pattern))
+			}
+		}
+	}
+	return problems
+}
+
+// schemaTypeMatches checks a node against an OpenAPI type. Anything YAML
+// doesn't read as a number, bool or null is a string, like it would be once
+// converted to JSON.
+func schemaTypeMatches(node *yaml.Node, schemaType string) bool {
+	switch schemaType {
+	case "object":
+		return node.Kind == yaml.MappingNode
+	case "array":
+		return node.Kind == yaml.SequenceNode
+	}
+	if node.Kind != yaml.ScalarNode {
+		return false
+	}
+	tag := node.ShortTag()
+	switch schemaType {
+	case "integer":
+		return tag == "!!int"
+	case "number":
+		return tag == "!!int" || tag == "!!float"
+	case "boolean":
+		return tag == "!!bool"
+	case "string":
+		return tag != "!!int" && tag != "!!float" && tag != "!!bool"
+	}
+	return true
+}
+
+// enumContains compares a node to the allowed values as JSON.
+func enumContains(node *yaml.Node, enum []apiextv1beta1.JSON) bool {
+	var value interface{}
+	if node.Decode(&value) != nil {
+		return true
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return true
+	}
+	for _, allowed := range enum {
+		var allowedValue interface{}
+		if json.Unmarshal(allowed.Raw, &allowedValue) != nil {
+			continue
+		}
+		allowedEncoded, err := json.Marshal(allowedValue)
+		if err == nil && string(allowedEncoded) == string(encoded) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchingSchemas(node *yaml.Node, line int, schemas []apiextv1beta1.JSONSchemaProps, path string) int {
+	matches := 0
+	for i := range schemas {
+		if len(validateSchema(node, line, &schemas[i], path)) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/Ridecell/ridectl/pkg/cmd/edit"
+)
+
+func init() {
+	Register(&Rule{
+		ID:          "decrypt",
+		Severity:    SeverityError,
+		Description: "EncryptedSecret values must decrypt, only checked with --decrypt",
+		New: func(_ *Linter) Check {
+			return checkFunc(func(file *File) []Finding {
+				d := file.decryption
+				if d == nil {
+					return nil
+				}
+				findings := []Finding{}
+				for _, failure := range d.failures {
+					if cause, ok := failure.err.(edit.DecryptError); ok {
+						findings = append(findings, file.finding(file.KeyLine(failure.obj, cause.Key), "%s %s could not be decrypted, %v", objectKind(failure.obj), failure.obj.Meta.GetName(), cause))
+					}
+				}
+				return findings
+			})
+		},
+	})
+
+	Register(&Rule{
+		ID:          "key-match",
+		Severity:    SeverityError,
+		Description: "EncryptedSecret values must be encrypted with the key from .keys.yml, only checked with --decrypt",
+		New: func(_ *Linter) Check {
+			return checkFunc(func(file *File) []Finding {
+				d := file.decryption
+				if d == nil {
+					return nil
+				}
+				if d.keyErr != nil {
+					return []Finding{file.finding(0, "unable to resolve the key for this file, %v", d.keyErr)}
+				}
+				if d.keyId == "" {
+					return nil
+				}
+				findings := []Finding{}
+				for _, obj := range d.manifest {
+					if obj.KeyId != "" && obj.KeyId != d.keyId {
+						findings = append(findings, file.finding(file.DataLine(obj), "EncryptedSecret %s is encrypted with %s but .keys.yml says %s, run ridectl rotate-key", obj.Meta.GetName(), obj.KeyId, d.keyId))
+					}
+				}
+				return findings
+			})
+		},
+	})
+
+	Register(&Rule{
+		ID:          "mixed-keys",
+		Severity:    SeverityError,
+		Description: "EncryptedSecret values must all be encrypted with the same key, only checked with --decrypt",
+		New: func(_ *Linter) Check {
+			return checkFunc(func(file *File) []Finding {
+				d := file.decryption
+				if d == nil {
+					return nil
+				}
+				findings := []Finding{}
+				for _, failure := range d.failures {
+					if mismatch, ok := failure.err.(edit.KeyMismatchError); ok {
+						findings = append(findings, file.finding(file.KeyLine(failure.obj, mismatch.Key), "%s %s mixes keys, %s is encrypted with %s but earlier values with %s", objectKind(failure.obj), failure.obj.Meta.GetName(), mismatch.Key, mismatch.OtherKeyId, mismatch.KeyId))
+					}
+				}
+				return findings
+			})
+		},
+	})
+}
+
+// decryption is the result of decrypting a file's secrets.
+type decryption struct {
+	// manifest is a decrypted copy of the file's secrets, so the other rules
+	// still see the ciphertexts.
+	manifest edit.Manifest
+	// failures are the values that didn't decrypt or used another key than
+	// the rest of their object.
+	failures []decryptFailure
+	// keyId is the canonical form of the key .keys.yml resolves to for the
+	// file, "" if there is none.
+	keyId  string
+	keyErr error
+}
+
+// decryptFailure is an error from Object.DecryptAll for one value.
+type decryptFailure struct {
+	obj *edit.Object
+	err error
+}
+
+// decryptFiles decrypts the secrets of every instance file. Each value is a
+// KMS call, so only Concurrency files are worked on at once.
+func (l *Linter) decryptFiles(files []*File) {
+	concurrency := l.Concurrency
+	if concurrency < 1 {
+		concurrency = 4
+	}
+	d := &decrypter{cipher: l.Cipher, keyIds: edit.NewKeyIdCache(l.Cipher)}
+	jobs := make(chan *File)
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				file.decryption = d.decrypt(file)
+			}
+		}()
+	}
+	for _, file := range files {
+		if file.Manifest != nil && !file.Shared {
+			jobs <- file
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+type decrypter struct {
+	cipher edit.Cipher
+	// keyIds caches canonical key IDs since most files share a few keys.
+	keyIds *edit.KeyIdCache
+}
+
+func (d *decrypter) decrypt(file *File) *decryption {
+	manifest, err := edit.NewManifest(bytes.NewReader(file.Raw))
+	if err != nil {
+		// Already reported by the parse rule.
+		return nil
+	}
+	// Only EncryptedSecrets can be decrypted, a DecryptedSecret left in a
+	// manifest has nothing to check.
+	secrets := edit.Manifest{}
+	for _, obj := range manifest {
+		if obj.Kind == "EncryptedSecret" {
+			secrets = append(secrets, obj)
+		}
+	}
+	result := &decryption{manifest: secrets}
+	for _, obj := range secrets {
+		for _, err := range obj.DecryptAll(d.cipher) {
+			result.failures = append(result.failures, decryptFailure{obj: obj, err: err})
+		}
+	}
+
+	keyId, err := edit.FindKeyId(file.Path)
+	if err != nil {
+		result.keyErr = err
+	} else if keyId != "" {
+		result.keyId, result.keyErr = d.keyIds.CanonicalKeyId(keyId)
+	}
+	return result
+}
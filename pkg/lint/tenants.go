@@ -0,0 +1,205 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Rules comparing the instances of a tenant across environments, like
+// darwin.yml in us-uat and us-prod.
+
+func init() {
+	Register(&Rule{
+		ID:          "pinned-version",
+		Severity:    SeverityError,
+		Description: "Instances in pinned environments, prod by default, must set a version instead of autoDeploy",
+		New: func(l *Linter) Check {
+			repo := l.repo()
+			return checkFunc(func(file *File) []Finding {
+				obj, summon := file.SummonPlatform()
+				if summon == nil || summon.Spec.AutoDeploy == "" || !contains(repo.PinnedEnvironments, file.Env) {
+					return nil
+				}
+				return []Finding{file.finding(file.FieldLine(obj, "spec", "autoDeploy"), "%s uses autoDeploy, %s instances must set a version", file.Instance, file.Env)}
+			})
+		},
+	})
+
+	Register(&Rule{
+		ID:          "version-promotion",
+		Severity:    SeverityError,
+		Description: "Instances shouldn't run an older version than the environment before them, uat before prod by default",
+		New: func(l *Linter) Check {
+			return &versionPromotionCheck{tenants: tenants{}, repo: l.repo()}
+		},
+	})
+
+	Register(&Rule{
+		ID:          "secret-keys-match",
+		Severity:    SeverityError,
+		Description: "Instances of a tenant must set the same secret keys in every environment",
+		New: func(l *Linter) Check {
+			return &secretKeysCheck{tenants: tenants{}, repo: l.repo()}
+		},
+	})
+}
+
+// tenantInstance is what the cross environment rules need from a file.
+type tenantInstance struct {
+	file        *File
+	version     string
+	versionLine int
+	keys        map[string]bool
+	dataLine    int
+}
+
+// tenants groups instances by region and tenant, then environment.
+type tenants map[string]map[string]*tenantInstance
+
+func (t tenants) add(file *File) {
+	obj, summon := file.SummonPlatform()
+	if summon == nil {
+		return
+	}
+	instance := &tenantInstance{
+		file:        file,
+		version:     summon.Spec.Version,
+		versionLine: file.FieldLine(obj, "spec", "version"),
+		keys:        map[string]bool{},
+	}
+	if secret := file.EncryptedSecret(); secret != nil {
+		for _, keyLoc := range secret.KeyLocs {
+			instance.keys[keyLoc.Key] = true
+		}
+		instance.dataLine = file.DataLine(secret)
+	}
+	group := file.Region + "/" + file.Tenant
+	if t[group] == nil {
+		t[group] = map[string]*tenantInstance{}
+	}
+	t[group][file.Env] = instance
+}
+
+// groups returns the group names in a stable order.
+func (t tenants) groups() []string {
+	groups := []string{}
+	for group := range t {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+var versionRegexp = regexp.MustCompile(`^(\d+)-([0-9a-f]+)-(.*)$`)
+
+// versionBuild returns the build number of a Summon version, or -1 if it
+// doesn't look like one.
+func versionBuild(version string) int {
+	parts := versionRegexp.FindStringSubmatch(version)
+	if parts == nil {
+		return -1
+	}
+	build, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return -1
+	}
+	return build
+}
+
+type versionPromotionCheck struct {
+	tenants tenants
+	repo    *RepoConfig
+}
+
+func (c *versionPromotionCheck) CheckFile(file *File) []Finding {
+	c.tenants.add(file)
+	return nil
+}
+
+func (c *versionPromotionCheck) Finish() []Finding {
+	findings := []Finding{}
+	for _, group := range c.tenants.groups() {
+		for _, promotion := range c.repo.Promotions {
+			from, to := c.tenants[group][promotion.From], c.tenants[group][promotion.To]
+			if from == nil || to == nil {
+				continue
+			}
+			fromBuild, toBuild := versionBuild(from.version), versionBuild(to.version)
+			if fromBuild == -1 || toBuild == -1 || toBuild >= fromBuild {
+				continue
+			}
+			findings = append(findings, to.file.finding(to.versionLine, "%s version %s is older than %s in %s", to.file.Instance, to.version, from.version, from.file.Instance))
+		}
+	}
+	return findings
+}
+
+type secretKeysCheck struct {
+	tenants tenants
+	repo    *RepoConfig
+}
+
+func (c *secretKeysCheck) CheckFile(file *File) []Finding {
+	if contains(c.repo.Environments, file.Env) {
+		c.tenants.add(file)
+	}
+	return nil
+}
+
+// Finish reports each key missing from an instance, pointing at the
+// instances that do set it.
+func (c *secretKeysCheck) Finish() []Finding {
+	findings := []Finding{}
+	for _, group := range c.tenants.groups() {
+		instances := []*tenantInstance{}
+		keys := map[string]bool{}
+		for _, env := range c.repo.Environments {
+			if instance := c.tenants[group][env]; instance != nil {
+				instances = append(instances, instance)
+				for key := range instance.keys {
+					keys[key] = true
+				}
+			}
+		}
+		sortedKeys := []string{}
+		for key := range keys {
+			if !contains(c.repo.OptionalSecretKeys, key) {
+				sortedKeys = append(sortedKeys, key)
+			}
+		}
+		sort.Strings(sortedKeys)
+		for _, instance := range instances {
+			for _, key := range sortedKeys {
+				if instance.keys[key] {
+					continue
+				}
+				others := []string{}
+				for _, other := range instances {
+					if other.keys[key] {
+						others = append(others, other.file.Instance)
+					}
+				}
+				findings = append(findings, instance.file.finding(instance.dataLine, "EncryptedSecret %s is missing %s, which is set in %s", instance.file.Instance, key, strings.Join(others, ", ")))
+			}
+		}
+	}
+	return findings
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package postgres
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// Dump writes a bzip2 compressed dump of the database to out, in pg_dump's
+// custom format so pg_restore can load it. pg_dump's own compression is
+// turned off since bzip2 does better.
+func (c *Connection) Dump(out io.Writer) error {
+	compress := exec.Command("bzip2", "-c")
+	compress.Stdout = out
+	compress.Stderr = os.Stderr
+	pipe, err := compress.StdinPipe()
+	if err != nil {
+		return errors.Wrap(err, "unable to start bzip2")
+	}
+	err = compress.Start()
+	if err != nil {
+		return errors.Wrap(err, "unable to start bzip2")
+	}
+
+	dumpErr := c.Run(exec.Command("pg_dump", "--format=custom", "--compress=0", "--no-owner", "--no-acl"), nil, pipe)
+	pipe.Close()
+	err = compress.Wait()
+	if dumpErr != nil {
+		return errors.Wrap(dumpErr, "pg_dump failed")
+	}
+	if err != nil {
+		return errors.Wrap(err, "bzip2 failed")
+	}
+	return nil
+}
+
+// Restore loads a dump made by Dump into the database, replacing what is
+// there. Uncompressed dumps work too. It all happens in one transaction, so
+// the database is left alone if anything goes wrong.
+func (c *Connection) Restore(in io.Reader) error {
+	buffered := bufio.NewReader(in)
+	var dump io.Reader = buffered
+	magic, err := buffered.Peek(3)
+	if err == nil && string(magic) == "BZh" {
+		dump = bzip2.NewReader(buffered)
+	}
+
+	err = c.Run(exec.Command("pg_restore", "--clean", "--if-exists", "--no-owner", "--no-acl", "--single-transaction", "--exit-on-error", "--dbname="+c.Database), dump, os.Stdout)
+	if err != nil {
+		return errors.Wrap(err, "pg_restore failed")
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package postgres_test
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Ridecell/ridectl/pkg/postgres"
+)
+
+var _ = Describe("Dump and Restore", func() {
+	var tempDir string
+	var oldPath string
+	var conn *postgres.Connection
+
+	// Puts a script in front of the real tool on the PATH.
+	fakeTool := func(name string, script string) {
+		err := ioutil.WriteFile(filepath.Join(tempDir, name), []byte("#!/bin/sh\n"+script), 0700)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "postgres-test")
+		Expect(err).ToNot(HaveOccurred())
+		oldPath = os.Getenv("PATH")
+		os.Setenv("PATH", tempDir+string(os.PathListSeparator)+oldPath)
+		conn = &postgres.Connection{
+			Host:     "db.example.com",
+			Port:     5432,
+			Database: "summon",
+			Username: "summon",
+			Password: "hunter2",
+		}
+	})
+
+	AfterEach(func() {
+		os.Setenv("PATH", oldPath)
+		os.RemoveAll(tempDir)
+	})
+
+	It("compresses the dump with bzip2", func() {
+		fakeTool("pg_dump", `echo "dump of $PGDATABASE: $@"`)
+		out := &bytes.Buffer{}
+		err := conn.Dump(out)
+		Expect(err).ToNot(HaveOccurred())
+		data, err := ioutil.ReadAll(bzip2.NewReader(out))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("dump of summon: --format=custom --compress=0 --no-owner --no-acl\n"))
+	})
+
+	It("fails when pg_dump fails", func() {
+		fakeTool("pg_dump", "echo partial; exit 1")
+		err := conn.Dump(&bytes.Buffer{})
+		Expect(err).To(MatchError(ContainSubstring("pg_dump failed")))
+	})
+
+	It("restores a compressed dump", func() {
+		fakeTool("pg_dump", "echo dump data")
+		fakeTool("pg_restore", `echo "$@"; cat`)
+		dump := &bytes.Buffer{}
+		err := conn.Dump(dump)
+		Expect(err).ToNot(HaveOccurred())
+
+		out := captureStdout(func() {
+			err = conn.Restore(dump)
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(Equal("--clean --if-exists --no-owner --no-acl --single-transaction --exit-on-error --dbname=summon\ndump data\n"))
+	})
+
+	It("restores an uncompressed dump", func() {
+		fakeTool("pg_restore", "cat")
+		var err error
+		out := captureStdout(func() {
+			err = conn.Restore(bytes.NewBufferString("plain dump\n"))
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(Equal("plain dump\n"))
+	})
+
+	It("fails when pg_restore fails", func() {
+		fakeTool("pg_restore", "cat >/dev/null; exit 1")
+		err := conn.Restore(bytes.NewBufferString("plain dump\n"))
+		Expect(err).To(MatchError(ContainSubstring("pg_restore failed")))
+	})
+})
+
+// captureStdout returns everything written to os.Stdout while f runs.
+func captureStdout(f func()) string {
+	reader, writer, err := os.Pipe()
+	Expect(err).ToNot(HaveOccurred())
+	oldStdout := os.Stdout
+	os.Stdout = writer
+	output := make(chan string)
+	go func() {
+		data, _ := ioutil.ReadAll(reader)
+		output <- string(data)
+	}()
+	f()
+	os.Stdout = oldStdout
+	writer.Close()
+	return <-output
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package postgres
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Connection is where and as whom to connect to a database with the postgres
+// command line tools.
+type Connection struct {
+	Host     string
+	Port     int
+	Database string
+	Username string
+	Password string
+	// ReadOnly makes every transaction read-only.
+	ReadOnly bool
+}
+
+// Env returns the environment for a postgres tool. The password only ever
+// lives in the child's environment, it is never written to disk.
+func (c *Connection) Env() []string {
+	env := []string{}
+	for _, value := range os.Environ() {
+		// Don't let the user's own settings point somewhere else.
+		if !strings.HasPrefix(value, "PGPASSFILE=") && !strings.HasPrefix(value, "PGSERVICE=") && !strings.HasPrefix(value, "PGOPTIONS=") {
+			env = append(env, value)
+		}
+	}
+	env = append(env,
+		"PGHOST="+c.Host,
+		"PGPORT="+strconv.Itoa(c.Port),
+		"PGDATABASE="+c.Database,
+		"PGUSER="+c.Username,
+		"PGPASSWORD="+c.Password,
+	)
+	if c.ReadOnly {
+		env = append(env, "PGOPTIONS=-c default_transaction_read_only=on")
+	}
+	return env
+}
+
+// Run runs a postgres tool against the database and waits for it to exit.
+// ridectl keeps running until then whatever signals arrive, so callers can
+// always clean up afterwards. Ctrl-C already reaches the tool through the
+// terminal, other signals are passed on to it.
+func (c *Connection) Run(cmd *exec.Cmd, stdin io.Reader, stdout io.Writer) error {
+	cmd.Env = c.Env()
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if sig != os.Interrupt {
+					cmd.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return cmd.Wait()
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2019 Ridecell, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package postgres_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Ridecell/ridectl/pkg/postgres"
+)
+
+var _ = Describe("Connection", func() {
+	var tempDir string
+	var oldTempDir string
+	var conn *postgres.Connection
+
+	// Stands in for psql, printing what it was given.
+	fakePsql := func(script string) *exec.Cmd {
+		path := filepath.Join(tempDir, "psql")
+		err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0700)
+		Expect(err).ToNot(HaveOccurred())
+		return exec.Command(path)
+	}
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "postgres-test")
+		Expect(err).ToNot(HaveOccurred())
+		// Anything written with ioutil.TempFile would end up in here.
+		oldTempDir = os.Getenv("TMPDIR")
+		os.Setenv("TMPDIR", tempDir)
+		conn = &postgres.Connection{
+			Host:     "db.example.com",
+			Port:     5432,
+			Database: "summon",
+			Username: "summon",
+			Password: "hunter2:with\\escapes",
+		}
+	})
+
+	AfterEach(func() {
+		os.Setenv("TMPDIR", oldTempDir)
+		os.RemoveAll(tempDir)
+	})
+
+	// Checks that no file anywhere under the temp dir holds the password.
+	expectNoCredentialFile := func() {
+		err := filepath.Walk(tempDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			Expect(string(data)).ToNot(ContainSubstring(conn.Password), "found credentials in %s", path)
+			return nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	It("passes the password in the environment only", func() {
+		out := &bytes.Buffer{}
+		err := conn.Run(fakePsql(`printf '%s\n' "$PGHOST $PGPORT $PGDATABASE $PGUSER $PGPASSWORD passfile=${PGPASSFILE:-none}"`), nil, out)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out.String()).To(Equal("db.example.com 5432 summon summon hunter2:with\\escapes passfile=none\n"))
+		expectNoCredentialFile()
+	})
+
+	It("ignores a PGPASSFILE from the user's environment", func() {
+		os.Setenv("PGPASSFILE", "/somewhere/else")
+		defer os.Unsetenv("PGPASSFILE")
+		out := &bytes.Buffer{}
+		err := conn.Run(fakePsql(`echo "${PGPASSFILE:-none}"`), nil, out)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out.String()).To(Equal("none\n"))
+	})
+
+	It("only sets read-only options when asked", func() {
+		Expect(strings.Join(conn.Env(), "\n")).ToNot(ContainSubstring("default_transaction_read_only"))
+		conn.ReadOnly = true
+		Expect(conn.Env()).To(ContainElement("PGOPTIONS=-c default_transaction_read_only=on"))
+	})
+
+	It("leaves no credential file behind when the command fails", func() {
+		err := conn.Run(fakePsql("exit 2"), nil, &bytes.Buffer{})
+		Expect(err).To(HaveOccurred())
+		expectNoCredentialFile()
+	})
+
+	It("survives a hangup signal and passes it on", func() {
+		// The fake psql signals ridectl, which should hand the signal back to it.
+		// Not using SIGTERM here since ginkgo handles that itself.
+		out := &bytes.Buffer{}
+		err := conn.Run(fakePsql(`trap 'kill $!; echo terminated; exit 3' HUP
+kill -HUP $PPID
+sleep 5 >/dev/null &
+wait`), nil, out)
+		Expect(err).To(HaveOccurred())
+		Expect(out.String()).To(Equal("terminated\n"))
+		expectNoCredentialFile()
+	})
+})